@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+	"ytclipper-go/utils"
+	"ytclipper-go/videoprocessing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchClips is the most clips one batch can create, regardless of the
+// length of the job queue.
+const maxBatchClips = 100
+
+// maxBatchFileSizeInMb limits uploaded CSV and JSON batch files.
+const maxBatchFileSizeInMb = 1
+
+// CreateClipBatchDTO lists the clips of a batch. Each clip is a clip request
+// as for POST /api/v1/clip, except that it cannot clip all chapters.
+type CreateClipBatchDTO struct {
+	Clips []CreateClipDTO `json:"clips"`
+}
+
+// CreateClipBatch creates one child job per clip and a parent job that bundles
+// their clips into a zip. The clips are sent as JSON or uploaded as a CSV or
+// JSON file in the file field of a multipart form. It answers with the ID of
+// the parent job.
+func CreateClipBatch(c echo.Context) error {
+	clips, err := bindClipBatch(c)
+	if err != nil {
+		c.Logger().Errorf("Invalid batch: %s", err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": ErrorCodeInvalidRequest})
+	}
+
+	if len(clips) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The batch has no clips.", "code": ErrorCodeInvalidRequest})
+	}
+	maxClips := maxBatchClips
+	if maxLength := config.CONFIG.JobQueueConfig.MaxLength; maxLength > 0 && maxLength < maxClips {
+		maxClips = maxLength
+	}
+	if len(clips) > maxClips {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": fmt.Sprintf("The batch has %d clips; at most %d can be clipped at once.", len(clips), maxClips),
+			"code":  "too_many_clips",
+		})
+	}
+
+	childRequests := make([]jobs.JobRequest, 0, len(clips))
+	for i := range clips {
+		if err := validateBatchClip(&clips[i]); err != nil {
+			c.Logger().Errorf("Invalid clip %d of batch: %s", i+1, err.Error())
+			return invalidClipRequest(c, batchClipError(i, err))
+		}
+
+		request, err := newClipRequest(c.Request().Context(), &clips[i])
+		if err != nil {
+			c.Logger().Errorf("Could not create clip %d of batch: %s", i+1, err.Error())
+			return clipRequestError(c, batchClipError(i, err), fmt.Sprintf("Failed to create clip %d", i+1))
+		}
+		childRequests = append(childRequests, request)
+	}
+
+	parent, children := jobs.NewParentJob(jobs.JobRequest{Batch: true}, childRequests)
+	for _, child := range children {
+		if err := enqueueClip(child); err != nil {
+			c.Logger().Errorf("Could not enqueue job %s of %s: %s", child.ID, parent.ID, err.Error())
+			deleteJobBundle(c, parent, children)
+			return queueFullError(c)
+		}
+	}
+
+	go videoprocessing.ProcessBundle(parent.ID)
+
+	return c.String(http.StatusCreated, parent.ID)
+}
+
+func validateBatchClip(clip *CreateClipDTO) error {
+	if clip.AllChapters {
+		return fmt.Errorf("Batches cannot clip all chapters. Add one clip per chapter instead.")
+	}
+	return validateCreateClipDto(clip)
+}
+
+// batchClipError prefixes the message of err with the number of the clip, so
+// the client knows which clip of the batch was rejected.
+func batchClipError(index int, err error) error {
+	prefix := fmt.Sprintf("Clip %d: ", index+1)
+
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		return &validationError{status: validationErr.status, code: validationErr.code, message: prefix + validationErr.message}
+	}
+	var processingErr *videoprocessing.ProcessingError
+	if errors.As(err, &processingErr) {
+		prefixed := *processingErr
+		prefixed.Message = prefix + processingErr.Message
+		return &prefixed
+	}
+	return fmt.Errorf("%s%s", prefix, err.Error())
+}
+
+// bindClipBatch reads the clips of a batch from a JSON body or from a CSV or
+// JSON file uploaded in the file field.
+func bindClipBatch(c echo.Context) ([]CreateClipDTO, error) {
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return parseClipBatchJSON(io.LimitReader(c.Request().Body, utils.MbToBytes(maxBatchFileSizeInMb)))
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("Upload the batch as a CSV or JSON file in the file field.")
+	}
+	if fileHeader.Size > utils.MbToBytes(maxBatchFileSizeInMb) {
+		return nil, fmt.Errorf("Batch files can be at most %d MB.", maxBatchFileSizeInMb)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".csv":
+		return parseClipBatchCSV(file)
+	case ".json":
+		return parseClipBatchJSON(file)
+	}
+	return nil, fmt.Errorf("Invalid batch file. Use a .csv or .json file.")
+}
+
+// parseClipBatchJSON reads {"clips": [...]} or a bare list of clips.
+func parseClipBatchJSON(r io.Reader) ([]CreateClipDTO, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var clips []CreateClipDTO
+		if err := json.Unmarshal(trimmed, &clips); err != nil {
+			return nil, fmt.Errorf("Invalid JSON: %s", err.Error())
+		}
+		return clips, nil
+	}
+
+	var batch CreateClipBatchDTO
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %s", err.Error())
+	}
+	return batch.Clips, nil
+}
+
+// parseClipBatchCSV reads one clip per row. The header row names the columns:
+// url, from and to, and format or preset; preciseCut and noAudio are optional.
+func parseClipBatchCSV(r io.Reader) ([]CreateClipDTO, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %s", err.Error())
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		switch header[i] {
+		case "url", "from", "to", "format", "preset", "preciseCut", "noAudio":
+		default:
+			return nil, fmt.Errorf("Unknown CSV column %q. Use url, from, to, format, preset, preciseCut and noAudio.", column)
+		}
+	}
+
+	var clips []CreateClipDTO
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return clips, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %s", err.Error())
+		}
+
+		var clip CreateClipDTO
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "url":
+				clip.Url = value
+			case "from":
+				clip.From = value
+			case "to":
+				clip.To = value
+			case "format":
+				clip.Format = value
+			case "preset":
+				clip.Preset = value
+			case "preciseCut", "noAudio":
+				flag, err := parseCSVBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid CSV: %s must be true or false in row %d.", header[i], len(clips)+2)
+				}
+				if header[i] == "preciseCut" {
+					clip.PreciseCut = flag
+				} else {
+					clip.NoAudio = flag
+				}
+			}
+		}
+		clips = append(clips, clip)
+	}
+}
+
+func parseCSVBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"ytclipper-go/videoprocessing"
+)
+
+func TestParseClipBatchCSV(t *testing.T) {
+	data := "url,from,to,format,preciseCut\n" +
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ,00:00:10,00:00:25,22,true\n" +
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ, 00:03:40, 00:03:55, 18,\n"
+
+	clips, err := parseClipBatchCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(clips) != 2 {
+		t.Fatalf("Expected 2 clips, got %d", len(clips))
+	}
+	if clips[0].From != "00:00:10" || clips[0].To != "00:00:25" || clips[0].Format != "22" || !clips[0].PreciseCut {
+		t.Errorf("Unexpected first clip %+v", clips[0])
+	}
+	if clips[1].From != "00:03:40" || clips[1].Format != "18" || clips[1].PreciseCut {
+		t.Errorf("Unexpected second clip %+v", clips[1])
+	}
+}
+
+func TestParseClipBatchCSVRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		expectedMsg string
+	}{
+		{"Unknown column", "url,start,end\n", `Unknown CSV column "start". Use url, from, to, format, preset, preciseCut and noAudio.`},
+		{"Invalid flag", "url,from,to,format,noAudio\nhttps://youtu.be/x,1,2,22,maybe\n", "Invalid CSV: noAudio must be true or false in row 2."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseClipBatchCSV(strings.NewReader(tt.data))
+			if err == nil || err.Error() != tt.expectedMsg {
+				t.Errorf("Expected error message %q, got %v", tt.expectedMsg, err)
+			}
+		})
+	}
+}
+
+func TestParseClipBatchJSON(t *testing.T) {
+	object := `{"clips": [{"url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "from": "10", "to": "25", "preset": "podcast-mp3"}]}`
+	list := ` [{"url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "from": "10", "to": "25", "format": "22"}, {"url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "from": "30", "to": "45", "format": "22"}]`
+
+	clips, err := parseClipBatchJSON(strings.NewReader(object))
+	if err != nil || len(clips) != 1 || clips[0].Preset != "podcast-mp3" {
+		t.Errorf("Expected one preset clip, got %+v (%v)", clips, err)
+	}
+	clips, err = parseClipBatchJSON(strings.NewReader(list))
+	if err != nil || len(clips) != 2 || clips[1].From != "30" {
+		t.Errorf("Expected two clips, got %+v (%v)", clips, err)
+	}
+}
+
+func TestBatchClipError(t *testing.T) {
+	err := batchClipError(2, &validationError{status: http.StatusBadRequest, code: ErrorCodeInvalidRange, message: "The start of the clip must be before its end."})
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) || validationErr.code != ErrorCodeInvalidRange || validationErr.message != "Clip 3: The start of the clip must be before its end." {
+		t.Errorf("Expected a prefixed validation error, got %v", err)
+	}
+
+	original := &videoprocessing.ProcessingError{Code: videoprocessing.ErrorCodeNoChapters, Message: "This video has no chapters."}
+	err = batchClipError(0, original)
+	var processingErr *videoprocessing.ProcessingError
+	if !errors.As(err, &processingErr) || processingErr.Code != videoprocessing.ErrorCodeNoChapters || processingErr.Message != "Clip 1: This video has no chapters." {
+		t.Errorf("Expected a prefixed processing error, got %v", err)
+	}
+	if original.Message != "This video has no chapters." {
+		t.Errorf("Expected the original error to stay unchanged, got %q", original.Message)
+	}
+
+	if err := batchClipError(0, errors.New("Invalid YouTube URL")); err.Error() != "Clip 1: Invalid YouTube URL" {
+		t.Errorf("Expected a prefixed error, got %v", err)
+	}
+}
+
+func TestValidateBatchClipRejectsAllChapters(t *testing.T) {
+	err := validateBatchClip(&CreateClipDTO{Url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", AllChapters: true, Format: "22"})
+	if err == nil || err.Error() != "Batches cannot clip all chapters. Add one clip per chapter instead." {
+		t.Errorf("Expected all chapters to be rejected, got %v", err)
+	}
+}
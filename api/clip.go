@@ -1,20 +1,48 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"ytclipper-go/config"
 	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
 	"ytclipper-go/videoprocessing"
 
 	"github.com/labstack/echo/v4"
 )
 
+// CreateClipDTO selects the clip either by From and To, by Segments joined in
+// order (optionally with a crossfade), by a chapter (index or title), or with
+// AllChapters as one clip per chapter bundled into a zip.
+// Video-only formats are merged with the best audio unless NoAudio is set.
+// Output optionally converts the clip, e.g. into MP3. A Preset replaces Format,
+// NoAudio and Output with one of the configured presets. Subtitles adds the
+// subtitles of the clipped range.
 type CreateClipDTO struct {
-	Url    string `json:"url" form:"url" validate:"required,url"`
-	From   string `json:"from" form:"from" validate:"required"`
-	To     string `json:"to" form:"to" validate:"required"`
-	Format string `json:"format" form:"format" validate:"required"`
+	Url                string              `json:"url" form:"url" validate:"required,url"`
+	From               string              `json:"from" form:"from"`
+	To                 string              `json:"to" form:"to"`
+	Segments           []jobs.ClipSegment  `json:"segments"`
+	CrossfadeInSeconds float64             `json:"crossfadeInSeconds" form:"crossfadeInSeconds"`
+	Format             string              `json:"format" form:"format"`
+	PreciseCut         bool                `json:"preciseCut" form:"preciseCut"`
+	NoAudio            bool                `json:"noAudio" form:"noAudio"`
+	ChapterIndex       *int                `json:"chapterIndex" form:"chapterIndex"`
+	ChapterTitle       string              `json:"chapterTitle" form:"chapterTitle"`
+	AllChapters        bool                `json:"allChapters" form:"allChapters"`
+	Output             *jobs.ClipOutput    `json:"output"`
+	Preset             string              `json:"preset" form:"preset"`
+	Subtitles          *jobs.ClipSubtitles `json:"subtitles"`
+}
+
+func (dto *CreateClipDTO) selectsChapter() bool {
+	return dto.ChapterIndex != nil || dto.ChapterTitle != ""
 }
 
 func CreateClip(c echo.Context) error {
@@ -33,18 +61,216 @@ func CreateClip(c echo.Context) error {
 
 	if err := validateCreateClipDto(createClipDto); err != nil {
 		c.Logger().Errorf("Invalid DTO: %s", err.Error())
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return invalidClipRequest(c, err)
 	}
 
-	job := jobs.NewJob()
+	if createClipDto.AllChapters {
+		return createChapterClips(c, createClipDto)
+	}
+
+	request, err := newClipRequest(c.Request().Context(), createClipDto)
+	if err != nil {
+		c.Logger().Errorf("Could not create clip request: %s", err.Error())
+		return clipRequestError(c, err, "Failed to create clip")
+	}
 
-	go func(jobID string, createClipDTO *CreateClipDTO) {
-		videoprocessing.ProcessClip(jobID, createClipDTO.Url, createClipDTO.From, createClipDTO.To, createClipDTO.Format)
-	}(job.ID, createClipDto)
+	// Identical clips are served by the job that already made or is making
+	// them, without downloading the range again.
+	job, token, reused, err := createSharedJob(c.Request().Context(), request, videoprocessing.ClipRequestKey(request))
+	if errors.Is(err, jobs.ErrQueueFull) {
+		c.Logger().Errorf("Could not enqueue clip: %s", err.Error())
+		return queueFullError(c)
+	}
+	if err != nil {
+		c.Logger().Errorf("Could not create clip job: %s", err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create clip"})
+	}
+	if token != "" {
+		c.Response().Header().Set(HeaderRequesterToken, token)
+	}
+	if reused {
+		c.Logger().Infof("Reusing job %s (%s) for identical clip request", job.ID, job.Status)
+		c.Response().Header().Set(HeaderClipCache, "hit")
+		return c.String(http.StatusOK, job.ID)
+	}
 
+	c.Response().Header().Set(HeaderClipCache, "miss")
 	return c.String(http.StatusCreated, job.ID)
 }
 
+// newClipRequest turns a validated request for a single clip into the request
+// of its job. It checks the subtitles, resolves the chapter and checks that
+// the clip is within the video.
+func newClipRequest(ctx context.Context, createClipDto *CreateClipDTO) (jobs.JobRequest, error) {
+	request := jobs.JobRequest{
+		Url:                createClipDto.Url,
+		From:               createClipDto.From,
+		To:                 createClipDto.To,
+		Segments:           createClipDto.Segments,
+		CrossfadeInSeconds: createClipDto.CrossfadeInSeconds,
+		Format:             createClipDto.Format,
+		PreciseCut:         createClipDto.PreciseCut,
+		NoAudio:            createClipDto.NoAudio,
+		Output:             createClipDto.Output,
+		Preset:             createClipDto.Preset,
+		Subtitles:          createClipDto.Subtitles,
+	}
+
+	if createClipDto.Subtitles != nil {
+		if err := videoprocessing.CheckSubtitlesAvailable(ctx, createClipDto.Url, *createClipDto.Subtitles); err != nil {
+			return request, err
+		}
+	}
+
+	if createClipDto.selectsChapter() {
+		index, chapter, err := videoprocessing.ResolveChapter(ctx, createClipDto.Url, createClipDto.ChapterIndex, createClipDto.ChapterTitle)
+		if err != nil {
+			return request, err
+		}
+		request.From, request.To = chapter.Range()
+		request.ChapterIndex = &index
+		request.ChapterTitle = chapter.Title
+
+		return request, validateClipRange(request.From, request.To)
+	}
+
+	duration, err := videoprocessing.GetVideoDuration(ctx, createClipDto.Url)
+	if err != nil {
+		return request, err
+	}
+	for _, clipRange := range clipRanges(request) {
+		if err := validateClipWithinVideo(clipRange.To, duration); err != nil {
+			return request, err
+		}
+	}
+	return request, nil
+}
+
+// clipRanges returns the segments of the request, or its range for clips
+// without segments.
+func clipRanges(request jobs.JobRequest) []jobs.ClipSegment {
+	if len(request.Segments) > 0 {
+		return request.Segments
+	}
+	return []jobs.ClipSegment{{From: request.From, To: request.To}}
+}
+
+// createChapterClips creates one child job per chapter and a parent job that
+// bundles their clips into a zip. It answers with the ID of the parent job.
+func createChapterClips(c echo.Context, createClipDto *CreateClipDTO) error {
+	if createClipDto.Subtitles != nil {
+		if err := videoprocessing.CheckSubtitlesAvailable(c.Request().Context(), createClipDto.Url, *createClipDto.Subtitles); err != nil {
+			return videoProcessingError(c, err, "Failed to check subtitles")
+		}
+	}
+
+	chapters, err := videoprocessing.GetChapters(c.Request().Context(), createClipDto.Url)
+	if err != nil {
+		return videoProcessingError(c, err, "Failed to fetch chapters")
+	}
+
+	maxLength := config.CONFIG.JobQueueConfig.MaxLength
+	if maxLength > 0 && len(chapters) > maxLength {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": fmt.Sprintf("This video has %d chapters; at most %d can be clipped at once.", len(chapters), maxLength),
+			"code":  "too_many_chapters",
+		})
+	}
+
+	childRequests := make([]jobs.JobRequest, 0, len(chapters))
+	for i, chapter := range chapters {
+		from, to := chapter.Range()
+		if err := validateClipRange(from, to); err != nil {
+			var rangeErr *validationError
+			if errors.As(err, &rangeErr) {
+				rangeErr.message = fmt.Sprintf("Chapter %q: %s", chapter.Title, rangeErr.message)
+			}
+			return invalidClipRequest(c, err)
+		}
+		childRequests = append(childRequests, jobs.JobRequest{
+			Url:          createClipDto.Url,
+			From:         from,
+			To:           to,
+			Format:       createClipDto.Format,
+			PreciseCut:   createClipDto.PreciseCut,
+			NoAudio:      createClipDto.NoAudio,
+			ChapterIndex: &i,
+			ChapterTitle: chapter.Title,
+			Output:       createClipDto.Output,
+			Preset:       createClipDto.Preset,
+			Subtitles:    createClipDto.Subtitles,
+		})
+	}
+
+	parent, children := jobs.NewParentJob(jobs.JobRequest{
+		Url:         createClipDto.Url,
+		Format:      createClipDto.Format,
+		PreciseCut:  createClipDto.PreciseCut,
+		NoAudio:     createClipDto.NoAudio,
+		AllChapters: true,
+		Output:      createClipDto.Output,
+		Preset:      createClipDto.Preset,
+		Subtitles:   createClipDto.Subtitles,
+	}, childRequests)
+
+	for _, child := range children {
+		if err := enqueueClip(child); err != nil {
+			c.Logger().Errorf("Could not enqueue job %s of %s: %s", child.ID, parent.ID, err.Error())
+			deleteJobBundle(c, parent, children)
+			return queueFullError(c)
+		}
+	}
+
+	go videoprocessing.ProcessBundle(parent.ID)
+
+	return c.String(http.StatusCreated, parent.ID)
+}
+
+func enqueueClip(job *jobs.Job) error {
+	return jobs.Queue.Enqueue(job.ID, func(ctx context.Context) {
+		videoprocessing.ProcessClip(ctx, job.ID, job.Request)
+	})
+}
+
+// deleteJobBundle removes a parent job whose children could not all be queued,
+// cancelling the children that already were.
+func deleteJobBundle(c echo.Context, parent *jobs.Job, children []*jobs.Job) {
+	for _, job := range append([]*jobs.Job{parent}, children...) {
+		if err := jobs.CancelJob(job.ID); err != nil && !errors.Is(err, jobs.ErrJobNotCancellable) {
+			c.Logger().Errorf("Could not cancel rejected job %s: %s", job.ID, err.Error())
+		}
+		if err := jobs.DeleteJob(job.ID); err != nil {
+			c.Logger().Errorf("Could not delete rejected job %s: %s", job.ID, err.Error())
+		}
+	}
+}
+
+// invalidClipRequest answers a rejected clip request with the status and code
+// of a validationError, or with 400 for malformed input.
+func invalidClipRequest(c echo.Context, err error) error {
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		return c.JSON(validationErr.status, map[string]string{"error": validationErr.message, "code": validationErr.code})
+	}
+
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": ErrorCodeInvalidRequest})
+}
+
+// clipRequestError answers a clip request that newClipRequest rejected, either
+// for its range or for the video.
+func clipRequestError(c echo.Context, err error, fallbackMessage string) error {
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		return invalidClipRequest(c, err)
+	}
+	return videoProcessingError(c, err, fallbackMessage)
+}
+
+func queueFullError(c echo.Context) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(config.CONFIG.JobQueueConfig.RetryAfterInSeconds))
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Too many clips are being processed. Please try again later."})
+}
+
 func GetClip(c echo.Context) error {
 	jobID := c.QueryParam("jobId")
 	job, exists := jobs.GetJobById(jobID)
@@ -53,5 +279,45 @@ func GetClip(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job does not exist"})
 	}
 
-	return c.File(job.FilePath)
+	ctx := c.Request().Context()
+	object, err := storage.Clips.Stat(ctx, job.FileKey())
+	if errors.Is(err, storage.ErrNotFound) {
+		c.Logger().Errorf("Clip of job %s does not exist anymore", jobID)
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Clip does not exist anymore"})
+	}
+	if err != nil {
+		c.Logger().Errorf("Could not find clip of job %s: %s", jobID, err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get clip"})
+	}
+
+	// Storages that can presign URLs serve the clip themselves; the others
+	// stream it through the server.
+	if config.CONFIG.StorageConfig.RedirectDownloads {
+		expiry := time.Duration(config.CONFIG.StorageConfig.PresignExpiryInMinutes) * time.Minute
+		url, err := storage.Clips.Presign(ctx, object.Key, expiry)
+		if err == nil {
+			return c.Redirect(http.StatusFound, url)
+		}
+		if !errors.Is(err, storage.ErrPresignNotSupported) {
+			c.Logger().Errorf("Could not presign clip of job %s, streaming it instead: %s", jobID, err.Error())
+		}
+	}
+
+	return streamClip(c, object)
+}
+
+// streamClip serves a stored clip, including range requests for seeking.
+func streamClip(c echo.Context, object storage.ObjectInfo) error {
+	reader, err := storage.Clips.Open(c.Request().Context(), object.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Clip does not exist anymore"})
+	}
+	if err != nil {
+		c.Logger().Errorf("Could not open clip %s: %s", object.Key, err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get clip"})
+	}
+	defer reader.Close()
+
+	http.ServeContent(c.Response(), c.Request(), object.Key, object.ModTime, reader)
+	return nil
 }
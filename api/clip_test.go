@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+// presigningStorage is a local storage that presigns like an object store.
+type presigningStorage struct {
+	*storage.LocalStorage
+}
+
+func (s presigningStorage) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "https://bucket.example.com/" + key + "?X-Amz-Expires=" + expiry.String(), nil
+}
+
+func setupClipStorage(t *testing.T, clipStorage func(dir string) storage.Storage) *jobs.Job {
+	originalStore, originalClips := jobs.Store, storage.Clips
+	t.Cleanup(func() { jobs.Store, storage.Clips = originalStore, originalClips })
+
+	dir := t.TempDir()
+	jobs.Store = jobs.NewMemoryJobStore()
+	storage.Clips = clipStorage(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "clip.mp4"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	job := jobs.NewJob(jobs.JobRequest{})
+	jobs.CompleteJob(job.ID, "clip.mp4")
+	return job
+}
+
+func getClip(jobID string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/clip?jobId="+jobID, nil)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	GetClip(echo.New().NewContext(request, recorder))
+	return recorder
+}
+
+func TestGetClipStreamsLocalClips(t *testing.T) {
+	job := setupClipStorage(t, func(dir string) storage.Storage { return storage.NewLocalStorage(dir) })
+
+	recorder := getClip(job.ID, nil)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "0123456789" {
+		t.Errorf("Expected the clip, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = getClip(job.ID, http.Header{"Range": {"bytes=2-4"}})
+	if recorder.Code != http.StatusPartialContent || recorder.Body.String() != "234" {
+		t.Errorf("Expected the requested range, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestGetClipRedirectsToPresignedUrl(t *testing.T) {
+	job := setupClipStorage(t, func(dir string) storage.Storage {
+		return presigningStorage{storage.NewLocalStorage(dir)}
+	})
+
+	recorder := getClip(job.ID, nil)
+	if recorder.Code != http.StatusFound || recorder.Header().Get(echo.HeaderLocation) != "https://bucket.example.com/clip.mp4?X-Amz-Expires=15m0s" {
+		t.Errorf("Expected a redirect to the presigned URL, got %d %s", recorder.Code, recorder.Header().Get(echo.HeaderLocation))
+	}
+}
+
+func TestGetClipOfDeletedClip(t *testing.T) {
+	job := setupClipStorage(t, func(dir string) storage.Storage { return storage.NewLocalStorage(dir) })
+	storage.Clips.Delete(context.Background(), "clip.mp4")
+
+	if recorder := getClip(job.ID, nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted clip, got %d", recorder.Code)
+	}
+	if recorder := getClip("unknown", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+)
+
+// HeaderClipCache tells whether POST /api/v1/clip created a job ("miss") or
+// answered with the job of an identical request ("hit").
+const HeaderClipCache = "X-Clip-Cache"
+
+// HeaderRequesterToken carries the token a request for a queued or running
+// shared job gets from POST /api/v1/clip. DELETE /api/v1/jobs/{id} withdraws
+// that request, and only that one, when it sends the token back.
+const HeaderRequesterToken = "X-Requester-Token"
+
+// createClipLock serializes attaching to a running job and creating a new one,
+// so two identical requests arriving together share one job. It only guards
+// lookups in the request key index, never storage or yt-dlp calls.
+var createClipLock sync.Mutex
+
+// findCompletedJob returns a completed job for the request key whose clip is
+// still in storage. The job is renewed, so the cleanup does not delete the clip
+// right after it was handed out again.
+func findCompletedJob(ctx context.Context, requestKey string) (*jobs.Job, error) {
+	candidates, err := jobs.FindJobsByRequestKey(requestKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range candidates {
+		if job.Status != jobs.StatusCompleted {
+			continue
+		}
+		if _, err := storage.Clips.Stat(ctx, job.FileKey()); err == nil && jobs.RenewCompletedJob(job.ID) {
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+// attachToRunningJob adds a requester to a queued or processing job for the
+// request key and returns it with the token of the requester. Callers hold
+// createClipLock.
+func attachToRunningJob(requestKey string) (*jobs.Job, string, error) {
+	candidates, err := jobs.FindJobsByRequestKey(requestKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, job := range candidates {
+		if job.Status.IsFinished() {
+			continue
+		}
+		if token, attached := jobs.AttachToJob(job.ID); attached {
+			return job, token, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// createSharedJob answers with a job for the clip of request: a completed job
+// whose clip is still stored, a running job it attaches to, or a new job. It
+// returns the requester token for a queued or running job, which a completed
+// job has no use for, and reports whether an existing job was reused.
+func createSharedJob(ctx context.Context, request jobs.JobRequest, requestKey string) (*jobs.Job, string, bool, error) {
+	job, err := findCompletedJob(ctx, requestKey)
+	if err != nil || job != nil {
+		return job, "", job != nil, err
+	}
+
+	createClipLock.Lock()
+	defer createClipLock.Unlock()
+
+	job, token, err := attachToRunningJob(requestKey)
+	if err != nil || job != nil {
+		return job, token, job != nil, err
+	}
+
+	job, token = jobs.NewSharedJob(request, requestKey)
+	if err := enqueueClip(job); err != nil {
+		return nil, "", false, errors.Join(err, jobs.DeleteJob(job.ID))
+	}
+	return job, token, false, nil
+}
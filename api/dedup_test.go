@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+func setupSharedJobs(t *testing.T, maxLength int) string {
+	originalStore, originalQueue, originalClips := jobs.Store, jobs.Queue, storage.Clips
+	t.Cleanup(func() { jobs.Store, jobs.Queue, storage.Clips = originalStore, originalQueue, originalClips })
+
+	clipDir := t.TempDir()
+	jobs.Store = jobs.NewMemoryJobStore()
+	jobs.Queue = blockedQueue(t, maxLength)
+	storage.Clips = storage.NewLocalStorage(clipDir)
+	return clipDir
+}
+
+// blockedQueue returns a queue whose only worker is busy, so enqueued clips
+// stay queued instead of running yt-dlp. They are dropped when the test ends.
+func blockedQueue(t *testing.T, maxLength int) *jobs.JobQueue {
+	queue := jobs.NewJobQueue(1, maxLength)
+	started, release := make(chan struct{}), make(chan struct{})
+	queue.Enqueue("blocker", func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	t.Cleanup(func() {
+		allJobs, _ := jobs.ListJobs()
+		for _, job := range allJobs {
+			queue.Cancel(job.ID)
+		}
+		close(release)
+	})
+	return queue
+}
+
+func TestCreateSharedJob(t *testing.T) {
+	clipDir := setupSharedJobs(t, 10)
+	ctx := context.Background()
+	request := jobs.JobRequest{Url: "https://youtu.be/dQw4w9WgXcQ", From: "65", To: "80", Format: "22"}
+
+	first, firstToken, reused, err := createSharedJob(ctx, request, "key")
+	if err != nil || reused || first.RequestKey != "key" || firstToken == "" {
+		t.Fatalf("Expected a new shared job, got %+v, %q, %t, %v", first, firstToken, reused, err)
+	}
+
+	second, secondToken, reused, err := createSharedJob(ctx, request, "key")
+	if err != nil || !reused || second.ID != first.ID || secondToken == "" || secondToken == firstToken {
+		t.Fatalf("Expected to attach to the queued job, got %+v, %q, %t, %v", second, secondToken, reused, err)
+	}
+	if job, _ := jobs.GetJobById(first.ID); len(job.RequesterTokens) != 2 {
+		t.Errorf("Expected 2 requesters, got %d", len(job.RequesterTokens))
+	}
+
+	if other, _, reused, _ := createSharedJob(ctx, request, "other-key"); reused || other.ID == first.ID {
+		t.Errorf("Expected a new job for another key, got %+v", other)
+	}
+
+	jobs.CompleteJob(first.ID, "missing.mp4")
+	if job, _, reused, _ := createSharedJob(ctx, request, "key"); reused || job.ID == first.ID {
+		t.Errorf("Expected completed jobs without a clip not to be reused, got %+v", job)
+	}
+
+	if err := os.WriteFile(filepath.Join(clipDir, "clip.mp4"), []byte("clip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jobs.CompleteJob(first.ID, "clip.mp4")
+	completedAt := time.Now().Add(-time.Hour)
+	jobs.Store.Update(first.ID, func(job *jobs.Job) { job.CompletedAt = completedAt })
+	if job, token, reused, _ := createSharedJob(ctx, request, "key"); !reused || job.ID != first.ID || token != "" {
+		t.Errorf("Expected the completed job to be reused without a token, got %+v, %q", job, token)
+	}
+	if job, _ := jobs.GetJobById(first.ID); !job.CompletedAt.After(completedAt) {
+		t.Errorf("Expected the reused job to be renewed, got %v", job.CompletedAt)
+	}
+}
+
+func TestCreateSharedJobSkipsCancelledJobs(t *testing.T) {
+	setupSharedJobs(t, 10)
+	ctx := context.Background()
+	request := jobs.JobRequest{Url: "https://youtu.be/dQw4w9WgXcQ", From: "10", To: "20", Format: "22"}
+
+	cancelled, _, _, _ := createSharedJob(ctx, request, "key")
+	jobs.CancelJob(cancelled.ID)
+
+	if job, _, reused, _ := createSharedJob(ctx, request, "key"); reused || job.ID == cancelled.ID {
+		t.Errorf("Expected cancelled jobs not to be reused, got %+v", job)
+	}
+}
+
+func TestCreateSharedJobWhenQueueIsFull(t *testing.T) {
+	setupSharedJobs(t, 1)
+	jobs.Queue.Enqueue("filler", func(ctx context.Context) {})
+
+	_, _, _, err := createSharedJob(context.Background(), jobs.JobRequest{}, "key")
+	if err == nil {
+		t.Fatal("Expected an error when the queue is full")
+	}
+	if found, _ := jobs.FindJobsByRequestKey("key"); len(found) != 0 {
+		t.Errorf("Expected the rejected job to be deleted, got %+v", found)
+	}
+}
+
+func cancelJob(jobID string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodDelete, "/api/v1/jobs/"+jobID, nil)
+	if token != "" {
+		request.Header.Set(HeaderRequesterToken, token)
+	}
+	recorder := httptest.NewRecorder()
+	c := echo.New().NewContext(request, recorder)
+	c.SetParamNames("id")
+	c.SetParamValues(jobID)
+	CancelJob(c)
+	return recorder
+}
+
+func TestCancelSharedJobWithRequesterTokens(t *testing.T) {
+	setupSharedJobs(t, 10)
+	ctx := context.Background()
+	request := jobs.JobRequest{Url: "https://youtu.be/dQw4w9WgXcQ", From: "10", To: "20", Format: "22"}
+
+	job, firstToken, _, _ := createSharedJob(ctx, request, "key")
+	_, secondToken, _, _ := createSharedJob(ctx, request, "key")
+
+	if recorder := cancelJob(job.ID, firstToken); recorder.Code != http.StatusAccepted || !strings.Contains(recorder.Body.String(), `"status":"detached"`) {
+		t.Fatalf("Expected the first request to detach, got %d %s", recorder.Code, recorder.Body)
+	}
+	for _, token := range []string{firstToken, ""} {
+		if recorder := cancelJob(job.ID, token); recorder.Code != http.StatusForbidden {
+			t.Errorf("Expected %q not to withdraw again, got %d %s", token, recorder.Code, recorder.Body)
+		}
+	}
+	if job, _ := jobs.GetJobById(job.ID); job.Status != jobs.StatusQueued {
+		t.Fatalf("Expected the job to keep running for the second request, got %s", job.Status)
+	}
+
+	if recorder := cancelJob(job.ID, secondToken); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"status":"cancelled"`) {
+		t.Errorf("Expected the last request to cancel the job, got %d %s", recorder.Code, recorder.Body)
+	}
+	if job, _ := jobs.GetJobById(job.ID); job.Status != jobs.StatusCancelled {
+		t.Errorf("Expected the job to be cancelled, got %s", job.Status)
+	}
+}
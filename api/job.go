@@ -1,13 +1,47 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 	"ytclipper-go/jobs"
 
 	"github.com/labstack/echo/v4"
 )
 
+const jobEventsHeartbeatInterval = 15 * time.Second
+
+// jobStatusDetached answers DELETE /api/v1/jobs/{id} for a request that
+// withdrew from a shared job, which keeps running for its other requests.
+const jobStatusDetached = "detached"
+
+// JobStatusDTO is the v2 job status document. It never exposes server file
+// paths; completed clips are referenced by their download URL. Parent jobs
+// count their children by status in Children.
+type JobStatusDTO struct {
+	ID            string               `json:"id"`
+	Status        jobs.JobStatus       `json:"status"`
+	Progress      *jobs.JobProgress    `json:"progress,omitempty"`
+	QueuePosition int                  `json:"queuePosition,omitempty"`
+	Request       jobs.JobRequest      `json:"request"`
+	ParentJobID   string               `json:"parentJobId,omitempty"`
+	ChildJobIDs   []string             `json:"childJobIds,omitempty"`
+	Children      *jobs.ChildJobCounts `json:"children,omitempty"`
+	Error         *JobErrorDTO         `json:"error,omitempty"`
+	CreatedAt     *time.Time           `json:"createdAt,omitempty"`
+	StartedAt     *time.Time           `json:"startedAt,omitempty"`
+	CompletedAt   *time.Time           `json:"completedAt,omitempty"`
+	DownloadUrl   string               `json:"downloadUrl,omitempty"`
+	Result        *jobs.JobResult      `json:"result,omitempty"`
+}
+
+type JobErrorDTO struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 func GetJobStatus(c echo.Context) error {
 	jobID := c.QueryParam("jobId")
 
@@ -18,10 +52,13 @@ func GetJobStatus(c echo.Context) error {
 
 	switch job.Status {
 	case jobs.StatusQueued:
+		return c.JSON(http.StatusCreated, map[string]int{"queuePosition": job.QueuePosition})
 	case jobs.StatusProcessing:
-		return c.JSON(http.StatusCreated, nil)
+		return c.JSON(http.StatusCreated, job.Progress)
 	case jobs.StatusCompleted:
 		return c.JSON(http.StatusOK, job.FilePath)
+	case jobs.StatusCancelled:
+		return c.JSON(http.StatusGone, map[string]string{"error": "Job was cancelled"})
 	case jobs.StatusError:
 	default:
 		return c.JSON(http.StatusInternalServerError, job.Error)
@@ -29,3 +66,142 @@ func GetJobStatus(c echo.Context) error {
 
 	return c.JSON(http.StatusInternalServerError, job.Error)
 }
+
+// GetJob returns the v2 status document. Unlike GetJobStatus it answers 200
+// for every known job; the state is in the document, not in the status code.
+func GetJob(c echo.Context) error {
+	jobID := c.Param("id")
+
+	job, exists := jobs.GetJobById(jobID)
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Job %s not found", jobID)})
+	}
+
+	return c.JSON(http.StatusOK, newJobStatusDTO(job))
+}
+
+// CancelJob cancels a job. A shared job is only withdrawn from by the request
+// whose token is sent in HeaderRequesterToken, and cancelled once every request
+// withdrew.
+func CancelJob(c echo.Context) error {
+	jobID := c.Param("id")
+
+	err := jobs.WithdrawFromJob(jobID, c.Request().Header.Get(HeaderRequesterToken))
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Job %s not found", jobID)})
+	case errors.Is(err, jobs.ErrJobStillRequested):
+		// Only this request is withdrawn; the shared job keeps running for the
+		// other requesters of the same clip.
+		c.Logger().Infof("Job %s was withdrawn from by one of its requesters", jobID)
+		return c.JSON(http.StatusAccepted, map[string]string{"id": jobID, "status": jobStatusDetached})
+	case errors.Is(err, jobs.ErrRequesterNotFound):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("Job %s is shared; its cancellation needs the %s of a request that did not withdraw yet", jobID, HeaderRequesterToken)})
+	case errors.Is(err, jobs.ErrJobNotCancellable):
+		return c.JSON(http.StatusConflict, map[string]string{"error": fmt.Sprintf("Job %s is already finished", jobID)})
+	case err != nil:
+		c.Logger().Errorf("Could not cancel job %s: %s", jobID, err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not cancel job"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"id": jobID, "status": string(jobs.StatusCancelled)})
+}
+
+// StreamJobEvents streams every state transition and progress update of a job
+// as Server-Sent Events until the job is finished or the client disconnects.
+func StreamJobEvents(c echo.Context) error {
+	jobID := c.Param("id")
+
+	// Subscribe before reading the job, so no transition in between is lost.
+	events, unsubscribe := jobs.Subscribe(jobID)
+	defer unsubscribe()
+
+	job, exists := jobs.GetJobById(jobID)
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Job %s not found", jobID)})
+	}
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(jobEventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	if err := writeJobEvent(response, job); err != nil {
+		c.Logger().Errorf("Could not write event for job %s: %s", jobID, err.Error())
+		return nil
+	}
+
+	for !job.Status.IsFinished() {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		case next := <-events:
+			job = &next
+			if err := writeJobEvent(response, job); err != nil {
+				c.Logger().Errorf("Could not write event for job %s: %s", jobID, err.Error())
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeJobEvent(response *echo.Response, job *jobs.Job) error {
+	data, err := json.Marshal(newJobStatusDTO(job))
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(response, "event: job\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	response.Flush()
+	return nil
+}
+
+func newJobStatusDTO(job *jobs.Job) JobStatusDTO {
+	status := JobStatusDTO{
+		ID:            job.ID,
+		Status:        job.Status,
+		Progress:      job.Progress,
+		QueuePosition: job.QueuePosition,
+		Request:       job.Request,
+		ParentJobID:   job.ParentJobID,
+		ChildJobIDs:   job.ChildJobIDs,
+		CreatedAt:     timeOrNil(job.CreatedAt),
+		StartedAt:     timeOrNil(job.StartedAt),
+		CompletedAt:   timeOrNil(job.CompletedAt),
+	}
+
+	if len(job.ChildJobIDs) > 0 {
+		counts := jobs.CountChildJobs(job)
+		status.Children = &counts
+	}
+	if job.Status == jobs.StatusError {
+		status.Error = &JobErrorDTO{Code: job.ErrorCode, Message: job.Error}
+	}
+	if job.Status == jobs.StatusCompleted {
+		status.DownloadUrl = "/api/v1/clip?jobId=" + job.ID
+		status.Result = job.Result
+	}
+
+	return status
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"ytclipper-go/jobs"
+)
+
+func TestNewJobStatusDTOCompleted(t *testing.T) {
+	job := &jobs.Job{
+		ID:          "job-1",
+		Status:      jobs.StatusCompleted,
+		Request:     jobs.JobRequest{Url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", From: "00:00:10", To: "00:00:20", Format: "136"},
+		FilePath:    "/app/videos/job-1.mp4",
+		CreatedAt:   time.Now(),
+		CompletedAt: time.Now(),
+	}
+
+	status := newJobStatusDTO(job)
+
+	if status.DownloadUrl != "/api/v1/clip?jobId=job-1" {
+		t.Errorf("Expected download URL, got %q", status.DownloadUrl)
+	}
+	if status.Request.Format != "136" {
+		t.Errorf("Expected request parameters to be included, got %+v", status.Request)
+	}
+	if status.StartedAt != nil {
+		t.Errorf("Expected unset timestamps to be omitted, got %v", status.StartedAt)
+	}
+
+	data, _ := json.Marshal(status)
+	if strings.Contains(string(data), job.FilePath) {
+		t.Errorf("Expected the server file path not to be exposed, got %s", data)
+	}
+}
+
+func TestNewJobStatusDTOError(t *testing.T) {
+	job := &jobs.Job{
+		ID:        "job-1",
+		Status:    jobs.StatusError,
+		ErrorCode: jobs.ErrorCodeProcessingFailed,
+		Error:     "Failed to download video",
+	}
+
+	status := newJobStatusDTO(job)
+
+	if status.Error == nil || status.Error.Code != jobs.ErrorCodeProcessingFailed || status.Error.Message != job.Error {
+		t.Errorf("Expected error code and message, got %+v", status.Error)
+	}
+	if status.DownloadUrl != "" {
+		t.Errorf("Did not expect a download URL for a failed job, got %q", status.DownloadUrl)
+	}
+}
+
+func TestNewJobStatusDTOCountsChildren(t *testing.T) {
+	originalStore := jobs.Store
+	jobs.Store = jobs.NewMemoryJobStore()
+	defer func() { jobs.Store = originalStore }()
+
+	parent, children := jobs.NewParentJob(jobs.JobRequest{Batch: true}, []jobs.JobRequest{{From: "00:00:00"}, {From: "00:00:10"}})
+	jobs.CompleteJob(children[0].ID, "videos/child.mp4")
+
+	status := newJobStatusDTO(parent)
+	if status.Children == nil || status.Children.Total != 2 || status.Children.Completed != 1 || status.Children.Queued != 1 {
+		t.Errorf("Expected child counts, got %+v", status.Children)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"ytclipper-go/jobs"
+	"ytclipper-go/videoprocessing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PresetDTO describes a preset to the UI. The yt-dlp format selector stays an
+// implementation detail of the server.
+type PresetDTO struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Container   string           `json:"container,omitempty"`
+	Output      *jobs.ClipOutput `json:"output,omitempty"`
+}
+
+func newPresetDTO(preset videoprocessing.Preset) PresetDTO {
+	return PresetDTO{
+		ID:          preset.ID,
+		Name:        preset.Name,
+		Description: preset.Description,
+		Container:   preset.Container,
+		Output:      preset.Output,
+	}
+}
+
+func GetPresets(c echo.Context) error {
+	presets := videoprocessing.GetPresets()
+	presetDTOs := make([]PresetDTO, 0, len(presets))
+	for _, preset := range presets {
+		presetDTOs = append(presetDTOs, newPresetDTO(preset))
+	}
+
+	return c.JSON(http.StatusOK, presetDTOs)
+}
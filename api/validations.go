@@ -1,17 +1,51 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
 	"regexp"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+	"ytclipper-go/utils"
+	"ytclipper-go/videoprocessing"
 )
 
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeInvalidRange         = "invalid_range"
+	ErrorCodeClipTooShort         = "clip_too_short"
+	ErrorCodeClipTooLong          = "clip_too_long"
+	ErrorCodeRangeExceedsDuration = "range_exceeds_duration"
+	ErrorCodePresetNotFound       = "preset_not_found"
+)
+
+// invalidTimeFormatMessage is the error of every timestamp that is not in one
+// of the formats isValidTimeFormat accepts.
+const invalidTimeFormatMessage = "Invalid time format. Use HH:MM:SS, HH:MM:SS.mmm or seconds."
+
+// validationError is a clip request that is well-formed but cannot be served,
+// answered with its own status and error code.
+type validationError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
 func isValidYoutubeUrl(url string) bool {
 	regex := regexp.MustCompile(`http(?:s?):\/\/(?:www\.)?youtu(?:be\.com\/watch\?v=|\.be\/)([\w\-\_]*)(&(amp;)?‌​[\w\?‌​=]*)?`)
 	return regex.MatchString(url)
 }
 
+// isValidTimeFormat accepts HH:MM:SS and plain seconds, both with up to
+// millisecond precision (00:01:02.500, 62.5).
 func isValidTimeFormat(time string) bool {
-	regex := regexp.MustCompile(`^(?:[0-1]?[0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9]$`)
+	regex := regexp.MustCompile(`^(?:(?:[0-1]?[0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9]|\d+)(?:\.\d{1,3})?$`)
 	return regex.MatchString(time)
 }
 
@@ -25,13 +59,171 @@ func validateCreateClipDto(createClipDto *CreateClipDTO) error {
 		return fmt.Errorf("Invalid YouTube URL")
 	}
 
-	if !isValidTimeFormat(createClipDto.From) || !isValidTimeFormat(createClipDto.To) {
-		return fmt.Errorf("Invalid time format. Use HH:MM:SS.")
+	if len(createClipDto.Segments) > 0 {
+		if createClipDto.From != "" || createClipDto.To != "" || createClipDto.AllChapters || createClipDto.selectsChapter() {
+			return fmt.Errorf("Use either from and to, segments or a chapter.")
+		}
+		if len(createClipDto.Segments) > videoprocessing.MaxSegments {
+			return fmt.Errorf("Clips can be joined from at most %d segments.", videoprocessing.MaxSegments)
+		}
+		for _, segment := range createClipDto.Segments {
+			if !isValidTimeFormat(segment.From) || !isValidTimeFormat(segment.To) {
+				return errors.New(invalidTimeFormatMessage)
+			}
+		}
+	} else if createClipDto.CrossfadeInSeconds != 0 {
+		return fmt.Errorf("The crossfadeInSeconds option only applies to segments.")
+	} else if createClipDto.AllChapters || createClipDto.selectsChapter() {
+		if createClipDto.From != "" || createClipDto.To != "" {
+			return fmt.Errorf("Use either from and to or a chapter, not both.")
+		}
+		if createClipDto.AllChapters && createClipDto.selectsChapter() {
+			return fmt.Errorf("Use either a single chapter or all chapters, not both.")
+		}
+		if createClipDto.ChapterIndex != nil && createClipDto.ChapterTitle != "" {
+			return fmt.Errorf("Use either the chapter index or the chapter title, not both.")
+		}
+	} else if !isValidTimeFormat(createClipDto.From) || !isValidTimeFormat(createClipDto.To) {
+		return errors.New(invalidTimeFormatMessage)
 	}
 
-	if !isValidFormat(createClipDto.Format) {
+	output := createClipDto.Output
+	if createClipDto.Preset != "" {
+		if createClipDto.Format != "" || createClipDto.Output != nil || createClipDto.NoAudio {
+			return fmt.Errorf("Use either a preset or format and output, not both.")
+		}
+		preset, exists := videoprocessing.GetPreset(createClipDto.Preset)
+		if !exists {
+			return &validationError{
+				status:  http.StatusBadRequest,
+				code:    ErrorCodePresetNotFound,
+				message: fmt.Sprintf("Unknown preset %q.", createClipDto.Preset),
+			}
+		}
+		output = preset.Output
+	} else if !isValidFormat(createClipDto.Format) {
 		return fmt.Errorf("Invalid format. Must be a numeric value.")
 	}
 
+	if createClipDto.Output != nil {
+		if err := videoprocessing.ValidateClipOutput(*createClipDto.Output); err != nil {
+			return err
+		}
+	}
+
+	if createClipDto.Subtitles != nil {
+		if err := videoprocessing.ValidateClipSubtitles(*createClipDto.Subtitles, output); err != nil {
+			return err
+		}
+	}
+
+	if len(createClipDto.Segments) > 0 {
+		return validateSegments(createClipDto.Segments, createClipDto.CrossfadeInSeconds)
+	}
+	if createClipDto.From != "" || createClipDto.To != "" {
+		return validateClipRange(createClipDto.From, createClipDto.To)
+	}
+
+	return nil
+}
+
+// validateSegments checks the range of each segment and that the clip joined
+// from them is within the clip length limits. A crossfade has to be shorter
+// than every segment.
+func validateSegments(segments []jobs.ClipSegment, crossfadeInSeconds float64) error {
+	if crossfadeInSeconds < 0 || crossfadeInSeconds > videoprocessing.MaxCrossfadeInSeconds {
+		return fmt.Errorf("Invalid crossfade. Use 0 to %d seconds.", videoprocessing.MaxCrossfadeInSeconds)
+	}
+
+	for i, segment := range segments {
+		fromInSeconds, err := utils.ToSeconds(segment.From)
+		if err != nil {
+			return errors.New(invalidTimeFormatMessage)
+		}
+		toInSeconds, err := utils.ToSeconds(segment.To)
+		if err != nil {
+			return errors.New(invalidTimeFormatMessage)
+		}
+
+		if fromInSeconds >= toInSeconds {
+			return &validationError{
+				status:  http.StatusBadRequest,
+				code:    ErrorCodeInvalidRange,
+				message: fmt.Sprintf("The start of segment %d must be before its end.", i+1),
+			}
+		}
+		if len(segments) > 1 && crossfadeInSeconds >= toInSeconds-fromInSeconds {
+			return fmt.Errorf("The crossfade must be shorter than every segment.")
+		}
+	}
+
+	return validateClipLength(videoprocessing.SegmentsLengthInSeconds(segments, crossfadeInSeconds))
+}
+
+// validateClipRange checks that from is before to and that the clip length is
+// within YTCLIPPER_CLIP_MIN_LENGTH_IN_SECONDS and YTCLIPPER_CLIP_MAX_LENGTH_IN_SECONDS.
+func validateClipRange(from string, to string) error {
+	fromInSeconds, err := utils.ToSeconds(from)
+	if err != nil {
+		return errors.New(invalidTimeFormatMessage)
+	}
+	toInSeconds, err := utils.ToSeconds(to)
+	if err != nil {
+		return errors.New(invalidTimeFormatMessage)
+	}
+
+	if fromInSeconds >= toInSeconds {
+		return &validationError{
+			status:  http.StatusBadRequest,
+			code:    ErrorCodeInvalidRange,
+			message: "The start of the clip must be before its end.",
+		}
+	}
+
+	return validateClipLength(toInSeconds - fromInSeconds)
+}
+
+// validateClipLength checks that the clip length is within
+// YTCLIPPER_CLIP_MIN_LENGTH_IN_SECONDS and YTCLIPPER_CLIP_MAX_LENGTH_IN_SECONDS.
+func validateClipLength(length float64) error {
+	minLength := config.CONFIG.ClipConfig.MinLengthInSeconds
+	if length < float64(minLength) {
+		return &validationError{
+			status:  http.StatusUnprocessableEntity,
+			code:    ErrorCodeClipTooShort,
+			message: fmt.Sprintf("Clips must be at least %d seconds long.", minLength),
+		}
+	}
+
+	maxLength := config.CONFIG.ClipConfig.MaxLengthInSeconds
+	if maxLength > 0 && length > float64(maxLength) {
+		return &validationError{
+			status:  http.StatusUnprocessableEntity,
+			code:    ErrorCodeClipTooLong,
+			message: fmt.Sprintf("Clips can be at most %s long.", utils.FormatSeconds(float64(maxLength))),
+		}
+	}
+
+	return nil
+}
+
+// validateClipWithinVideo checks that the clip ends within the video. Videos
+// without a known duration, such as live streams, are not checked.
+func validateClipWithinVideo(to string, durationInSeconds float64) error {
+	toInSeconds, err := utils.ToSeconds(to)
+	if err != nil {
+		return errors.New(invalidTimeFormatMessage)
+	}
+
+	// yt-dlp reports fractional durations while the UI shows whole seconds, so
+	// an end rounded up to the next second is still accepted.
+	if durationInSeconds > 0 && toInSeconds > math.Ceil(durationInSeconds) {
+		return &validationError{
+			status:  http.StatusUnprocessableEntity,
+			code:    ErrorCodeRangeExceedsDuration,
+			message: fmt.Sprintf("The clip ends after the end of the video (%s).", utils.FormatSeconds(math.Floor(durationInSeconds))),
+		}
+	}
+
 	return nil
 }
@@ -1,7 +1,11 @@
 package api
 
 import (
+	"errors"
+	"net/http"
 	"testing"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
 )
 
 func TestIsValidYoutubeUrl(t *testing.T) {
@@ -42,6 +46,13 @@ func TestIsValidTimeFormat(t *testing.T) {
 		{"1:2:3", false},    // Missing leading zeros
 		{"invalid", false},  // Completely invalid input
 		{"12:34", false},    // Missing seconds
+		{"00:01:02.5", true},
+		{"00:01:02.500", true},
+		{"62.25", true},
+		{"62", true},
+		{"00:01:02.5000", false}, // More than millisecond precision
+		{"00:01:02.", false},     // Missing fraction
+		{"-5", false},            // Negative seconds
 	}
 
 	for _, tt := range tests {
@@ -113,7 +124,7 @@ func TestValidateCreateClipDto(t *testing.T) {
 	}{
 		{"Valid DTO", validDto, false, ""},
 		{"Invalid URL", invalidUrlDto, true, "Invalid YouTube URL"},
-		{"Invalid Time", invalidTimeDto, true, "Invalid time format. Use HH:MM:SS."},
+		{"Invalid Time", invalidTimeDto, true, invalidTimeFormatMessage},
 		{"Invalid Format", invalidFormatDto, true, "Invalid format. Must be a numeric value."},
 	}
 
@@ -129,3 +140,239 @@ func TestValidateCreateClipDto(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateCreateClipDtoChapters(t *testing.T) {
+	chapterIndex := 2
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+
+	tests := []struct {
+		name        string
+		dto         *CreateClipDTO
+		expectedMsg string
+	}{
+		{"Chapter index", &CreateClipDTO{Url: url, Format: "399", ChapterIndex: &chapterIndex}, ""},
+		{"Chapter title", &CreateClipDTO{Url: url, Format: "399", ChapterTitle: "Intro"}, ""},
+		{"All chapters", &CreateClipDTO{Url: url, Format: "399", AllChapters: true}, ""},
+		{"Chapter and time range", &CreateClipDTO{Url: url, Format: "399", From: "00:00:10", ChapterTitle: "Intro"}, "Use either from and to or a chapter, not both."},
+		{"Chapter and all chapters", &CreateClipDTO{Url: url, Format: "399", AllChapters: true, ChapterIndex: &chapterIndex}, "Use either a single chapter or all chapters, not both."},
+		{"Chapter index and title", &CreateClipDTO{Url: url, Format: "399", ChapterIndex: &chapterIndex, ChapterTitle: "Intro"}, "Use either the chapter index or the chapter title, not both."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationMessage(t, validateCreateClipDto(tt.dto), tt.expectedMsg)
+		})
+	}
+}
+
+func TestValidateClipRange(t *testing.T) {
+	originalClipConfig := config.CONFIG.ClipConfig
+	config.CONFIG.ClipConfig = config.ClipConfig{MinLengthInSeconds: 1, MaxLengthInSeconds: 600}
+	defer func() { config.CONFIG.ClipConfig = originalClipConfig }()
+
+	tests := []struct {
+		name         string
+		from         string
+		to           string
+		expectedCode string
+		expectedHTTP int
+	}{
+		{"Valid range", "00:00:10", "00:00:20.5", "", 0},
+		{"From after to", "00:00:20", "00:00:10", ErrorCodeInvalidRange, http.StatusBadRequest},
+		{"Zero length", "00:00:10", "10", ErrorCodeInvalidRange, http.StatusBadRequest},
+		{"Too short", "00:00:10", "00:00:10.500", ErrorCodeClipTooShort, http.StatusUnprocessableEntity},
+		{"Too long", "00:00:00", "00:10:00.001", ErrorCodeClipTooLong, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationError(t, validateClipRange(tt.from, tt.to), tt.expectedCode, tt.expectedHTTP)
+		})
+	}
+}
+
+func TestValidateClipWithinVideo(t *testing.T) {
+	tests := []struct {
+		name         string
+		to           string
+		duration     float64
+		expectedCode string
+	}{
+		{"Within video", "00:03:00", 212.4, ""},
+		{"Rounded up end", "00:03:33", 212.4, ""},
+		{"Past the end", "00:03:34", 212.4, ErrorCodeRangeExceedsDuration},
+		{"Unknown duration", "10:00:00", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationError(t, validateClipWithinVideo(tt.to, tt.duration), tt.expectedCode, http.StatusUnprocessableEntity)
+		})
+	}
+}
+
+// assertValidationMessage checks the message of a validation error, or that
+// there is no error if expectedMsg is empty.
+func assertValidationMessage(t *testing.T, err error, expectedMsg string) {
+	t.Helper()
+
+	if expectedMsg == "" {
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		return
+	}
+	if err == nil || err.Error() != expectedMsg {
+		t.Errorf("Expected error message %q, got %v", expectedMsg, err)
+	}
+}
+
+func assertValidationError(t *testing.T, err error, expectedCode string, expectedStatus int) {
+	t.Helper()
+
+	if expectedCode == "" {
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		return
+	}
+
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a validation error with code %s, got %v", expectedCode, err)
+	}
+	if validationErr.code != expectedCode || validationErr.status != expectedStatus {
+		t.Errorf("Expected %d %s, got %d %s", expectedStatus, expectedCode, validationErr.status, validationErr.code)
+	}
+}
+
+func TestValidateCreateClipDtoOutput(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+
+	tests := []struct {
+		name        string
+		output      *jobs.ClipOutput
+		expectedMsg string
+	}{
+		{"No output", nil, ""},
+		{"MP3 with default bitrate", &jobs.ClipOutput{Format: "mp3"}, ""},
+		{"Opus with bitrate", &jobs.ClipOutput{Format: "opus", Bitrate: 96}, ""},
+		{"FLAC", &jobs.ClipOutput{Format: "flac"}, ""},
+		{"Unknown format", &jobs.ClipOutput{Format: "aac"}, "Invalid output format. Use mp3, opus, flac, wav, gif, webp or mp4."},
+		{"MP3 bitrate too high", &jobs.ClipOutput{Format: "mp3", Bitrate: 512}, "Invalid bitrate. MP3 supports 32 to 320 kbit/s."},
+		{"Lossless with bitrate", &jobs.ClipOutput{Format: "wav", Bitrate: 320}, "WAV is lossless and does not take a bitrate."},
+		{"Audio with fps", &jobs.ClipOutput{Format: "mp3", FPS: 10}, "The fps, width and loop options only apply to gif and webp."},
+		{"GIF", &jobs.ClipOutput{Format: "gif", FPS: 12, Width: 320, Loop: 3}, ""},
+		{"WebP with defaults", &jobs.ClipOutput{Format: "webp"}, ""},
+		{"GIF with bitrate", &jobs.ClipOutput{Format: "gif", Bitrate: 128}, "The bitrate option only applies to audio outputs."},
+		{"GIF fps too high", &jobs.ClipOutput{Format: "gif", FPS: 60}, "Invalid fps. Animations support 1 to 30 frames per second."},
+		{"GIF too wide", &jobs.ClipOutput{Format: "gif", Width: 1920}, "Invalid width. Animations can be 16 to 1280 pixels wide."},
+		{"Negative loop", &jobs.ClipOutput{Format: "webp", Loop: -1}, "Invalid loop. Use 0 to loop forever or the number of times to play the animation."},
+		{"MP4 with target size", &jobs.ClipOutput{Format: "mp4", TargetSizeInMb: 25}, ""},
+		{"MP4 target size above the clip size limit", &jobs.ClipOutput{Format: "mp4", TargetSizeInMb: 301}, "Invalid target size. Use 1 to 300 MB."},
+		{"MP4 with fps", &jobs.ClipOutput{Format: "mp4", FPS: 10}, "The fps, width and loop options only apply to gif and webp."},
+		{"Target size for audio", &jobs.ClipOutput{Format: "mp3", TargetSizeInMb: 8}, "The targetSizeInMb, videoBitrate, maxHeight, aspectRatio, cropMode and cropOffset options only apply to mp4."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dto := &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Format: "140", Output: tt.output}
+			assertValidationMessage(t, validateCreateClipDto(dto), tt.expectedMsg)
+		})
+	}
+}
+
+func TestValidateCreateClipDtoPreset(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+
+	tests := []struct {
+		name        string
+		dto         *CreateClipDTO
+		expectedMsg string
+	}{
+		{"Preset without format", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Preset: "discord-720p"}, ""},
+		{"Preset with format", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Preset: "discord-720p", Format: "22"}, "Use either a preset or format and output, not both."},
+		{"Preset with output", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Preset: "podcast-mp3", Output: &jobs.ClipOutput{Format: "flac"}}, "Use either a preset or format and output, not both."},
+		{"Unknown preset", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Preset: "tiktok"}, `Unknown preset "tiktok".`},
+		{"Neither preset nor format", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20"}, "Invalid format. Must be a numeric value."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationMessage(t, validateCreateClipDto(tt.dto), tt.expectedMsg)
+		})
+	}
+}
+
+func TestValidateCreateClipDtoSubtitles(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	burn := &jobs.ClipSubtitles{Language: "en", Mode: "burn"}
+
+	tests := []struct {
+		name        string
+		dto         *CreateClipDTO
+		expectedMsg string
+	}{
+		{"Burn into the downloaded format", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Format: "22", Subtitles: burn}, ""},
+		{"Burn into a video preset", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Preset: "discord-720p", Subtitles: burn}, ""},
+		{"Burn into an audio preset", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Preset: "podcast-mp3", Subtitles: burn}, "MP3 outputs only support sidecar subtitles."},
+		{"Invalid mode", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Format: "22", Subtitles: &jobs.ClipSubtitles{Language: "en"}}, "Invalid subtitle mode. Use sidecar, soft or burn."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationMessage(t, validateCreateClipDto(tt.dto), tt.expectedMsg)
+		})
+	}
+}
+
+func TestValidateCreateClipDtoSegments(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	segments := []jobs.ClipSegment{{From: "00:00:10", To: "00:00:25"}, {From: "00:03:40", To: "00:03:55"}}
+
+	tests := []struct {
+		name        string
+		dto         *CreateClipDTO
+		expectedMsg string
+	}{
+		{"Segments", &CreateClipDTO{Url: url, Segments: segments, Format: "22"}, ""},
+		{"Segments with a crossfade", &CreateClipDTO{Url: url, Segments: segments, CrossfadeInSeconds: 1.5, Format: "22"}, ""},
+		{"Segments and a range", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", Segments: segments, Format: "22"}, "Use either from and to, segments or a chapter."},
+		{"Segments and a chapter", &CreateClipDTO{Url: url, Segments: segments, AllChapters: true, Format: "22"}, "Use either from and to, segments or a chapter."},
+		{"Invalid segment time", &CreateClipDTO{Url: url, Segments: []jobs.ClipSegment{{From: "10", To: "abc"}}, Format: "22"}, invalidTimeFormatMessage},
+		{"Crossfade without segments", &CreateClipDTO{Url: url, From: "00:00:10", To: "00:00:20", CrossfadeInSeconds: 1, Format: "22"}, "The crossfadeInSeconds option only applies to segments."},
+		{"Crossfade too long", &CreateClipDTO{Url: url, Segments: segments, CrossfadeInSeconds: 6, Format: "22"}, "Invalid crossfade. Use 0 to 5 seconds."},
+		{"Crossfade longer than a segment", &CreateClipDTO{Url: url, Segments: []jobs.ClipSegment{{From: "10", To: "12"}, {From: "30", To: "40"}}, CrossfadeInSeconds: 3, Format: "22"}, "The crossfade must be shorter than every segment."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationMessage(t, validateCreateClipDto(tt.dto), tt.expectedMsg)
+		})
+	}
+}
+
+func TestValidateSegments(t *testing.T) {
+	originalClipConfig := config.CONFIG.ClipConfig
+	config.CONFIG.ClipConfig = config.ClipConfig{MinLengthInSeconds: 1, MaxLengthInSeconds: 60}
+	defer func() { config.CONFIG.ClipConfig = originalClipConfig }()
+
+	tests := []struct {
+		name         string
+		segments     []jobs.ClipSegment
+		crossfade    float64
+		expectedCode string
+		expectedHTTP int
+	}{
+		{"Valid segments", []jobs.ClipSegment{{From: "10", To: "40"}, {From: "100", To: "130"}}, 0, "", 0},
+		{"Crossfades shorten the clip", []jobs.ClipSegment{{From: "10", To: "41"}, {From: "100", To: "131"}}, 2, "", 0},
+		{"Segment end before start", []jobs.ClipSegment{{From: "10", To: "20"}, {From: "40", To: "30"}}, 0, ErrorCodeInvalidRange, http.StatusBadRequest},
+		{"Joined clip too long", []jobs.ClipSegment{{From: "10", To: "41"}, {From: "100", To: "131"}}, 0, ErrorCodeClipTooLong, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationError(t, validateSegments(tt.segments, tt.crossfade), tt.expectedCode, tt.expectedHTTP)
+		})
+	}
+}
@@ -1,14 +1,119 @@
 package api
 
 import (
+	"errors"
 	"net/http"
-	"ytclipper-go/utils"
+	"time"
 	"ytclipper-go/videoprocessing"
 
 	"github.com/labstack/echo/v4"
 )
 
-func GetVideoDuration(c echo.Context) error {
+type FormatDTO struct {
+	ID         string  `json:"id"`
+	Extension  string  `json:"extension"`
+	FormatType string  `json:"formatType"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Fps        float64 `json:"fps,omitempty"`
+	VideoCodec string  `json:"vcodec"`
+	AudioCodec string  `json:"acodec"`
+	Bitrate    float64 `json:"tbr,omitempty"`
+	Filesize   int64   `json:"filesize,omitempty"`
+	Protocol   string  `json:"protocol,omitempty"`
+	Note       string  `json:"note,omitempty"`
+}
+
+func newFormatDTO(format videoprocessing.Format) FormatDTO {
+	filesize := format.Filesize
+	if filesize == 0 {
+		filesize = format.FilesizeApprox
+	}
+
+	return FormatDTO{
+		ID:         format.ID,
+		Extension:  format.Ext,
+		FormatType: format.FormatType(),
+		Width:      format.Width,
+		Height:     format.Height,
+		Fps:        format.Fps,
+		VideoCodec: format.VCodec,
+		AudioCodec: format.ACodec,
+		Bitrate:    format.Tbr,
+		Filesize:   filesize,
+		Protocol:   format.Protocol,
+		Note:       format.Note,
+	}
+}
+
+type VideoInfoDTO struct {
+	ID                        string         `json:"id"`
+	Title                     string         `json:"title"`
+	Channel                   string         `json:"channel"`
+	UploadDate                string         `json:"uploadDate,omitempty"`
+	DurationInSeconds         float64        `json:"duration"`
+	Thumbnail                 string         `json:"thumbnail,omitempty"`
+	Thumbnails                []ThumbnailDTO `json:"thumbnails"`
+	Chapters                  []ChapterDTO   `json:"chapters"`
+	SubtitleLanguages         []string       `json:"subtitleLanguages"`
+	AutomaticCaptionLanguages []string       `json:"automaticCaptionLanguages"`
+	IsLive                    bool           `json:"isLive"`
+	AgeLimit                  int            `json:"ageLimit"`
+}
+
+type ThumbnailDTO struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+type ChapterDTO struct {
+	Index     int     `json:"index"`
+	Title     string  `json:"title"`
+	StartTime float64 `json:"startTime"`
+	EndTime   float64 `json:"endTime"`
+}
+
+func newVideoInfoDTO(info *videoprocessing.VideoInfo) VideoInfoDTO {
+	thumbnails := make([]ThumbnailDTO, 0, len(info.Thumbnails))
+	for _, thumbnail := range info.Thumbnails {
+		if thumbnail.URL == "" {
+			continue
+		}
+		thumbnails = append(thumbnails, ThumbnailDTO{URL: thumbnail.URL, Width: thumbnail.Width, Height: thumbnail.Height})
+	}
+
+	chapters := make([]ChapterDTO, 0, len(info.Chapters))
+	for i, chapter := range info.Chapters {
+		chapters = append(chapters, ChapterDTO{Index: i, Title: chapter.Title, StartTime: chapter.StartTime, EndTime: chapter.EndTime})
+	}
+
+	return VideoInfoDTO{
+		ID:                        info.ID,
+		Title:                     info.Title,
+		Channel:                   info.ChannelName(),
+		UploadDate:                formatUploadDate(info.UploadDate),
+		DurationInSeconds:         info.Duration,
+		Thumbnail:                 info.Thumbnail,
+		Thumbnails:                thumbnails,
+		Chapters:                  chapters,
+		SubtitleLanguages:         info.SubtitleLanguages(),
+		AutomaticCaptionLanguages: info.AutomaticCaptionLanguages(),
+		IsLive:                    info.IsLive || info.LiveStatus == "is_live" || info.LiveStatus == "is_upcoming",
+		AgeLimit:                  info.AgeLimit,
+	}
+}
+
+// formatUploadDate turns yt-dlp's YYYYMMDD upload date into YYYY-MM-DD.
+func formatUploadDate(uploadDate string) string {
+	date, err := time.Parse("20060102", uploadDate)
+	if err != nil {
+		return uploadDate
+	}
+	return date.Format(time.DateOnly)
+}
+
+func GetVideoInfo(c echo.Context) error {
 	url := c.QueryParam("youtubeUrl")
 	if url == "" {
 		c.Logger().Errorf("Url is required")
@@ -20,29 +125,39 @@ func GetVideoDuration(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid YouTube URL"})
 	}
 
-	duration, err := videoprocessing.GetVideoDuration(url)
+	info, err := videoprocessing.GetVideoInfo(c.Request().Context(), url)
 	if err != nil {
+		return videoProcessingError(c, err, "Failed to fetch video info")
+	}
 
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to get video duration",
-		})
+	return c.JSON(http.StatusOK, newVideoInfoDTO(info))
+}
+
+func GetVideoDuration(c echo.Context) error {
+	url := c.QueryParam("youtubeUrl")
+	if url == "" {
+		c.Logger().Errorf("Url is required")
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "URL is required"})
 	}
 
-	if duration == "" {
-		c.Logger().Error("Could not extract duration from yt-dlp output")
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Could not extract duration from yt-dlp output",
-		})
+	if !isValidYoutubeUrl(url) {
+		c.Logger().Errorf("Invalid Youtube URL: %s", url)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid YouTube URL"})
 	}
 
-	totalSeconds, err := utils.ToSeconds(duration)
+	duration, err := videoprocessing.GetVideoDuration(c.Request().Context(), url)
 	if err != nil {
-		c.Logger().Error("Could not calculate total seconds")
+		return videoProcessingError(c, err, "Failed to get video duration")
+	}
+
+	if duration <= 0 {
+		c.Logger().Error("yt-dlp did not report a duration")
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Could not calculate total seconds",
+			"error": "Could not extract duration from yt-dlp output",
 		})
 	}
 
+	totalSeconds := int(duration)
 	return c.JSON(http.StatusOK, totalSeconds)
 }
 
@@ -58,12 +173,42 @@ func GetAvailableFormats(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid YouTube URL"})
 	}
 
-	formats, err := videoprocessing.GetAvailableFormats(url)
+	formats, err := videoprocessing.GetAvailableFormats(c.Request().Context(), url)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to fetch formats",
-		})
+		return videoProcessingError(c, err, "Failed to fetch formats")
 	}
 
-	return c.JSON(http.StatusOK, formats)
+	formatDtos := make([]FormatDTO, 0, len(formats))
+	for _, format := range formats {
+		formatDtos = append(formatDtos, newFormatDTO(format))
+	}
+
+	return c.JSON(http.StatusOK, formatDtos)
+}
+
+// videoProcessingError answers with the error code and user-facing message of
+// a classified yt-dlp failure, or with the fallback message otherwise.
+func videoProcessingError(c echo.Context, err error, fallbackMessage string) error {
+	var processingErr *videoprocessing.ProcessingError
+	if !errors.As(err, &processingErr) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fallbackMessage})
+	}
+
+	return c.JSON(statusForErrorCode(processingErr.Code), map[string]string{
+		"error": processingErr.Message,
+		"code":  processingErr.Code,
+	})
+}
+
+func statusForErrorCode(code string) int {
+	switch code {
+	case videoprocessing.ErrorCodeTimeout:
+		return http.StatusGatewayTimeout
+	case videoprocessing.ErrorCodeRateLimited:
+		return http.StatusServiceUnavailable
+	case videoprocessing.ErrorCodeDownloadFailed:
+		return http.StatusBadGateway
+	default:
+		return http.StatusUnprocessableEntity
+	}
 }
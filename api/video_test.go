@@ -0,0 +1,59 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"ytclipper-go/videoprocessing"
+)
+
+func TestNewVideoInfoDTO(t *testing.T) {
+	info := &videoprocessing.VideoInfo{
+		ID:         "dQw4w9WgXcQ",
+		Title:      "Example Video",
+		Uploader:   "Example Uploader",
+		UploadDate: "20091025",
+		Duration:   212,
+		Thumbnails: []videoprocessing.Thumbnail{
+			{URL: "https://i.ytimg.com/vi/dQw4w9WgXcQ/default.jpg", Width: 120, Height: 90},
+			{ID: "missing"},
+		},
+		Chapters: []videoprocessing.Chapter{
+			{Title: "Intro", StartTime: 0, EndTime: 30},
+			{Title: "Chorus", StartTime: 30, EndTime: 212},
+		},
+		Subtitles: map[string][]videoprocessing.SubtitleTrack{
+			"en":        {{Ext: "vtt"}},
+			"de":        {{Ext: "vtt"}},
+			"live_chat": {{Ext: "json"}},
+		},
+		LiveStatus: "is_upcoming",
+		AgeLimit:   18,
+	}
+
+	dto := newVideoInfoDTO(info)
+
+	if dto.Channel != "Example Uploader" {
+		t.Errorf("Expected uploader as channel fallback, got %q", dto.Channel)
+	}
+	if dto.UploadDate != "2009-10-25" {
+		t.Errorf("Expected upload date 2009-10-25, got %q", dto.UploadDate)
+	}
+	if len(dto.Thumbnails) != 1 {
+		t.Errorf("Expected thumbnails without URL to be skipped, got %+v", dto.Thumbnails)
+	}
+	if len(dto.Chapters) != 2 || dto.Chapters[1].Index != 1 || dto.Chapters[1].StartTime != 30 {
+		t.Errorf("Unexpected chapters: %+v", dto.Chapters)
+	}
+	if !reflect.DeepEqual(dto.SubtitleLanguages, []string{"de", "en"}) {
+		t.Errorf("Expected sorted subtitle languages without live chat, got %v", dto.SubtitleLanguages)
+	}
+	if len(dto.AutomaticCaptionLanguages) != 0 {
+		t.Errorf("Expected no automatic captions, got %v", dto.AutomaticCaptionLanguages)
+	}
+	if !dto.IsLive {
+		t.Error("Expected upcoming premieres to be reported as live")
+	}
+	if dto.AgeLimit != 18 {
+		t.Errorf("Expected age limit 18, got %d", dto.AgeLimit)
+	}
+}
@@ -24,6 +24,51 @@ const (
 
 	CONFIG_KEY_AUTH_USERNAME = "YTCLIPPER_AUTH_USERNAME"
 	CONFIG_KEY_AUTH_PASSWORD = "YTCLIPPER_AUTH_PASSWORD"
+
+	CONFIG_KEY_JOB_STORE_TYPE = "YTCLIPPER_JOB_STORE_TYPE"
+	CONFIG_KEY_JOB_STORE_PATH = "YTCLIPPER_JOB_STORE_PATH"
+
+	CONFIG_KEY_JOB_QUEUE_WORKERS                = "YTCLIPPER_JOB_QUEUE_WORKERS"
+	CONFIG_KEY_JOB_QUEUE_MAX_LENGTH             = "YTCLIPPER_JOB_QUEUE_MAX_LENGTH"
+	CONFIG_KEY_JOB_QUEUE_RETRY_AFTER_IN_SECONDS = "YTCLIPPER_JOB_QUEUE_RETRY_AFTER_IN_SECONDS"
+
+	CONFIG_KEY_METADATA_CACHE_TTL_IN_SECONDS = "YTCLIPPER_METADATA_CACHE_TTL_IN_SECONDS"
+
+	CONFIG_KEY_CLIP_MIN_LENGTH_IN_SECONDS = "YTCLIPPER_CLIP_MIN_LENGTH_IN_SECONDS"
+	CONFIG_KEY_CLIP_MAX_LENGTH_IN_SECONDS = "YTCLIPPER_CLIP_MAX_LENGTH_IN_SECONDS"
+
+	CONFIG_KEY_FFMPEG_COMMAND_TIMEOUT_IN_SECONDS = "YTCLIPPER_FFMPEG_COMMAND_TIMEOUT_IN_SECONDS"
+
+	CONFIG_KEY_PRESETS_PATH = "YTCLIPPER_PRESETS_PATH"
+
+	CONFIG_KEY_SOURCE_CACHE_ENABLED                       = "YTCLIPPER_SOURCE_CACHE_ENABLED"
+	CONFIG_KEY_SOURCE_CACHE_PATH                          = "YTCLIPPER_SOURCE_CACHE_PATH"
+	CONFIG_KEY_SOURCE_CACHE_MAX_SIZE_IN_MB                = "YTCLIPPER_SOURCE_CACHE_MAX_SIZE_IN_MB"
+	CONFIG_KEY_SOURCE_CACHE_MAX_VIDEO_DURATION_IN_SECONDS = "YTCLIPPER_SOURCE_CACHE_MAX_VIDEO_DURATION_IN_SECONDS"
+	CONFIG_KEY_SOURCE_CACHE_RETENTION_IN_MINUTES          = "YTCLIPPER_SOURCE_CACHE_RETENTION_IN_MINUTES"
+	CONFIG_KEY_SOURCE_CACHE_DOWNLOAD_TIMEOUT_IN_SECONDS   = "YTCLIPPER_SOURCE_CACHE_DOWNLOAD_TIMEOUT_IN_SECONDS"
+
+	CONFIG_KEY_STORAGE_TYPE                      = "YTCLIPPER_STORAGE_TYPE"
+	CONFIG_KEY_STORAGE_PATH                      = "YTCLIPPER_STORAGE_PATH"
+	CONFIG_KEY_STORAGE_S3_ENDPOINT               = "YTCLIPPER_STORAGE_S3_ENDPOINT"
+	CONFIG_KEY_STORAGE_S3_REGION                 = "YTCLIPPER_STORAGE_S3_REGION"
+	CONFIG_KEY_STORAGE_S3_BUCKET                 = "YTCLIPPER_STORAGE_S3_BUCKET"
+	CONFIG_KEY_STORAGE_S3_PREFIX                 = "YTCLIPPER_STORAGE_S3_PREFIX"
+	CONFIG_KEY_STORAGE_S3_ACCESS_KEY_ID          = "YTCLIPPER_STORAGE_S3_ACCESS_KEY_ID"
+	CONFIG_KEY_STORAGE_S3_SECRET_ACCESS_KEY      = "YTCLIPPER_STORAGE_S3_SECRET_ACCESS_KEY"
+	CONFIG_KEY_STORAGE_S3_USE_SSL                = "YTCLIPPER_STORAGE_S3_USE_SSL"
+	CONFIG_KEY_STORAGE_REDIRECT_DOWNLOADS        = "YTCLIPPER_STORAGE_REDIRECT_DOWNLOADS"
+	CONFIG_KEY_STORAGE_PRESIGN_EXPIRY_IN_MINUTES = "YTCLIPPER_STORAGE_PRESIGN_EXPIRY_IN_MINUTES"
+)
+
+const (
+	JOB_STORE_TYPE_MEMORY = "memory"
+	JOB_STORE_TYPE_BOLT   = "bolt"
+)
+
+const (
+	STORAGE_TYPE_LOCAL = "local"
+	STORAGE_TYPE_S3    = "s3"
 )
 
 var CONFIG *Config = NewConfig()
@@ -35,6 +80,14 @@ type Config struct {
 	YtDlpConfig                YtDlpConfig
 	ClipCleanUpSchedulerConfig ClipCleanUpSchedulerConfig
 	BasicAuthConfig            BasicAuthConfig
+	JobStoreConfig             JobStoreConfig
+	JobQueueConfig             JobQueueConfig
+	MetadataCacheConfig        MetadataCacheConfig
+	ClipConfig                 ClipConfig
+	FFmpegConfig               FFmpegConfig
+	PresetConfig               PresetConfig
+	SourceCacheConfig          SourceCacheConfig
+	StorageConfig              StorageConfig
 }
 
 type RateLimiterConfig struct {
@@ -52,7 +105,6 @@ type YtDlpConfig struct {
 
 type ClipCleanUpSchedulerConfig struct {
 	IntervalInMinutes int
-	ClipDirectoryPath string
 	IsEnabled         bool
 }
 
@@ -61,14 +113,63 @@ type BasicAuthConfig struct {
 	Password string
 }
 
+type JobStoreConfig struct {
+	Type string
+	Path string
+}
+
+type JobQueueConfig struct {
+	Workers             int
+	MaxLength           int
+	RetryAfterInSeconds int
+}
+
+type MetadataCacheConfig struct {
+	TTLInSeconds int
+}
+
+type ClipConfig struct {
+	MinLengthInSeconds int
+	MaxLengthInSeconds int
+}
+
+type FFmpegConfig struct {
+	CommandTimeoutInSeconds int
+}
+
+type PresetConfig struct {
+	Path string
+}
+
+type SourceCacheConfig struct {
+	IsEnabled                 bool
+	Path                      string
+	MaxSizeInMb               int
+	MaxVideoDurationInSeconds int
+	RetentionInMinutes        int
+	DownloadTimeoutInSeconds  int
+}
+
+type StorageConfig struct {
+	Type                   string
+	Path                   string
+	S3Endpoint             string
+	S3Region               string
+	S3Bucket               string
+	S3Prefix               string
+	S3AccessKeyID          string
+	S3SecretAccessKey      string
+	S3UseSSL               bool
+	RedirectDownloads      bool
+	PresignExpiryInMinutes int
+}
+
 func NewClipCleanUpSchedulerConfig() *ClipCleanUpSchedulerConfig {
 	intervalInMinutes := GetEnvInt(CONFIG_KEY_CLIP_CLEANUP_SCHEDULER_INTERVAL_IN_MINUTES, 5)
-	clipDirectoryPath := GetEnv(CONFIG_KEY_CLIP_CLEANUP_SCHEDULER_CLIP_DIRECTORY_PATH, "./videos/")
 	clipSchedulerEnabled := GetEnv(CONFIG_KEY_CLIP_CLEANUP_SCHEDULER_ENABLED, "true") == "true"
 
 	return &ClipCleanUpSchedulerConfig{
 		IntervalInMinutes: intervalInMinutes,
-		ClipDirectoryPath: clipDirectoryPath,
 		IsEnabled:         clipSchedulerEnabled,
 	}
 }
@@ -109,6 +210,109 @@ func NewBasicAuthConfig() *BasicAuthConfig {
 	}
 }
 
+func NewJobStoreConfig() *JobStoreConfig {
+	storeType := GetEnv(CONFIG_KEY_JOB_STORE_TYPE, JOB_STORE_TYPE_MEMORY)
+	path := GetEnv(CONFIG_KEY_JOB_STORE_PATH, "./data/jobs.db")
+
+	return &JobStoreConfig{
+		Type: storeType,
+		Path: path,
+	}
+}
+
+func NewJobQueueConfig() *JobQueueConfig {
+	workers := GetEnvInt(CONFIG_KEY_JOB_QUEUE_WORKERS, 2)
+	maxLength := GetEnvInt(CONFIG_KEY_JOB_QUEUE_MAX_LENGTH, 20)
+	retryAfterInSeconds := GetEnvInt(CONFIG_KEY_JOB_QUEUE_RETRY_AFTER_IN_SECONDS, 30)
+
+	return &JobQueueConfig{
+		Workers:             workers,
+		MaxLength:           maxLength,
+		RetryAfterInSeconds: retryAfterInSeconds,
+	}
+}
+
+func NewMetadataCacheConfig() *MetadataCacheConfig {
+	ttlInSeconds := GetEnvInt(CONFIG_KEY_METADATA_CACHE_TTL_IN_SECONDS, 600)
+
+	return &MetadataCacheConfig{
+		TTLInSeconds: ttlInSeconds,
+	}
+}
+
+func NewClipConfig() *ClipConfig {
+	minLengthInSeconds := GetEnvInt(CONFIG_KEY_CLIP_MIN_LENGTH_IN_SECONDS, 1)
+	maxLengthInSeconds := GetEnvInt(CONFIG_KEY_CLIP_MAX_LENGTH_IN_SECONDS, 3600)
+
+	return &ClipConfig{
+		MinLengthInSeconds: minLengthInSeconds,
+		MaxLengthInSeconds: maxLengthInSeconds,
+	}
+}
+
+func NewFFmpegConfig() *FFmpegConfig {
+	commandTimeoutInSeconds := GetEnvInt(CONFIG_KEY_FFMPEG_COMMAND_TIMEOUT_IN_SECONDS, 300)
+
+	return &FFmpegConfig{
+		CommandTimeoutInSeconds: commandTimeoutInSeconds,
+	}
+}
+
+func NewPresetConfig() *PresetConfig {
+	path := GetEnv(CONFIG_KEY_PRESETS_PATH, "")
+
+	return &PresetConfig{
+		Path: path,
+	}
+}
+
+func NewSourceCacheConfig() *SourceCacheConfig {
+	isEnabled := GetEnv(CONFIG_KEY_SOURCE_CACHE_ENABLED, "false") == "true"
+	path := GetEnv(CONFIG_KEY_SOURCE_CACHE_PATH, "./cache/")
+	maxSizeInMb := GetEnvInt(CONFIG_KEY_SOURCE_CACHE_MAX_SIZE_IN_MB, 5120)
+	maxVideoDurationInSeconds := GetEnvInt(CONFIG_KEY_SOURCE_CACHE_MAX_VIDEO_DURATION_IN_SECONDS, 10800)
+	retentionInMinutes := GetEnvInt(CONFIG_KEY_SOURCE_CACHE_RETENTION_IN_MINUTES, 60)
+	downloadTimeoutInSeconds := GetEnvInt(CONFIG_KEY_SOURCE_CACHE_DOWNLOAD_TIMEOUT_IN_SECONDS, 600)
+
+	return &SourceCacheConfig{
+		IsEnabled:                 isEnabled,
+		Path:                      path,
+		MaxSizeInMb:               maxSizeInMb,
+		MaxVideoDurationInSeconds: maxVideoDurationInSeconds,
+		RetentionInMinutes:        retentionInMinutes,
+		DownloadTimeoutInSeconds:  downloadTimeoutInSeconds,
+	}
+}
+
+func NewStorageConfig() *StorageConfig {
+	storageType := GetEnv(CONFIG_KEY_STORAGE_TYPE, STORAGE_TYPE_LOCAL)
+	// The clip directory used to be configured for the cleanup scheduler only.
+	path := GetEnv(CONFIG_KEY_STORAGE_PATH, GetEnv(CONFIG_KEY_CLIP_CLEANUP_SCHEDULER_CLIP_DIRECTORY_PATH, "./videos/"))
+	s3Endpoint := GetEnv(CONFIG_KEY_STORAGE_S3_ENDPOINT, "s3.amazonaws.com")
+	s3Region := GetEnv(CONFIG_KEY_STORAGE_S3_REGION, "")
+	s3Bucket := GetEnv(CONFIG_KEY_STORAGE_S3_BUCKET, "")
+	s3Prefix := GetEnv(CONFIG_KEY_STORAGE_S3_PREFIX, "")
+	s3AccessKeyID := GetEnv(CONFIG_KEY_STORAGE_S3_ACCESS_KEY_ID, "")
+	s3SecretAccessKey := GetEnv(CONFIG_KEY_STORAGE_S3_SECRET_ACCESS_KEY, "")
+	s3UseSSL := GetEnv(CONFIG_KEY_STORAGE_S3_USE_SSL, "true") == "true"
+	redirectDownloads := GetEnv(CONFIG_KEY_STORAGE_REDIRECT_DOWNLOADS, "true") == "true"
+	presignExpiryInMinutes := GetEnvInt(CONFIG_KEY_STORAGE_PRESIGN_EXPIRY_IN_MINUTES, 15)
+
+	return &StorageConfig{
+		Type:                   storageType,
+		Path:                   path,
+		S3Endpoint:             s3Endpoint,
+		S3Region:               s3Region,
+		S3Bucket:               s3Bucket,
+		S3Prefix:               s3Prefix,
+		S3AccessKeyID:          s3AccessKeyID,
+		S3SecretAccessKey:      s3SecretAccessKey,
+		S3UseSSL:               s3UseSSL,
+		RedirectDownloads:      redirectDownloads,
+		PresignExpiryInMinutes: presignExpiryInMinutes,
+	}
+}
+
 func NewConfig() *Config {
 	port := GetEnv(CONFIG_KEY_PORT, "8080")
 	debug := GetEnv(CONFIG_KEY_DEBUG, "true") == "true"
@@ -120,6 +324,14 @@ func NewConfig() *Config {
 		YtDlpConfig:                *NewYtDlpConfig(),
 		ClipCleanUpSchedulerConfig: *NewClipCleanUpSchedulerConfig(),
 		BasicAuthConfig:            *NewBasicAuthConfig(),
+		JobStoreConfig:             *NewJobStoreConfig(),
+		JobQueueConfig:             *NewJobQueueConfig(),
+		MetadataCacheConfig:        *NewMetadataCacheConfig(),
+		ClipConfig:                 *NewClipConfig(),
+		FFmpegConfig:               *NewFFmpegConfig(),
+		PresetConfig:               *NewPresetConfig(),
+		SourceCacheConfig:          *NewSourceCacheConfig(),
+		StorageConfig:              *NewStorageConfig(),
 	}
 }
 
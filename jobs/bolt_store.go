@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// requestKeysBucket indexes shared jobs with keys "<requestKey>/<jobID>".
+	requestKeysBucket = []byte("requestKeys")
+)
+
+// BoltJobStore keeps jobs in an embedded bbolt database so they survive
+// restarts and deploys. Jobs are stored as JSON keyed by job ID.
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+func NewBoltJobStore(path string) (*BoltJobStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("could not create job store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open job store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(jobsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(requestKeysBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create jobs buckets: %w", err)
+	}
+
+	return &BoltJobStore{db: db}, nil
+}
+
+func (s *BoltJobStore) Create(job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if job.RequestKey != "" {
+			if err := tx.Bucket(requestKeysBucket).Put(requestKeyIndex(job.RequestKey, job.ID), nil); err != nil {
+				return err
+			}
+		}
+		return putJob(tx.Bucket(jobsBucket), job)
+	})
+}
+
+func (s *BoltJobStore) Get(jobID string) (*Job, error) {
+	var job *Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		found, err := getJob(tx.Bucket(jobsBucket), jobID)
+		job = found
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (s *BoltJobStore) Update(jobID string, fn func(job *Job)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		job, err := getJob(bucket, jobID)
+		if err != nil {
+			return err
+		}
+
+		fn(job)
+		return putJob(bucket, job)
+	})
+}
+
+func (s *BoltJobStore) List() ([]*Job, error) {
+	var jobs []*Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, value []byte) error {
+			job := new(Job)
+			if err := json.Unmarshal(value, job); err != nil {
+				return fmt.Errorf("could not decode job: %w", err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (s *BoltJobStore) FindByRequestKey(requestKey string) ([]*Job, error) {
+	var jobs []*Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		prefix := requestKeyIndex(requestKey, "")
+		cursor := tx.Bucket(requestKeysBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			job, err := getJob(bucket, string(key[len(prefix):]))
+			if err == ErrJobNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (s *BoltJobStore) Delete(jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		job, err := getJob(bucket, jobID)
+		if err == nil && job.RequestKey != "" {
+			if err := tx.Bucket(requestKeysBucket).Delete(requestKeyIndex(job.RequestKey, jobID)); err != nil {
+				return err
+			}
+		}
+		return bucket.Delete([]byte(jobID))
+	})
+}
+
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
+
+func requestKeyIndex(requestKey string, jobID string) []byte {
+	return []byte(requestKey + "/" + jobID)
+}
+
+func getJob(bucket *bolt.Bucket, jobID string) (*Job, error) {
+	value := bucket.Get([]byte(jobID))
+	if value == nil {
+		return nil, ErrJobNotFound
+	}
+
+	job := new(Job)
+	if err := json.Unmarshal(value, job); err != nil {
+		return nil, fmt.Errorf("could not decode job %s: %w", jobID, err)
+	}
+	return job, nil
+}
+
+func putJob(bucket *bolt.Bucket, job *Job) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("could not encode job %s: %w", job.ID, err)
+	}
+	return bucket.Put([]byte(job.ID), value)
+}
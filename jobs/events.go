@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"sync"
+)
+
+// jobEvents fans job snapshots out to subscribers, e.g. Server-Sent Events
+// streams. Every event is a full snapshot, so a slow subscriber only ever
+// needs the latest one and older undelivered snapshots are dropped.
+type jobEvents struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan Job]struct{}
+}
+
+var events = &jobEvents{
+	subscribers: make(map[string]map[chan Job]struct{}),
+}
+
+// Subscribe returns a channel receiving a snapshot of the job after every
+// state transition and progress update, and a function to unsubscribe.
+func Subscribe(jobID string) (<-chan Job, func()) {
+	ch := make(chan Job, 1)
+
+	events.lock.Lock()
+	if events.subscribers[jobID] == nil {
+		events.subscribers[jobID] = make(map[chan Job]struct{})
+	}
+	events.subscribers[jobID][ch] = struct{}{}
+	events.lock.Unlock()
+
+	unsubscribe := func() {
+		events.lock.Lock()
+		defer events.lock.Unlock()
+
+		delete(events.subscribers[jobID], ch)
+		if len(events.subscribers[jobID]) == 0 {
+			delete(events.subscribers, jobID)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+func hasSubscribers(jobID string) bool {
+	events.lock.Lock()
+	defer events.lock.Unlock()
+
+	return len(events.subscribers[jobID]) > 0
+}
+
+// publishJob sends the current state of the job to its subscribers.
+func publishJob(jobID string) {
+	if !hasSubscribers(jobID) {
+		return
+	}
+
+	job, exists := GetJobById(jobID)
+	if !exists {
+		return
+	}
+
+	events.lock.Lock()
+	defer events.lock.Unlock()
+
+	for ch := range events.subscribers[jobID] {
+		select {
+		case ch <- *job:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- *job
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func receiveJob(t *testing.T, ch <-chan Job) Job {
+	t.Helper()
+	select {
+	case job := <-ch:
+		return job
+	case <-time.After(time.Second):
+		t.Fatal("Expected a job event")
+		return Job{}
+	}
+}
+
+func TestSubscribeReceivesTransitions(t *testing.T) {
+	job := NewJob(JobRequest{})
+	ch, unsubscribe := Subscribe(job.ID)
+	defer unsubscribe()
+
+	StartJob(job.ID)
+	if event := receiveJob(t, ch); event.Status != StatusProcessing {
+		t.Errorf("Expected 'processing' event, got %v", event.Status)
+	}
+
+	UpdateJobProgress(job.ID, JobProgress{Stage: ProgressStageDownload, Percent: 42})
+	event := receiveJob(t, ch)
+	if event.Progress == nil || event.Progress.Percent != 42 {
+		t.Errorf("Expected progress event with 42%%, got %+v", event.Progress)
+	}
+
+	CompleteJob(job.ID, "/path/to/file.mp4")
+	if event := receiveJob(t, ch); event.Status != StatusCompleted {
+		t.Errorf("Expected 'completed' event, got %v", event.Status)
+	}
+}
+
+func TestSlowSubscriberGetsLatestSnapshot(t *testing.T) {
+	job := NewJob(JobRequest{})
+	ch, unsubscribe := Subscribe(job.ID)
+	defer unsubscribe()
+
+	StartJob(job.ID)
+	UpdateJobProgress(job.ID, JobProgress{Stage: ProgressStageDownload, Percent: 10})
+	FailJob(job.ID, "boom")
+
+	if event := receiveJob(t, ch); event.Status != StatusError {
+		t.Errorf("Expected only the latest snapshot ('error'), got %v", event.Status)
+	}
+}
+
+func TestUnsubscribeStopsEvents(t *testing.T) {
+	job := NewJob(JobRequest{})
+	ch, unsubscribe := Subscribe(job.ID)
+	unsubscribe()
+
+	StartJob(job.ID)
+
+	select {
+	case event := <-ch:
+		t.Errorf("Did not expect an event after unsubscribing, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if hasSubscribers(job.ID) {
+		t.Error("Expected no subscribers to be left")
+	}
+}
@@ -1,9 +1,12 @@
 package jobs
 
 import (
-	"sync"
+	"errors"
+	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/MorrisMorrison/gutils/glogger"
 	"github.com/google/uuid"
 )
 
@@ -14,79 +17,512 @@ const (
 	StatusProcessing JobStatus = "processing"
 	StatusCompleted  JobStatus = "completed"
 	StatusError      JobStatus = "error"
+	StatusCancelled  JobStatus = "cancelled"
 )
 
-type Job struct {
-	ID          string    `json:"id"`
-	Status      JobStatus `json:"status"`
-	FilePath    string    `json:"filePath,omitempty"`
-	Error       string    `json:"error,omitempty"`
-	StartedAt   time.Time `json:"startedAt"`
-	CompletedAt time.Time `json:"completedAt"`
+var ErrJobNotCancellable = errors.New("job is already finished")
+
+// ErrJobStillRequested is returned when one requester of a shared job
+// withdraws from it. The job keeps running for the other requesters.
+var ErrJobStillRequested = errors.New("job is still requested by others")
+
+// ErrRequesterNotFound is returned when a shared job is withdrawn from with a
+// token it did not hand out or that already withdrew.
+var ErrRequesterNotFound = errors.New("requester token is not valid for this job")
+
+// IsFinished reports whether a job in this status will not change anymore.
+func (s JobStatus) IsFinished() bool {
+	return s == StatusCompleted || s == StatusError || s == StatusCancelled
+}
+
+const (
+	ProgressStageDownload = "download"
+	ProgressStageEncode   = "encode"
+	ProgressStageConvert  = "convert"
+	ProgressStageBundle   = "bundle"
+)
+
+// JobProgress is the latest progress reported by yt-dlp or ffmpeg. Speed is in
+// bytes per second; unknown values are zero.
+type JobProgress struct {
+	Stage           string  `json:"stage"`
+	Percent         float64 `json:"percent"`
+	DownloadedBytes int64   `json:"downloadedBytes"`
+	TotalBytes      int64   `json:"totalBytes,omitempty"`
+	Speed           float64 `json:"speed"`
+	EtaInSeconds    int     `json:"eta"`
 }
 
-var (
-	Jobs     = make(map[string]*Job)
-	JobsLock = sync.Mutex{}
+const (
+	ErrorCodeProcessingFailed = "processing_failed"
+	ErrorCodeInterrupted      = "interrupted"
+	ErrorCodeInternal         = "internal_error"
 )
 
-func NewJob() *Job {
+// ClipOutput converts the downloaded clip into another format, e.g. audio
+// only or an animated GIF. Bitrate (kbit/s) is the audio bitrate; FPS, Width
+// and Loop apply to animations; TargetSizeInMb, VideoBitrate, MaxHeight and
+// the reframing options AspectRatio, CropMode and CropOffset apply to
+// re-encoded video. Zero values select the defaults of the format.
+type ClipOutput struct {
+	Format         string  `json:"format"`
+	Bitrate        int     `json:"bitrate,omitempty"`
+	FPS            int     `json:"fps,omitempty"`
+	Width          int     `json:"width,omitempty"`
+	Loop           int     `json:"loop,omitempty"`
+	TargetSizeInMb int     `json:"targetSizeInMb,omitempty"`
+	VideoBitrate   int     `json:"videoBitrate,omitempty"`
+	MaxHeight      int     `json:"maxHeight,omitempty"`
+	AspectRatio    string  `json:"aspectRatio,omitempty"`
+	CropMode       string  `json:"cropMode,omitempty"`
+	CropOffset     float64 `json:"cropOffset,omitempty"`
+}
+
+// HasVideoOptions reports whether any option of re-encoded video is set.
+func (o ClipOutput) HasVideoOptions() bool {
+	return o.TargetSizeInMb != 0 || o.VideoBitrate != 0 || o.MaxHeight != 0 || o.AspectRatio != "" || o.CropMode != "" || o.CropOffset != 0
+}
+
+// JobResult describes the file of a completed job. BitrateInKbps is the
+// average over the whole clip, including audio and container overhead.
+type JobResult struct {
+	SizeInBytes   int64 `json:"sizeInBytes"`
+	BitrateInKbps int   `json:"bitrateInKbps,omitempty"`
+}
+
+// ClipSubtitles adds the subtitles of the clipped range in Language, from the
+// uploaded subtitles or, with Automatic, YouTube's auto-generated captions.
+// Mode is sidecar, soft or burn; Format (srt or vtt) applies to sidecar files.
+type ClipSubtitles struct {
+	Language  string `json:"language"`
+	Automatic bool   `json:"automatic,omitempty"`
+	Mode      string `json:"mode"`
+	Format    string `json:"format,omitempty"`
+}
+
+// ClipSegment is one range of a clip joined from several segments.
+type ClipSegment struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// JobRequest holds the parameters a clip job was requested with. For clips of
+// a chapter, From and To hold the resolved chapter boundaries. Clips joined
+// from Segments have no From and To; CrossfadeInSeconds fades between them.
+// Parent jobs of a batch only set Batch; their children hold the clips.
+type JobRequest struct {
+	Url                string         `json:"url"`
+	From               string         `json:"from"`
+	To                 string         `json:"to"`
+	Segments           []ClipSegment  `json:"segments,omitempty"`
+	CrossfadeInSeconds float64        `json:"crossfadeInSeconds,omitempty"`
+	Format             string         `json:"format"`
+	PreciseCut         bool           `json:"preciseCut,omitempty"`
+	NoAudio            bool           `json:"noAudio,omitempty"`
+	Preset             string         `json:"preset,omitempty"`
+	ChapterIndex       *int           `json:"chapterIndex,omitempty"`
+	ChapterTitle       string         `json:"chapterTitle,omitempty"`
+	AllChapters        bool           `json:"allChapters,omitempty"`
+	Batch              bool           `json:"batch,omitempty"`
+	Output             *ClipOutput    `json:"output,omitempty"`
+	Subtitles          *ClipSubtitles `json:"subtitles,omitempty"`
+}
+
+type Job struct {
+	ID          string     `json:"id"`
+	Status      JobStatus  `json:"status"`
+	Request     JobRequest `json:"request"`
+	ParentJobID string     `json:"parentJobId,omitempty"`
+	ChildJobIDs []string   `json:"childJobIds,omitempty"`
+	RequestKey  string     `json:"requestKey,omitempty"`
+	// RequesterTokens holds a token per request of a shared job that has not
+	// withdrawn from it yet.
+	RequesterTokens []string     `json:"requesterTokens,omitempty"`
+	QueuePosition   int          `json:"queuePosition,omitempty"`
+	Progress        *JobProgress `json:"progress,omitempty"`
+	FilePath        string       `json:"filePath,omitempty"`
+	Result          *JobResult   `json:"result,omitempty"`
+	ErrorCode       string       `json:"errorCode,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	CreatedAt       time.Time    `json:"createdAt"`
+	StartedAt       time.Time    `json:"startedAt"`
+	CompletedAt     time.Time    `json:"completedAt"`
+}
+
+// FileKey returns the key of the clip of a completed job in storage.Clips.
+// Jobs completed before clips were kept in a storage recorded the path of the
+// clip in the clip directory instead.
+func (job *Job) FileKey() string {
+	if job.FilePath == "" {
+		return ""
+	}
+	return filepath.Base(job.FilePath)
+}
+
+func NewJob(request JobRequest) *Job {
+	return newJob(request, "")
+}
+
+// NewSharedJob creates a job that identical requests can attach to. Its
+// RequestKey identifies the clip. It returns the token of its first requester.
+func NewSharedJob(request JobRequest, requestKey string) (*Job, string) {
+	job := newJob(request, requestKey)
+	return job, job.RequesterTokens[0]
+}
+
+func newJob(request JobRequest, requestKey string) *Job {
 	jobID := uuid.New().String()
 	job := &Job{
-		ID:     jobID,
-		Status: StatusQueued,
+		ID:         jobID,
+		Status:     StatusQueued,
+		Request:    request,
+		RequestKey: requestKey,
+		CreatedAt:  time.Now(),
+	}
+	if requestKey != "" {
+		job.RequesterTokens = []string{uuid.New().String()}
+	}
+	if err := Store.Create(job); err != nil {
+		glogger.Log.Errorf(err, "Could not store job %s", job.ID)
 	}
-	JobsLock.Lock()
-	Jobs[job.ID] = job
-	JobsLock.Unlock()
 
 	return job
 }
 
+// NewParentJob creates a job bundling one child job per child request. The
+// parent completes once all of its children are finished.
+func NewParentJob(request JobRequest, childRequests []JobRequest) (*Job, []*Job) {
+	parent := &Job{
+		ID:        uuid.New().String(),
+		Status:    StatusQueued,
+		Request:   request,
+		CreatedAt: time.Now(),
+	}
+
+	children := make([]*Job, 0, len(childRequests))
+	for _, childRequest := range childRequests {
+		child := &Job{
+			ID:          uuid.New().String(),
+			Status:      StatusQueued,
+			Request:     childRequest,
+			ParentJobID: parent.ID,
+			CreatedAt:   time.Now(),
+		}
+		parent.ChildJobIDs = append(parent.ChildJobIDs, child.ID)
+		children = append(children, child)
+	}
+
+	for _, job := range append([]*Job{parent}, children...) {
+		if err := Store.Create(job); err != nil {
+			glogger.Log.Errorf(err, "Could not store job %s", job.ID)
+		}
+	}
+
+	return parent, children
+}
+
+// ChildJobCounts counts the children of a parent job by status.
+type ChildJobCounts struct {
+	Total      int `json:"total"`
+	Queued     int `json:"queued"`
+	Processing int `json:"processing"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+}
+
+// CountChildJobs counts the children of the job by status. Children that do
+// not exist anymore are only counted in Total.
+func CountChildJobs(job *Job) ChildJobCounts {
+	counts := ChildJobCounts{Total: len(job.ChildJobIDs)}
+	for _, childID := range job.ChildJobIDs {
+		child, err := Store.Get(childID)
+		if err != nil {
+			continue
+		}
+
+		switch child.Status {
+		case StatusQueued:
+			counts.Queued++
+		case StatusProcessing:
+			counts.Processing++
+		case StatusCompleted:
+			counts.Completed++
+		case StatusError:
+			counts.Failed++
+		case StatusCancelled:
+			counts.Cancelled++
+		}
+	}
+	return counts
+}
+
 func UpdateJobStatus(jobID string, status JobStatus) {
-	JobsLock.Lock()
-	defer JobsLock.Unlock()
-	job, exists := Jobs[jobID]
-	if exists {
+	updateJob(jobID, func(job *Job) {
 		job.Status = status
-	}
+	})
 }
 
 func FailJob(jobID, errorMsg string) {
-	JobsLock.Lock()
-	defer JobsLock.Unlock()
-	job, exists := Jobs[jobID]
-	if exists {
+	FailJobWithCode(jobID, ErrorCodeProcessingFailed, errorMsg)
+}
+
+// FailJobWithCode fails the job with a stable, machine-readable error code
+// alongside the human-readable message.
+func FailJobWithCode(jobID, errorCode, errorMsg string) {
+	updateJob(jobID, func(job *Job) {
+		if job.Status == StatusCancelled {
+			return
+		}
 		job.Status = StatusError
+		job.ErrorCode = errorCode
 		job.Error = errorMsg
-	}
+		job.CompletedAt = time.Now()
+	})
 }
 
 func CompleteJob(jobID, filePath string) {
-	JobsLock.Lock()
-	defer JobsLock.Unlock()
-	job, exists := Jobs[jobID]
-	if exists {
+	completeJob(jobID, filePath, nil)
+}
+
+// CompleteJobWithResult completes the job and records the size and bitrate of
+// its file.
+func CompleteJobWithResult(jobID, filePath string, result JobResult) {
+	completeJob(jobID, filePath, &result)
+}
+
+func completeJob(jobID, filePath string, result *JobResult) {
+	updateJob(jobID, func(job *Job) {
+		if job.Status == StatusCancelled {
+			return
+		}
 		job.Status = StatusCompleted
 		job.FilePath = filePath
+		job.Result = result
 		job.CompletedAt = time.Now()
-	}
+	})
 }
 
 func StartJob(jobID string) {
-	JobsLock.Lock()
-	defer JobsLock.Unlock()
-	job, exists := Jobs[jobID]
-	if exists {
+	updateJob(jobID, func(job *Job) {
+		if job.Status == StatusCancelled {
+			return
+		}
 		job.Status = StatusProcessing
 		job.StartedAt = time.Now()
+	})
+}
+
+func UpdateJobProgress(jobID string, progress JobProgress) {
+	updateJob(jobID, func(job *Job) {
+		if job.Status != StatusProcessing {
+			return
+		}
+		job.Progress = &progress
+	})
+}
+
+// RenewCompletedJob restarts the retention of a completed job whose clip is
+// handed out again, so the cleanup keeps the job and its clip for another
+// retention. It reports whether the job is still completed.
+func RenewCompletedJob(jobID string) bool {
+	renewed := false
+	updateJob(jobID, func(job *Job) {
+		if job.Status == StatusCompleted {
+			job.CompletedAt = time.Now()
+			renewed = true
+		}
+	})
+	return renewed
+}
+
+// CancelJob moves a queued or processing job to StatusCancelled and stops it.
+// A running job's context is cancelled, which kills its yt-dlp process.
+// Cancelling a parent job cancels its unfinished children.
+func CancelJob(jobID string) error {
+	return cancelJob(jobID, nil)
+}
+
+// WithdrawFromJob withdraws the request holding the token from a shared job.
+// Each token withdraws once, and the job is only cancelled once its last
+// request withdrew; until then ErrJobStillRequested is returned. Jobs that are
+// not shared are cancelled right away.
+func WithdrawFromJob(jobID string, token string) error {
+	return cancelJob(jobID, func(job *Job) error {
+		if job.RequestKey == "" {
+			return nil
+		}
+
+		i := slices.Index(job.RequesterTokens, token)
+		if i < 0 {
+			return ErrRequesterNotFound
+		}
+		// Stored jobs share their slices with the copies handed out, so the
+		// token is not removed in place.
+		job.RequesterTokens = slices.Concat(job.RequesterTokens[:i], job.RequesterTokens[i+1:])
+		if len(job.RequesterTokens) > 0 {
+			return ErrJobStillRequested
+		}
+		return nil
+	})
+}
+
+// cancelJob cancels the job unless withdraw, which runs in the same update,
+// returns an error.
+func cancelJob(jobID string, withdraw func(job *Job) error) error {
+	cancellable := false
+	var withdrawErr error
+	var childJobIDs []string
+	err := Store.Update(jobID, func(job *Job) {
+		if job.Status.IsFinished() {
+			return
+		}
+		if withdraw != nil {
+			if withdrawErr = withdraw(job); withdrawErr != nil {
+				return
+			}
+		}
+		job.Status = StatusCancelled
+		job.CompletedAt = time.Now()
+		cancellable = true
+		childJobIDs = job.ChildJobIDs
+	})
+	if err != nil {
+		return err
+	}
+
+	if withdrawErr != nil {
+		return withdrawErr
+	}
+	if !cancellable {
+		return ErrJobNotCancellable
 	}
+
+	Queue.Cancel(jobID)
+	publishJob(jobID)
+	for _, childJobID := range childJobIDs {
+		if err := CancelJob(childJobID); err != nil && err != ErrJobNotCancellable {
+			glogger.Log.Errorf(err, "Could not cancel child job %s", childJobID)
+		}
+	}
+	Queue.publishPositions()
+	return nil
 }
 
 func GetJobById(jobId string) (*Job, bool) {
-	JobsLock.Lock()
-	job, exists := Jobs[jobId]
-	JobsLock.Unlock()
+	job, err := Store.Get(jobId)
+	if err != nil {
+		if err != ErrJobNotFound {
+			glogger.Log.Errorf(err, "Could not load job %s", jobId)
+		}
+		return nil, false
+	}
+
+	if job.Status == StatusQueued {
+		job.QueuePosition = Queue.Position(job.ID)
+	}
+
+	return job, true
+}
+
+func ListJobs() ([]*Job, error) {
+	return Store.List()
+}
+
+// FindJobsByRequestKey returns the shared jobs created for the request key.
+func FindJobsByRequestKey(requestKey string) ([]*Job, error) {
+	return Store.FindByRequestKey(requestKey)
+}
+
+// AttachToJob adds a requester to a shared job that is not finished yet, so
+// it is only cancelled once every requester withdrew from it. It returns the
+// token the requester withdraws with and reports whether the job could be
+// attached to.
+func AttachToJob(jobID string) (string, bool) {
+	token := ""
+	err := Store.Update(jobID, func(job *Job) {
+		if job.RequestKey != "" && !job.Status.IsFinished() {
+			token = uuid.New().String()
+			job.RequesterTokens = append(job.RequesterTokens, token)
+		}
+	})
+	if err != nil && err != ErrJobNotFound {
+		glogger.Log.Errorf(err, "Could not attach to job %s", jobID)
+	}
+	return token, token != ""
+}
+
+// IsJobInUse reports whether the job is unfinished or belongs to an unfinished
+// bundle, which zips the clip of the job once all its clips are finished. The
+// cleanup keeps such jobs and their clips.
+func IsJobInUse(jobID string) bool {
+	job, exists := GetJobById(jobID)
+	if !exists {
+		return false
+	}
+	if !job.Status.IsFinished() {
+		return true
+	}
+	if job.ParentJobID == "" {
+		return false
+	}
+
+	parent, exists := GetJobById(job.ParentJobID)
+	return exists && !parent.Status.IsFinished()
+}
+
+// IsJobRetained reports whether the cleanup keeps the job and its files: the
+// job is in use, or it finished within the retention. Completed jobs whose
+// clip is handed out again are renewed, so they count from then on.
+func IsJobRetained(jobID string, retention time.Duration) bool {
+	if IsJobInUse(jobID) {
+		return true
+	}
+	job, exists := GetJobById(jobID)
+	return exists && time.Since(job.CompletedAt) <= retention
+}
+
+// JobIDFromFileName returns the job ID the files of a job start with, e.g.
+// <jobID>.mp4, <jobID>.zip or <jobID>.mp4.part.
+func JobIDFromFileName(name string) (string, bool) {
+	if len(name) < 36 {
+		return "", false
+	}
+	if _, err := uuid.Parse(name[:36]); err != nil {
+		return "", false
+	}
+	return name[:36], true
+}
+
+func DeleteJob(jobID string) error {
+	return Store.Delete(jobID)
+}
+
+// RecoverInterruptedJobs fails every job that was still queued or processing
+// when the server stopped. Their yt-dlp processes died with the old server, so
+// they would otherwise never leave that state.
+func RecoverInterruptedJobs() {
+	allJobs, err := Store.List()
+	if err != nil {
+		glogger.Log.Error(err, "Could not list jobs to recover")
+		return
+	}
+
+	for _, job := range allJobs {
+		if job.Status == StatusQueued || job.Status == StatusProcessing {
+			glogger.Log.Infof("Job %s was interrupted by a restart", job.ID)
+			FailJobWithCode(job.ID, ErrorCodeInterrupted, "Job was interrupted by a server restart")
+		}
+	}
+}
+
+func updateJob(jobID string, fn func(job *Job)) {
+	if err := Store.Update(jobID, fn); err != nil {
+		if err != ErrJobNotFound {
+			glogger.Log.Errorf(err, "Could not update job %s", jobID)
+		}
+		return
+	}
 
-	return job, exists
+	publishJob(jobID)
 }
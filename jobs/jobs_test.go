@@ -5,24 +5,25 @@ import (
 )
 
 func TestNewJob(t *testing.T) {
-	job := NewJob()
+	job := NewJob(JobRequest{})
 
 	if job == nil {
-		t.Fatal("NewJob() returned nil")
+		t.Fatal("NewJob(JobRequest{}) returned nil")
 	}
 
 	if job.Status != StatusQueued {
 		t.Errorf("Expected job status to be 'queued', got %v", job.Status)
 	}
 
-	if _, exists := Jobs[job.ID]; !exists {
-		t.Errorf("Job with ID %v does not exist in Jobs map", job.ID)
+	if _, err := Store.Get(job.ID); err != nil {
+		t.Errorf("Job with ID %v does not exist in job store", job.ID)
 	}
 }
 
 func TestUpdateJobStatus(t *testing.T) {
-	job := NewJob()
+	job := NewJob(JobRequest{})
 	UpdateJobStatus(job.ID, StatusProcessing)
+	job, _ = GetJobById(job.ID)
 
 	if job.Status != StatusProcessing {
 		t.Errorf("Expected job status to be 'processing', got %v", job.Status)
@@ -30,9 +31,10 @@ func TestUpdateJobStatus(t *testing.T) {
 }
 
 func TestFailJob(t *testing.T) {
-	job := NewJob()
+	job := NewJob(JobRequest{})
 	errorMsg := "An error occurred"
 	FailJob(job.ID, errorMsg)
+	job, _ = GetJobById(job.ID)
 
 	if job.Status != StatusError {
 		t.Errorf("Expected job status to be 'error', got %v", job.Status)
@@ -43,10 +45,24 @@ func TestFailJob(t *testing.T) {
 	}
 }
 
+func TestCompleteJobWithResult(t *testing.T) {
+	job := NewJob(JobRequest{})
+	CompleteJobWithResult(job.ID, "/path/to/file.mp4", JobResult{SizeInBytes: 7800000, BitrateInKbps: 2080})
+	job, _ = GetJobById(job.ID)
+
+	if job.Status != StatusCompleted {
+		t.Errorf("Expected job status to be 'completed', got %v", job.Status)
+	}
+	if job.Result == nil || job.Result.SizeInBytes != 7800000 || job.Result.BitrateInKbps != 2080 {
+		t.Errorf("Unexpected result %+v", job.Result)
+	}
+}
+
 func TestCompleteJob(t *testing.T) {
-	job := NewJob()
+	job := NewJob(JobRequest{})
 	filePath := "/path/to/file.mp4"
 	CompleteJob(job.ID, filePath)
+	job, _ = GetJobById(job.ID)
 
 	if job.Status != StatusCompleted {
 		t.Errorf("Expected job status to be 'completed', got %v", job.Status)
@@ -58,8 +74,9 @@ func TestCompleteJob(t *testing.T) {
 }
 
 func TestStartJob(t *testing.T) {
-	job := NewJob()
+	job := NewJob(JobRequest{})
 	StartJob(job.ID)
+	job, _ = GetJobById(job.ID)
 
 	if job.Status != StatusProcessing {
 		t.Errorf("Expected job status to be 'processing', got %v", job.Status)
@@ -67,7 +84,7 @@ func TestStartJob(t *testing.T) {
 }
 
 func TestGetJobById(t *testing.T) {
-	job := NewJob()
+	job := NewJob(JobRequest{})
 	foundJob, exists := GetJobById(job.ID)
 
 	if !exists {
@@ -83,3 +100,152 @@ func TestGetJobById(t *testing.T) {
 		t.Errorf("Expected job with nonexistent ID to not exist")
 	}
 }
+
+func TestCancelJob(t *testing.T) {
+	job := NewJob(JobRequest{})
+	if err := CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob() returned error: %v", err)
+	}
+
+	job, _ = GetJobById(job.ID)
+	if job.Status != StatusCancelled {
+		t.Errorf("Expected job status to be 'cancelled', got %v", job.Status)
+	}
+
+	CompleteJob(job.ID, "/path/to/file.mp4")
+	job, _ = GetJobById(job.ID)
+	if job.Status != StatusCancelled {
+		t.Errorf("Expected cancelled job to stay cancelled, got %v", job.Status)
+	}
+
+	if err := CancelJob(job.ID); err != ErrJobNotCancellable {
+		t.Errorf("Expected ErrJobNotCancellable, got %v", err)
+	}
+
+	if err := CancelJob("nonexistent-id"); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestWithdrawFromSharedJob(t *testing.T) {
+	job, firstToken := NewSharedJob(JobRequest{}, "key")
+	secondToken, attached := AttachToJob(job.ID)
+	if !attached || secondToken == firstToken {
+		t.Fatalf("Expected to attach to a queued shared job with a new token, got %q", secondToken)
+	}
+	if _, attached := AttachToJob(NewJob(JobRequest{}).ID); attached {
+		t.Error("Expected jobs without a request key not to be shared")
+	}
+
+	if err := WithdrawFromJob(job.ID, firstToken); err != ErrJobStillRequested {
+		t.Fatalf("Expected ErrJobStillRequested, got %v", err)
+	}
+	if err := WithdrawFromJob(job.ID, firstToken); err != ErrRequesterNotFound {
+		t.Fatalf("Expected a token to withdraw only once, got %v", err)
+	}
+	if err := WithdrawFromJob(job.ID, "unknown"); err != ErrRequesterNotFound {
+		t.Fatalf("Expected ErrRequesterNotFound, got %v", err)
+	}
+	job, _ = GetJobById(job.ID)
+	if job.Status != StatusQueued || len(job.RequesterTokens) != 1 {
+		t.Errorf("Expected the job to keep running for the other requester, got %+v", job)
+	}
+
+	if err := WithdrawFromJob(job.ID, secondToken); err != nil {
+		t.Fatalf("WithdrawFromJob() returned error: %v", err)
+	}
+	job, _ = GetJobById(job.ID)
+	if job.Status != StatusCancelled {
+		t.Errorf("Expected the last requester to cancel the job, got %v", job.Status)
+	}
+	if _, attached := AttachToJob(job.ID); attached {
+		t.Error("Expected finished jobs not to be attached to")
+	}
+
+	unshared := NewJob(JobRequest{})
+	if err := WithdrawFromJob(unshared.ID, ""); err != nil {
+		t.Fatalf("Expected jobs that are not shared to be cancelled, got %v", err)
+	}
+}
+
+func TestCancelParentJobCancelsChildren(t *testing.T) {
+	originalStore := Store
+	Store = NewMemoryJobStore()
+	defer func() { Store = originalStore }()
+
+	parent, children := NewParentJob(JobRequest{AllChapters: true}, []JobRequest{{From: "00:00:00"}, {From: "00:00:10"}})
+	if len(parent.ChildJobIDs) != 2 || children[0].ParentJobID != parent.ID {
+		t.Fatalf("Expected parent and children to be linked, got %+v", parent)
+	}
+
+	CompleteJob(children[0].ID, "videos/child.mp4")
+
+	if err := CancelJob(parent.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	completed, _ := GetJobById(children[0].ID)
+	if completed.Status != StatusCompleted {
+		t.Errorf("Expected finished child to stay completed, got %s", completed.Status)
+	}
+	cancelled, _ := GetJobById(children[1].ID)
+	if cancelled.Status != StatusCancelled {
+		t.Errorf("Expected unfinished child to be cancelled, got %s", cancelled.Status)
+	}
+}
+
+func TestCountChildJobs(t *testing.T) {
+	originalStore := Store
+	Store = NewMemoryJobStore()
+	defer func() { Store = originalStore }()
+
+	parent, children := NewParentJob(JobRequest{Batch: true}, []JobRequest{{From: "00:00:00"}, {From: "00:00:10"}, {From: "00:00:20"}})
+	StartJob(children[0].ID)
+	CompleteJob(children[0].ID, "videos/child.mp4")
+	FailJob(children[1].ID, "Failed to download video")
+
+	counts := CountChildJobs(parent)
+	expected := ChildJobCounts{Total: 3, Queued: 1, Completed: 1, Failed: 1}
+	if counts != expected {
+		t.Errorf("Expected %+v, got %+v", expected, counts)
+	}
+}
+
+func TestIsJobInUse(t *testing.T) {
+	originalStore := Store
+	Store = NewMemoryJobStore()
+	defer func() { Store = originalStore }()
+
+	parent, children := NewParentJob(JobRequest{Batch: true}, []JobRequest{{From: "00:00:00"}, {From: "00:00:10"}})
+	StartJob(parent.ID)
+	CompleteJob(children[0].ID, "child.mp4")
+
+	if !IsJobInUse(children[0].ID) {
+		t.Error("Expected a finished clip of an unfinished bundle to be in use")
+	}
+	if !IsJobInUse(children[1].ID) {
+		t.Error("Expected an unfinished job to be in use")
+	}
+
+	CompleteJob(parent.ID, "parent.zip")
+	if IsJobInUse(children[0].ID) {
+		t.Error("Expected the clip of a finished bundle not to be in use")
+	}
+	if IsJobInUse("nonexistent-id") {
+		t.Error("Expected a nonexistent job not to be in use")
+	}
+}
+
+func TestJobIDFromFileName(t *testing.T) {
+	jobID := "0b6c9f4e-3c3a-4d6e-9f53-2a3c1e7d8b90"
+	for name, expected := range map[string]string{
+		jobID + ".mp4":             jobID,
+		jobID + ".source.mp4.part": jobID,
+		"notes.txt":                "",
+		"source-cache-key.mp4":     "",
+	} {
+		if id, ok := JobIDFromFileName(name); id != expected || ok != (expected != "") {
+			t.Errorf("JobIDFromFileName(%q) = %q, %v", name, id, ok)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"sync"
+)
+
+type MemoryJobStore struct {
+	jobs map[string]*Job
+	// requestKeys indexes the IDs of shared jobs by request key.
+	requestKeys map[string]map[string]bool
+	lock        sync.Mutex
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		jobs:        make(map[string]*Job),
+		requestKeys: make(map[string]map[string]bool),
+	}
+}
+
+func (s *MemoryJobStore) Create(job *Job) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored := *job
+	s.jobs[job.ID] = &stored
+	if job.RequestKey != "" {
+		if s.requestKeys[job.RequestKey] == nil {
+			s.requestKeys[job.RequestKey] = make(map[string]bool)
+		}
+		s.requestKeys[job.RequestKey][job.ID] = true
+	}
+	return nil
+}
+
+func (s *MemoryJobStore) Get(jobID string) (*Job, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	found := *job
+	return &found, nil
+}
+
+func (s *MemoryJobStore) Update(jobID string, fn func(job *Job)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	fn(job)
+	return nil
+}
+
+func (s *MemoryJobStore) List() ([]*Job, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		found := *job
+		jobs = append(jobs, &found)
+	}
+	return jobs, nil
+}
+
+func (s *MemoryJobStore) FindByRequestKey(requestKey string) ([]*Job, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var jobs []*Job
+	for jobID := range s.requestKeys[requestKey] {
+		found := *s.jobs[jobID]
+		jobs = append(jobs, &found)
+	}
+	return jobs, nil
+}
+
+func (s *MemoryJobStore) Delete(jobID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if job, exists := s.jobs[jobID]; exists && job.RequestKey != "" {
+		delete(s.requestKeys[job.RequestKey], jobID)
+		if len(s.requestKeys[job.RequestKey]) == 0 {
+			delete(s.requestKeys, job.RequestKey)
+		}
+	}
+	delete(s.jobs, jobID)
+	return nil
+}
+
+func (s *MemoryJobStore) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"ytclipper-go/config"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+var ErrQueueFull = errors.New("job queue is full")
+
+// Queue is the queue clip jobs are processed from.
+var Queue *JobQueue
+
+func init() {
+	Queue = NewJobQueue(config.CONFIG.JobQueueConfig.Workers, config.CONFIG.JobQueueConfig.MaxLength)
+}
+
+type queuedJob struct {
+	jobID string
+	run   func(ctx context.Context)
+}
+
+// JobQueue runs jobs in FIFO order on a fixed number of workers. A job stays
+// in StatusQueued until a worker picks it up. Every running job gets its own
+// context, which is cancelled by Cancel.
+type JobQueue struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	pending   []queuedJob
+	running   map[string]context.CancelFunc
+	maxLength int
+}
+
+// NewJobQueue starts a queue with the given number of workers. A maxLength of
+// zero or less means the queue is unbounded.
+func NewJobQueue(workers int, maxLength int) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q := &JobQueue{
+		running:   make(map[string]context.CancelFunc),
+		maxLength: maxLength,
+	}
+	q.cond = sync.NewCond(&q.lock)
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Enqueue schedules run for the given job. It returns ErrQueueFull if the
+// queue already holds maxLength jobs.
+func (q *JobQueue) Enqueue(jobID string, run func(ctx context.Context)) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.maxLength > 0 && len(q.pending) >= q.maxLength {
+		return ErrQueueFull
+	}
+
+	q.pending = append(q.pending, queuedJob{jobID: jobID, run: run})
+	q.cond.Signal()
+	return nil
+}
+
+// Position returns the 1-based position of the job in the queue, or 0 if the
+// job is not waiting.
+func (q *JobQueue) Position(jobID string) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, queued := range q.pending {
+		if queued.jobID == jobID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Cancel removes a waiting job from the queue or cancels the context of a
+// running one. It reports whether the job was found.
+func (q *JobQueue) Cancel(jobID string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, queued := range q.pending {
+		if queued.jobID == jobID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+
+	if cancel, exists := q.running[jobID]; exists {
+		cancel()
+		return true
+	}
+	return false
+}
+
+func (q *JobQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.pending)
+}
+
+// publishPositions notifies subscribers of waiting jobs that their queue
+// position changed.
+func (q *JobQueue) publishPositions() {
+	q.lock.Lock()
+	jobIDs := make([]string, 0, len(q.pending))
+	for _, queued := range q.pending {
+		jobIDs = append(jobIDs, queued.jobID)
+	}
+	q.lock.Unlock()
+
+	for _, jobID := range jobIDs {
+		publishJob(jobID)
+	}
+}
+
+func (q *JobQueue) work() {
+	for {
+		q.lock.Lock()
+		for len(q.pending) == 0 {
+			q.cond.Wait()
+		}
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		ctx, cancel := context.WithCancel(context.Background())
+		q.running[next.jobID] = cancel
+		q.lock.Unlock()
+
+		q.publishPositions()
+		q.run(ctx, next)
+
+		q.lock.Lock()
+		delete(q.running, next.jobID)
+		q.lock.Unlock()
+		cancel()
+	}
+}
+
+func (q *JobQueue) run(ctx context.Context, queued queuedJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			glogger.Log.Warningf("Job %s panicked: %v", queued.jobID, r)
+			FailJobWithCode(queued.jobID, ErrorCodeInternal, "Internal error while processing the job")
+		}
+	}()
+
+	queued.run(ctx)
+}
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobQueueRunsInFifoOrder(t *testing.T) {
+	queue := NewJobQueue(1, 0)
+
+	var (
+		lock  sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	for _, id := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		id := id
+		if err := queue.Enqueue(id, func(ctx context.Context) {
+			lock.Lock()
+			order = append(order, id)
+			lock.Unlock()
+			wg.Done()
+		}); err != nil {
+			t.Fatalf("Enqueue(%s) returned error: %v", id, err)
+		}
+	}
+	wg.Wait()
+
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "c" {
+		t.Errorf("Expected jobs to run in order [a b c], got %v", order)
+	}
+}
+
+func TestJobQueueRejectsWhenFull(t *testing.T) {
+	queue := NewJobQueue(1, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	_ = queue.Enqueue("running", func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	if err := queue.Enqueue("waiting", func(ctx context.Context) {}); err != nil {
+		t.Fatalf("Expected first waiting job to be accepted, got %v", err)
+	}
+	if err := queue.Enqueue("rejected", func(ctx context.Context) {}); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestJobQueuePosition(t *testing.T) {
+	queue := NewJobQueue(1, 0)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	_ = queue.Enqueue("running", func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	_ = queue.Enqueue("first", func(ctx context.Context) {})
+	_ = queue.Enqueue("second", func(ctx context.Context) {})
+
+	if pos := queue.Position("running"); pos != 0 {
+		t.Errorf("Expected running job to have position 0, got %d", pos)
+	}
+	if pos := queue.Position("first"); pos != 1 {
+		t.Errorf("Expected position 1, got %d", pos)
+	}
+	if pos := queue.Position("second"); pos != 2 {
+		t.Errorf("Expected position 2, got %d", pos)
+	}
+}
+
+func TestJobQueueFailsPanickingJob(t *testing.T) {
+	original := Store
+	defer func() { Store = original }()
+	Store = NewMemoryJobStore()
+
+	job := NewJob(JobRequest{})
+	queue := NewJobQueue(1, 0)
+	_ = queue.Enqueue(job.ID, func(ctx context.Context) { panic("boom") })
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if found, _ := GetJobById(job.ID); found.Status == StatusError {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected panicking job to be failed")
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	queue := NewJobQueue(1, 0)
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	_ = queue.Enqueue("running", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+	})
+	<-started
+
+	ran := make(chan struct{}, 1)
+	_ = queue.Enqueue("waiting", func(ctx context.Context) { ran <- struct{}{} })
+
+	if !queue.Cancel("waiting") {
+		t.Error("Expected waiting job to be cancelled")
+	}
+	if queue.Position("waiting") != 0 {
+		t.Error("Expected cancelled job to be removed from the queue")
+	}
+
+	if !queue.Cancel("running") {
+		t.Error("Expected running job to be cancelled")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected running job's context to be cancelled")
+	}
+
+	if queue.Cancel("unknown") {
+		t.Error("Did not expect an unknown job to be cancelled")
+	}
+
+	select {
+	case <-ran:
+		t.Error("Did not expect a cancelled waiting job to run")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"ytclipper-go/config"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStore persists jobs. Implementations must be safe for concurrent use and
+// must hand out copies, so callers never share a *Job with the store.
+type JobStore interface {
+	Create(job *Job) error
+	Get(jobID string) (*Job, error)
+	// Update applies fn to the stored job atomically. It returns ErrJobNotFound
+	// if the job does not exist.
+	Update(jobID string, fn func(job *Job)) error
+	List() ([]*Job, error)
+	// FindByRequestKey returns the jobs created with the request key, without
+	// reading any other job.
+	FindByRequestKey(requestKey string) ([]*Job, error)
+	Delete(jobID string) error
+	Close() error
+}
+
+// Store is the job store used by the package-level job functions. It defaults
+// to an in-memory store; main replaces it according to the configuration.
+var Store JobStore = NewMemoryJobStore()
+
+func NewJobStore(storeConfig config.JobStoreConfig) (JobStore, error) {
+	switch storeConfig.Type {
+	case "", config.JOB_STORE_TYPE_MEMORY:
+		return NewMemoryJobStore(), nil
+	case config.JOB_STORE_TYPE_BOLT:
+		return NewBoltJobStore(storeConfig.Path)
+	default:
+		return nil, fmt.Errorf("unknown job store type: %s", storeConfig.Type)
+	}
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func testJobStore(t *testing.T, store JobStore) {
+	job := &Job{ID: "job-1", Status: StatusQueued}
+	if err := store.Create(job); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	job.Status = StatusError
+	found, err := store.Get("job-1")
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+	if found.Status != StatusQueued {
+		t.Errorf("Expected stored job to be independent of the caller's copy, got status %v", found.Status)
+	}
+
+	err = store.Update("job-1", func(job *Job) {
+		job.Status = StatusCompleted
+		job.FilePath = "videos/job-1.mp4"
+	})
+	if err != nil {
+		t.Fatalf("Update() returned error: %v", err)
+	}
+
+	found, _ = store.Get("job-1")
+	if found.Status != StatusCompleted || found.FilePath != "videos/job-1.mp4" {
+		t.Errorf("Expected updated job, got %+v", found)
+	}
+
+	if err := store.Update("missing", func(job *Job) {}); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound when updating a missing job, got %v", err)
+	}
+
+	all, err := store.List()
+	if err != nil || len(all) != 1 {
+		t.Errorf("Expected List() to return 1 job, got %d (err=%v)", len(all), err)
+	}
+
+	if err := store.Delete("job-1"); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if _, err := store.Get("job-1"); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound after delete, got %v", err)
+	}
+
+	testRequestKeyIndex(t, store)
+}
+
+func testRequestKeyIndex(t *testing.T, store JobStore) {
+	store.Create(&Job{ID: "shared-1", Status: StatusQueued, RequestKey: "key-a"})
+	store.Create(&Job{ID: "shared-2", Status: StatusCompleted, RequestKey: "key-a"})
+	store.Create(&Job{ID: "shared-3", Status: StatusQueued, RequestKey: "key-ab"})
+	store.Create(&Job{ID: "unshared", Status: StatusQueued})
+
+	found, err := store.FindByRequestKey("key-a")
+	if err != nil || len(found) != 2 {
+		t.Fatalf("Expected FindByRequestKey() to return 2 jobs, got %+v (err=%v)", found, err)
+	}
+	for _, job := range found {
+		if job.RequestKey != "key-a" {
+			t.Errorf("Expected only jobs of key-a, got %+v", job)
+		}
+	}
+
+	store.Delete("shared-1")
+	found, _ = store.FindByRequestKey("key-a")
+	if len(found) != 1 || found[0].ID != "shared-2" {
+		t.Errorf("Expected deleted jobs to leave the index, got %+v", found)
+	}
+	if found, _ := store.FindByRequestKey("missing"); len(found) != 0 {
+		t.Errorf("Expected no jobs for an unknown key, got %+v", found)
+	}
+}
+
+func TestMemoryJobStore(t *testing.T) {
+	testJobStore(t, NewMemoryJobStore())
+}
+
+func TestBoltJobStore(t *testing.T) {
+	store, err := NewBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewBoltJobStore() returned error: %v", err)
+	}
+	defer store.Close()
+
+	testJobStore(t, store)
+}
+
+func TestBoltJobStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := NewBoltJobStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltJobStore() returned error: %v", err)
+	}
+	_ = store.Create(&Job{ID: "job-1", Status: StatusCompleted, FilePath: "videos/job-1.mp4"})
+	store.Close()
+
+	store, err = NewBoltJobStore(path)
+	if err != nil {
+		t.Fatalf("Reopening store returned error: %v", err)
+	}
+	defer store.Close()
+
+	found, err := store.Get("job-1")
+	if err != nil {
+		t.Fatalf("Expected job to survive reopen, got %v", err)
+	}
+	if found.FilePath != "videos/job-1.mp4" {
+		t.Errorf("Expected file path to survive reopen, got %q", found.FilePath)
+	}
+}
+
+func TestRecoverInterruptedJobs(t *testing.T) {
+	original := Store
+	defer func() { Store = original }()
+	Store = NewMemoryJobStore()
+
+	queued := NewJob(JobRequest{})
+	processing := NewJob(JobRequest{})
+	StartJob(processing.ID)
+	completed := NewJob(JobRequest{})
+	CompleteJob(completed.ID, "videos/done.mp4")
+
+	RecoverInterruptedJobs()
+
+	for _, id := range []string{queued.ID, processing.ID} {
+		job, _ := GetJobById(id)
+		if job.Status != StatusError {
+			t.Errorf("Expected interrupted job %s to be failed, got %v", id, job.Status)
+		}
+	}
+
+	job, _ := GetJobById(completed.ID)
+	if job.Status != StatusCompleted {
+		t.Errorf("Expected completed job to stay completed, got %v", job.Status)
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"strings"
 	"time"
 	"ytclipper-go/config"
+	"ytclipper-go/jobs"
 	custommiddleware "ytclipper-go/middleware"
 	"ytclipper-go/routes"
 	"ytclipper-go/scheduler"
+	"ytclipper-go/storage"
 	"ytclipper-go/utils"
+	"ytclipper-go/videoprocessing"
 
 	"github.com/MorrisMorrison/gutils/glogger"
 	"github.com/labstack/echo/v4"
@@ -24,6 +27,11 @@ func checkDependencies() {
 		log.Fatalf("Dependency check failed: %v", err)
 	}
 
+	// ffprobe ships with ffmpeg and finds the streams of crossfaded segments.
+	if err := utils.CheckCommand("ffprobe"); err != nil {
+		log.Fatalf("Dependency check failed: %v", err)
+	}
+
 	if err := utils.CheckCommand("yt-dlp"); err != nil {
 		log.Fatalf("Dependency check failed: %v", err)
 	}
@@ -31,6 +39,39 @@ func checkDependencies() {
 	glogger.Log.Info("All dependencies are installed.")
 }
 
+func setupJobStore() {
+	glogger.Log.Infof("Setup job store: %s", config.CONFIG.JobStoreConfig.Type)
+
+	store, err := jobs.NewJobStore(config.CONFIG.JobStoreConfig)
+	if err != nil {
+		log.Fatalf("Job store setup failed: %v", err)
+	}
+
+	jobs.Store = store
+	jobs.RecoverInterruptedJobs()
+}
+
+func setupStorage() {
+	glogger.Log.Infof("Setup storage: %s", config.CONFIG.StorageConfig.Type)
+
+	clipStorage, err := storage.NewStorage(config.CONFIG.StorageConfig)
+	if err != nil {
+		log.Fatalf("Storage setup failed: %v", err)
+	}
+
+	storage.Clips = clipStorage
+}
+
+func setupPresets() {
+	if config.CONFIG.PresetConfig.Path != "" {
+		glogger.Log.Infof("Setup presets: %s", config.CONFIG.PresetConfig.Path)
+	}
+
+	if err := videoprocessing.LoadPresets(config.CONFIG.PresetConfig.Path); err != nil {
+		log.Fatalf("Preset setup failed: %v", err)
+	}
+}
+
 func setupEcho() {
 	glogger.Log.Info("Setup echo")
 	e := echo.New()
@@ -70,6 +111,9 @@ func setupEcho() {
 func main() {
 	glogger.Log.Info("Start ytclipper")
 	checkDependencies()
+	setupJobStore()
+	setupStorage()
+	setupPresets()
 	scheduler.StartClipCleanUpScheduler()
 	setupEcho()
 }
@@ -14,8 +14,15 @@ func RegisterRoutes(e *echo.Echo) {
 
 	e.POST("/api/v1/clip", api.CreateClip)
 	e.GET("/api/v1/clip", api.GetClip)
+	e.POST("/api/v1/clips/batch", api.CreateClipBatch)
 	e.GET("/api/v1/jobs/status", api.GetJobStatus)
+	e.DELETE("/api/v1/jobs/:id", api.CancelJob)
+	e.GET("/api/v1/jobs/:id/events", api.StreamJobEvents)
+	e.GET("/api/v2/jobs/:id", api.GetJob)
 
 	e.GET("/api/v1/video/duration", api.GetVideoDuration)
 	e.GET("/api/v1/video/formats", api.GetAvailableFormats)
+	e.GET("/api/v1/video/info", api.GetVideoInfo)
+
+	e.GET("/api/v1/presets", api.GetPresets)
 }
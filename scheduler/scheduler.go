@@ -1,11 +1,12 @@
 package scheduler
 
 import (
-	"os"
-	"path/filepath"
+	"context"
 	"time"
 	"ytclipper-go/config"
 	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+	"ytclipper-go/videoprocessing"
 
 	"github.com/MorrisMorrison/gutils/glogger"
 )
@@ -14,12 +15,13 @@ func StartClipCleanUpScheduler() {
 	intervalInMinutes := time.Duration(config.CONFIG.ClipCleanUpSchedulerConfig.IntervalInMinutes) * time.Minute
 	retentionInMinutes := time.Duration(config.CONFIG.ClipCleanUpSchedulerConfig.IntervalInMinutes) * time.Minute
 
-	startFileCleanUpScheduler(intervalInMinutes, retentionInMinutes, config.CONFIG.ClipCleanUpSchedulerConfig.ClipDirectoryPath)
+	startFileCleanUpScheduler(intervalInMinutes, retentionInMinutes)
 	startJobCleanUpScheduler(intervalInMinutes, retentionInMinutes)
+	startSourceCacheEvictionScheduler(intervalInMinutes)
 }
 
-func startFileCleanUpScheduler(interval time.Duration, retention time.Duration, clipDir string) {
-	glogger.Log.Infof("Start File Cleanup: Interval %f minutes - Retention %f minutes - Clip Directory %s", interval.Minutes(), retention.Minutes(), clipDir)
+func startFileCleanUpScheduler(interval time.Duration, retention time.Duration) {
+	glogger.Log.Infof("Start File Cleanup: Interval %f minutes - Retention %f minutes - Storage %s", interval.Minutes(), retention.Minutes(), config.CONFIG.StorageConfig.Type)
 
 	ticker := time.NewTicker(interval)
 	go func() {
@@ -28,7 +30,8 @@ func startFileCleanUpScheduler(interval time.Duration, retention time.Duration,
 				continue
 			}
 
-			cleanUpOldClips(retention, clipDir)
+			cleanUpOldClips(retention)
+			videoprocessing.CleanUpWorkingFiles(retention)
 		}
 	}()
 }
@@ -48,42 +51,67 @@ func startJobCleanUpScheduler(interval time.Duration, retention time.Duration) {
 	}()
 }
 
-func cleanUpOldClips(retention time.Duration, clipDir string) {
+// startSourceCacheEvictionScheduler evicts unused and excess sources from the
+// source cache, if it is enabled, on the interval of the clip cleanup.
+func startSourceCacheEvictionScheduler(interval time.Duration) {
+	if !config.CONFIG.SourceCacheConfig.IsEnabled {
+		return
+	}
+	glogger.Log.Infof("Start Source Cache Eviction: Retention %d minutes - Max Size %d MB - Cache Directory %s", config.CONFIG.SourceCacheConfig.RetentionInMinutes, config.CONFIG.SourceCacheConfig.MaxSizeInMb, config.CONFIG.SourceCacheConfig.Path)
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			videoprocessing.EvictSourceCache()
+		}
+	}()
+}
+
+// cleanUpOldClips deletes the stored clips older than the retention, except
+// those of jobs the cleanup keeps, such as the clips of a bundle that is not
+// zipped yet or clips handed out again within the retention.
+func cleanUpOldClips(retention time.Duration) {
 	now := time.Now()
+	ctx := context.Background()
 
-	files, err := os.ReadDir(clipDir)
+	objects, err := storage.Clips.List(ctx, "")
 	if err != nil {
-		glogger.Log.Errorf(err, "Failed to read directory: %s")
+		glogger.Log.Errorf(err, "Failed to list clips")
 		return
 	}
 
-	for _, file := range files {
-		filePath := filepath.Join(clipDir, file.Name())
-		info, err := file.Info()
-		if err != nil {
-			glogger.Log.Errorf(err, "Failed to get file info for: %s", filePath)
+	for _, object := range objects {
+		if jobID, ok := jobs.JobIDFromFileName(object.Key); ok && jobs.IsJobRetained(jobID, retention) {
 			continue
 		}
-
-		if now.Sub(info.ModTime()) > retention {
-			if err := os.Remove(filePath); err != nil {
-				glogger.Log.Errorf(err, "Failed to delete file: %s", filePath)
+		if now.Sub(object.ModTime) > retention {
+			if err := storage.Clips.Delete(ctx, object.Key); err != nil {
+				glogger.Log.Errorf(err, "Failed to delete clip: %s", object.Key)
 			} else {
-				glogger.Log.Errorf(err, "File %s deleted successfully", filePath)
+				glogger.Log.Infof("Clip %s deleted successfully", object.Key)
 			}
 		}
 	}
 }
 
+// cleanUpOldJobs deletes the jobs that finished before the retention, except
+// the children of unfinished bundles.
 func cleanUpOldJobs(retention time.Duration) {
 	now := time.Now()
-	jobs.JobsLock.Lock()
-	defer jobs.JobsLock.Unlock()
 
-	for jobID, job := range jobs.Jobs {
-		if job.Status == jobs.StatusCompleted && now.Sub(job.CompletedAt) > retention {
-			delete(jobs.Jobs, jobID)
-			glogger.Log.Infof("Job %s removed from Jobs map", jobID)
+	allJobs, err := jobs.ListJobs()
+	if err != nil {
+		glogger.Log.Error(err, "Failed to list jobs")
+		return
+	}
+
+	for _, job := range allJobs {
+		if job.Status.IsFinished() && now.Sub(job.CompletedAt) > retention && !jobs.IsJobInUse(job.ID) {
+			if err := jobs.DeleteJob(job.ID); err != nil {
+				glogger.Log.Errorf(err, "Failed to delete job %s", job.ID)
+				continue
+			}
+			glogger.Log.Infof("Job %s removed from job store", job.ID)
 		}
 	}
 }
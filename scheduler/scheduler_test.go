@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+)
+
+func TestCleanUpKeepsRenewedClips(t *testing.T) {
+	originalStore, originalClips := jobs.Store, storage.Clips
+	t.Cleanup(func() { jobs.Store, storage.Clips = originalStore, originalClips })
+
+	clipDir := t.TempDir()
+	jobs.Store = jobs.NewMemoryJobStore()
+	storage.Clips = storage.NewLocalStorage(clipDir)
+
+	retention := 5 * time.Minute
+	expired := time.Now().Add(-retention - time.Second)
+	completeExpired := func() (*jobs.Job, string) {
+		job, _ := jobs.NewSharedJob(jobs.JobRequest{}, "key")
+		key := job.ID + ".mp4"
+		path := filepath.Join(clipDir, key)
+		if err := os.WriteFile(path, []byte("clip"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, expired, expired)
+		jobs.CompleteJob(job.ID, key)
+		jobs.Store.Update(job.ID, func(job *jobs.Job) { job.CompletedAt = expired })
+		return job, path
+	}
+
+	reused, reusedPath := completeExpired()
+	stale, stalePath := completeExpired()
+	if !jobs.RenewCompletedJob(reused.ID) {
+		t.Fatal("Expected the completed job to be renewed")
+	}
+
+	cleanUpOldClips(retention)
+	cleanUpOldJobs(retention)
+
+	if _, err := os.Stat(reusedPath); err != nil {
+		t.Errorf("Expected the clip handed out again to be kept, got %v", err)
+	}
+	if _, exists := jobs.GetJobById(reused.ID); !exists {
+		t.Error("Expected the renewed job to be kept")
+	}
+	if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+		t.Errorf("Expected the expired clip to be deleted, got %v", err)
+	}
+	if _, exists := jobs.GetJobById(stale.ID); exists {
+		t.Error("Expected the expired job to be deleted")
+	}
+}
@@ -1,4 +1,4 @@
-import { hideProgressBar, enableClipButton, showDownloadLink } from './ui.js';
+import { hideProgressBar, enableClipButton, showDownloadLink, setProgress } from './ui.js';
 
 // Function to create request options
 function createRequestOptions(options = {}) {
@@ -20,7 +20,7 @@ export async function fetchAndPopulateFormats(url, dropdown) {
     try {
         const requestOptions = createRequestOptions();
         const response = await fetch(`/api/v1/video/formats?youtubeUrl=${encodeURIComponent(url)}`, requestOptions);
-        if (!response.ok) throw new Error(await response.text());
+        if (!response.ok) throw new Error(await errorMessageFrom(response));
 
         const formats = await response.json();
         populateDropdown(formats, dropdown);
@@ -30,19 +30,48 @@ export async function fetchAndPopulateFormats(url, dropdown) {
     }
 }
 
+export async function getVideoInfo(youtubeUrl) {
+    const url = `/api/v1/video/info?youtubeUrl=${encodeURIComponent(youtubeUrl)}`;
+    const response = await fetch(url, createRequestOptions());
+    if (response.ok) return await response.json();
+    throw new Error(await errorMessageFrom(response, 'Failed to fetch video info'));
+}
+
 export async function getVideoDuration(youtubeUrl) {
     const url = `/api/v1/video/duration?youtubeUrl=${encodeURIComponent(youtubeUrl)}`;
     const requestOptions = createRequestOptions();
     const response = await fetch(url, requestOptions);
     if (response.ok) return await response.text();
-    throw new Error('Failed to fetch video duration');
+    throw new Error(await errorMessageFrom(response, 'Failed to fetch video duration'));
+}
+
+// fetchAndPopulatePresets fills the preset dropdown with the presets the
+// server is configured with.
+export async function fetchAndPopulatePresets(dropdown) {
+    const response = await fetch('/api/v1/presets', createRequestOptions());
+    if (!response.ok) throw new Error(await errorMessageFrom(response, 'Failed to fetch presets'));
+
+    const presets = await response.json();
+    presets.forEach(preset => {
+        const option = document.createElement('option');
+        option.value = preset.id;
+        option.textContent = preset.name;
+        if (preset.description) option.title = preset.description;
+        dropdown.appendChild(option);
+    });
+}
+
+// errorMessageFrom returns the user-facing message of an API error response.
+export async function errorMessageFrom(response, fallback = 'An unexpected error occurred') {
+    const body = await response.json().catch(() => null);
+    return (body && body.error) || fallback;
 }
 
 function populateDropdown(formats, dropdown) {
     dropdown.innerHTML = "";
     const groups = {
         "Audio Only": formats.filter(f => f.formatType === "audio only"),
-        "Video Only": formats.filter(f => f.formatType === "video only"),
+        "Video (merged with best audio)": formats.filter(f => f.formatType === "video only"),
         "Audio and Video": formats.filter(f => f.formatType === "audio and video"),
     };
 
@@ -53,7 +82,22 @@ function populateDropdown(formats, dropdown) {
         items.forEach(format => {
             const option = document.createElement("option");
             option.value = format.id;
-            option.textContent = `${format.label} (${format.extension}, ${format.codec || 'N/A'}, ${format.bitrate || 'N/A'})`;
+            option.textContent = formatLabel(format);
+            group.appendChild(option);
+        });
+        dropdown.appendChild(group);
+    }
+
+    const source = animationSourceFormat(formats);
+    if (source) {
+        const group = document.createElement("optgroup");
+        group.label = "Animated";
+        [["gif", "GIF"], ["webp", "WebP"]].forEach(([output, label]) => {
+            const option = document.createElement("option");
+            option.value = `${output}:${source.id}`;
+            option.dataset.output = output;
+            option.dataset.source = source.id;
+            option.textContent = `${label} (480px, 15 fps, from ${source.height}p)`;
             group.appendChild(option);
         });
         dropdown.appendChild(group);
@@ -61,48 +105,120 @@ function populateDropdown(formats, dropdown) {
     dropdown.disabled = false;
 }
 
+// animationSourceFormat picks the smallest video format that is at least as
+// wide as the animation, so GIFs and WebPs are not made from 4K downloads.
+function animationSourceFormat(formats) {
+    const videos = formats.filter(f => f.formatType !== "audio only" && f.width).sort((a, b) => a.width - b.width);
+    return videos.find(f => f.width >= 480) || videos[videos.length - 1];
+}
+
+function formatLabel(format) {
+    const resolution = format.height ? `${format.height}p${format.fps > 30 ? Math.round(format.fps) : ''}` : (format.note || format.id);
+    const codec = format.formatType === "audio only" ? format.acodec : format.vcodec;
+    const bitrate = format.tbr ? `${Math.round(format.tbr)}k` : 'N/A';
+    return `${resolution} (${format.extension}, ${codec || 'N/A'}, ${bitrate})`;
+}
+
+// watchedJobId is the job whose updates the UI shows. Cancelling stops
+// watching, since a job shared with identical requests keeps running.
+let watchedJobId = null;
+
+// watchJob follows a job over Server-Sent Events and falls back to polling
+// /api/v2/jobs/{id} when the browser or server does not support them.
+export function watchJob(jobId) {
+  watchedJobId = jobId;
+  if (!window.EventSource) {
+    getJobStatus(jobId);
+    return;
+  }
+
+  let receivedEvent = false;
+  const source = new EventSource(`/api/v1/jobs/${encodeURIComponent(jobId)}/events`);
+
+  source.addEventListener("job", (event) => {
+    receivedEvent = true;
+    const job = JSON.parse(event.data);
+    if (jobId !== watchedJobId || !handleJobUpdate(job)) source.close();
+  });
+
+  source.onerror = () => {
+    if (source.readyState === EventSource.CLOSED || !receivedEvent) {
+      source.close();
+      getJobStatus(jobId);
+    }
+  };
+}
+
+// handleJobUpdate updates the UI for a v2 job status document and returns
+// whether the job is still running.
+function handleJobUpdate(job) {
+  switch (job.status) {
+    case "queued":
+    case "processing":
+      if (job.progress) setProgress(job.progress);
+      return true;
+    case "completed":
+      onJobCompleted(job.downloadUrl, job.result);
+      return false;
+    case "error":
+      onJobFailed(job.error);
+      return false;
+    default:
+      return false;
+  }
+}
+
+function onJobCompleted(downloadUrl, result) {
+  if (result && result.sizeInBytes) {
+    const size = (result.sizeInBytes / (1024 * 1024)).toFixed(1);
+    toastr.info(result.bitrateInKbps ? `${size} MB at ${result.bitrateInKbps} kbit/s` : `${size} MB`, "Clip ready");
+  }
+  hideProgressBar();
+  showDownloadLink(downloadUrl);
+  window.open(downloadUrl);
+  enableClipButton();
+}
+
+function onJobFailed(error) {
+  toastr.error(
+    (error && error.message) || "An error occurred when downloading the clip. Please try again in a few minutes or use the contact form.",
+    "Download Error"
+  );
+  enableClipButton();
+  hideProgressBar();
+}
+
 export async function getJobStatus(jobId){
-  const url = window.location.href + "api/v1/jobs/status?jobId=" + jobId;
+  if (jobId !== watchedJobId) return;
   try {
-    const res = await fetch(url, { method: "GET" });
-    switch (res.status) {
-      case 200:
-        const result = await res.text();
-        hideProgressBar();
-        const downloadUrl = "/api/v1/clip?jobId=" + jobId;
-        showDownloadLink(downloadUrl);
-        window.open(downloadUrl);
-        enableClipButton();
-        break;
-      case 201:
-        setTimeout(() => getJobStatus(jobId), 2000);
-        break;
-      case 408:
-        toastr.error(
-          "The download timed out. Please try again in a few minutes or use the contact form.",
-          "Download Timeout"
-        );
-        enableClipButton();
-        hideProgressBar();
-        break;
-      case 500:
-        toastr.error(
-          "An error occurred when downloading the clip. Please try again in a few minutes or use the contact form.",
-          "Download Error"
-        );
-        enableClipButton();
-        hideProgressBar();
-        break;
-      default:
-        toastr.error(
-          "An error occurred when retrieving the job status. Please try again in a few minutes or use the contact form.",
-          "Unknown Error"
-        );
-        enableClipButton();
-        break;
+    const res = await fetch(`/api/v2/jobs/${encodeURIComponent(jobId)}`, { method: "GET" });
+    if (!res.ok) {
+      toastr.error(
+        "An error occurred when retrieving the job status. Please try again in a few minutes or use the contact form.",
+        "Unknown Error"
+      );
+      enableClipButton();
+      hideProgressBar();
+      return;
+    }
+
+    const job = await res.json();
+    if (handleJobUpdate(job)) {
+      setTimeout(() => getJobStatus(jobId), 2000);
     }
   } catch (error) {
     console.error("CLIENT - GETJOBSTATUS - An error occurred:", error);
     enableClipButton();
   }
 };
+
+
+export async function cancelJob(jobId, requesterToken) {
+  watchedJobId = null;
+  const headers = requesterToken ? { "X-Requester-Token": requesterToken } : {};
+  const response = await fetch(`/api/v1/jobs/${encodeURIComponent(jobId)}`, { method: "DELETE", headers });
+  if (!response.ok) {
+    const body = await response.json().catch(() => ({}));
+    throw new Error(body.error || "Failed to cancel job");
+  }
+}
@@ -1,6 +1,12 @@
 import { debounce, isYoutubeUrlValid, isTimeInputValid, normalizeTimeToHHMMSS } from './utils.js';
-import { fetchAndPopulateFormats, getVideoDuration, getJobStatus } from './api.js';
-import { disableDropdown, showProgressBar, hideProgressBar, enableClipButton, disableClipButton, isVideoPlayerVisible, showVideoPlayer, hideVideoPlayer } from './ui.js';
+import { fetchAndPopulateFormats, fetchAndPopulatePresets, getVideoInfo, watchJob, cancelJob, errorMessageFrom } from './api.js';
+import { disableDropdown, updateCropFrame, getCropOffset, showProgressBar, hideProgressBar, enableClipButton, disableClipButton, isVideoPlayerVisible, showVideoPlayer, hideVideoPlayer, showVideoInfo, hideVideoInfo } from './ui.js';
+
+let currentJobId = null;
+// currentRequesterToken withdraws this request from a job shared with
+// identical requests, without cancelling it for the others.
+let currentRequesterToken = null;
+let segments = [];
 
 const onUrlInputChange = debounce(async (event) => {
     const url = event.target.value;
@@ -8,9 +14,17 @@ const onUrlInputChange = debounce(async (event) => {
     if (!isYoutubeUrlValid(url)) {
         toastr.error("Please enter a valid YouTube URL");
         disableDropdown(dropdown);
+        hideVideoInfo();
         return;
     }
 
+    getVideoInfo(url)
+        .then(showVideoInfo)
+        .catch(err => {
+            hideVideoInfo();
+            console.error("CLIENT - GETVIDEOINFO - An error occurred:", err);
+        });
+
     try {
         await fetchAndPopulateFormats(url, dropdown);
     } catch (err) {
@@ -20,6 +34,136 @@ const onUrlInputChange = debounce(async (event) => {
 
 document.getElementById("url").addEventListener("input", onUrlInputChange);
 
+const onChapterSelectChange = (event) => {
+    const option = event.target.selectedOptions[0];
+    const allChapters = option && option.value === "all";
+    document.getElementById("from").disabled = allChapters;
+    document.getElementById("to").disabled = allChapters;
+    if (!option || !option.value || allChapters) return;
+
+    document.getElementById("from").value = option.dataset.from;
+    document.getElementById("to").value = option.dataset.to;
+};
+
+// chapterPayload returns the chapter selection of the clip request, or null
+// if the user edited the time range after picking a chapter.
+function chapterPayload(from, to) {
+    const option = document.getElementById("chapterSelect").selectedOptions[0];
+    if (!option || !option.value) return null;
+    if (option.value === "all") return { allChapters: true };
+    if (option.dataset.from !== normalizeTimeToHHMMSS(from) || option.dataset.to !== normalizeTimeToHHMMSS(to)) return null;
+    return { chapterIndex: Number(option.value) };
+}
+
+// outputPayload turns an output option such as "mp3:192" (bitrate) or
+// "mp4@8" (target size in MB) into the output of the clip request, or
+// undefined to keep the downloaded format.
+function outputPayload(value) {
+    if (!value) return undefined;
+    const [format, targetSizeInMb] = value.split("@");
+    if (targetSizeInMb) return { format, targetSizeInMb: Number(targetSizeInMb) };
+    const [audioFormat, bitrate] = value.split(":");
+    return bitrate ? { format: audioFormat, bitrate: Number(bitrate) } : { format: audioFormat };
+}
+
+// reframePayload adds the reframing options to the output of the clip
+// request. Reframing re-encodes the video, so a kept format becomes an MP4.
+function reframePayload(output) {
+    const aspectRatio = document.getElementById("aspectRatioSelect").value;
+    if (!aspectRatio || (output && output.format !== "mp4")) return output;
+
+    const cropMode = document.getElementById("cropModeSelect").value;
+    const reframe = { aspectRatio, cropMode };
+    if (cropMode === "offset") reframe.cropOffset = getCropOffset();
+    return { ...(output || { format: "mp4" }), ...reframe };
+}
+
+const onReframeChange = () => {
+    const aspectRatio = document.getElementById("aspectRatioSelect").value;
+    document.getElementById("cropModeSelect").disabled = !aspectRatio;
+    updateCropFrame(aspectRatio, document.getElementById("cropModeSelect").value);
+};
+
+document.getElementById("aspectRatioSelect").addEventListener("change", onReframeChange);
+document.getElementById("cropModeSelect").addEventListener("change", onReframeChange);
+
+// Reframing only applies to video, not to audio or animated outputs.
+document.getElementById("outputSelect").addEventListener("change", (event) => {
+    const video = !event.target.value || event.target.value.startsWith("mp4");
+    document.getElementById("aspectRatioSelect").disabled = !video;
+});
+
+// subtitlesPayload returns the subtitles of the clip request, or undefined
+// if none are selected.
+function subtitlesPayload() {
+    const value = document.getElementById("subtitleSelect").value;
+    if (!value) return undefined;
+
+    const automatic = value.startsWith("auto:");
+    const [mode, format] = document.getElementById("subtitleModeSelect").value.split(":");
+    return { language: automatic ? value.slice("auto:".length) : value, automatic, mode, format };
+}
+
+document.getElementById("subtitleSelect").addEventListener("change", (event) => {
+    document.getElementById("subtitleModeSelect").disabled = !event.target.value;
+});
+
+document.getElementById("chapterSelect").addEventListener("change", onChapterSelectChange);
+
+// renderSegments lists the segments the clip is joined from; a crossfade
+// needs at least two of them.
+function renderSegments() {
+    const list = document.getElementById("segmentList");
+    list.replaceChildren(...segments.map((segment, index) => {
+        const item = document.createElement("li");
+        item.textContent = `${segment.from} → ${segment.to}`;
+        const remove = document.createElement("button");
+        remove.className = "text-button";
+        remove.type = "button";
+        remove.textContent = "×";
+        remove.setAttribute("aria-label", "Remove segment");
+        remove.addEventListener("click", () => {
+            segments.splice(index, 1);
+            renderSegments();
+        });
+        item.appendChild(remove);
+        return item;
+    }));
+    list.classList.toggle("hidden", segments.length === 0);
+    document.getElementById("crossfadeSelect").disabled = segments.length < 2;
+}
+
+document.getElementById("addSegmentButton").addEventListener("click", () => {
+    const from = document.getElementById("from").value;
+    const to = document.getElementById("to").value;
+    if (!isTimeInputValid(from) || !isTimeInputValid(to)) {
+        toastr.error("Enter the time range of the segment first.");
+        return;
+    }
+
+    segments.push({ from: normalizeTimeToHHMMSS(from), to: normalizeTimeToHHMMSS(to) });
+    renderSegments();
+});
+
+// Animated formats have no audio, so the output option does not apply.
+document.getElementById("formatSelect").addEventListener("change", (event) => {
+    const option = event.target.selectedOptions[0];
+    document.getElementById("outputSelect").disabled = Boolean(option && option.dataset.output);
+});
+
+// A preset picks the format and output on the server.
+document.getElementById("presetSelect").addEventListener("change", (event) => {
+    const preset = Boolean(event.target.value);
+    const formatOption = document.getElementById("formatSelect").selectedOptions[0];
+    document.getElementById("outputSelect").disabled = preset || Boolean(formatOption && formatOption.dataset.output);
+    document.getElementById("noAudio").disabled = preset;
+    document.getElementById("aspectRatioSelect").disabled = preset;
+    document.getElementById("format-wrapper").classList.toggle("hidden", preset);
+});
+
+fetchAndPopulatePresets(document.getElementById("presetSelect"))
+    .catch(err => console.error("CLIENT - GETPRESETS - An error occurred:", err));
+
 const onClipButtonClick = async () => {
     disableClipButton();
     hideProgressBar();
@@ -28,51 +172,135 @@ const onClipButtonClick = async () => {
     const url = document.getElementById("url").value;
     const from = document.getElementById("from").value;
     const to = document.getElementById("to").value;
-    const format = document.getElementById("formatSelect").value;
+    const formatOption = document.getElementById("formatSelect").selectedOptions[0];
+    const animated = formatOption && formatOption.dataset.output;
+    const format = animated ? formatOption.dataset.source : document.getElementById("formatSelect").value;
+    const preciseCut = document.getElementById("preciseCut").checked;
+    const noAudio = document.getElementById("noAudio").checked;
+    const output = animated ? { format: formatOption.dataset.output } : reframePayload(outputPayload(document.getElementById("outputSelect").value));
+    const preset = document.getElementById("presetSelect").value;
+    const selection = preset ? { preset } : { format, noAudio, output };
+    const subtitles = subtitlesPayload();
+    const chapter = chapterPayload(from, to);
 
-    if (!isYoutubeUrlValid(url) || !isTimeInputValid(from) || !isTimeInputValid(to) || !format) {
-        toastr.error("Invalid input. Check the URL, timestamps, and format.");
-        enableClipButton();
+    if (segments.length > 0) {
+        if (!isYoutubeUrlValid(url) || !(preset || format)) {
+            toastr.error("Invalid input. Check the URL and format.");
+            enableClipButton();
+            return;
+        }
+        const crossfade = document.getElementById("crossfadeSelect").value;
+        const crossfadeInSeconds = segments.length > 1 && crossfade ? Number(crossfade) : undefined;
+        showProgressBar();
+        await submitClip({ url, segments, crossfadeInSeconds, preciseCut, ...selection, subtitles });
         return;
     }
 
-    try {
-        const videoDuration = await getVideoDuration(url);
-        if (normalizeTimeToHHMMSS(from) > videoDuration || normalizeTimeToHHMMSS(to) > videoDuration) {
-            toastr.error("Timestamps exceed video duration.");
+    if (chapter) {
+        if (!isYoutubeUrlValid(url) || !(preset || format)) {
+            toastr.error("Invalid input. Check the URL and format.");
             enableClipButton();
             return;
         }
-
         showProgressBar();
-        const payload = { url, from: normalizeTimeToHHMMSS(from), to: normalizeTimeToHHMMSS(to), format };
-        const response = await fetch("/api/v1/clip", { method: "POST", body: JSON.stringify(payload), headers: { "Content-Type": "application/json" } });
+        submitClip({ url, preciseCut, ...selection, subtitles, ...chapter });
+        return;
+    }
+
+    if (!isYoutubeUrlValid(url) || !isTimeInputValid(from) || !isTimeInputValid(to) || !(preset || format)) {
+        toastr.error("Invalid input. Check the URL, timestamps, and format.");
+        enableClipButton();
+        return;
+    }
+
+    // The server checks the range against the video duration and the clip
+    // length limits and answers with a message for the user.
+    showProgressBar();
+    await submitClip({ url, from: normalizeTimeToHHMMSS(from), to: normalizeTimeToHHMMSS(to), preciseCut, ...selection, subtitles });
+};
+
+async function submitClip(payload) {
+    await submitJob("/api/v1/clip", { method: "POST", body: JSON.stringify(payload), headers: { "Content-Type": "application/json" } });
+}
+
+// submitJob creates a clip or batch job and follows it until its file is
+// downloaded.
+async function submitJob(url, options) {
+    try {
+        const response = await fetch(url, options);
         
          switch (response.status) {
+      case 200:
       case 201:
+        // 200 answers with the job of an identical request made before.
         toastr.success(
           "The download will pop up automatically. This may take a few seconds.",
-          "Download Started"
+          response.status === 200 ? "Clip Already Requested" : "Download Started"
         );
         showProgressBar();
         const jobId = await response.text();
-        getJobStatus(jobId);
+        currentJobId = jobId;
+        currentRequesterToken = response.headers.get("X-Requester-Token");
+        watchJob(jobId);
         break;
-      case 500:
-        toastr.error("Timestamps are not within video length.");
+      case 503:
+        const retryAfter = response.headers.get("Retry-After");
+        toastr.warning(
+          `Too many clips are being processed. Please try again${retryAfter ? ` in ${retryAfter} seconds` : " later"}.`,
+          "Server Busy"
+        );
+        hideProgressBar();
+        enableClipButton();
         break;
       default:
-        toastr.error("An unexpected error occurred.");
+        toastr.error(await errorMessageFrom(response));
+        hideProgressBar();
+        enableClipButton();
         break;
     }
         
     } catch (err) {
         toastr.error("Failed to create clip: " + err.message);
+        hideProgressBar();
+        enableClipButton();
     }
-};
+}
 
 document.getElementById("clipButton").addEventListener("click", onClipButtonClick);
 
+// A batch file lists the clips itself; the server answers with a parent job
+// that completes with a zip of all clips.
+document.getElementById("batchFile").addEventListener("change", async (event) => {
+    const file = event.target.files[0];
+    event.target.value = "";
+    if (!file) return;
+
+    disableClipButton();
+    toastr.success("Batch processing started.");
+    showProgressBar();
+    const body = new FormData();
+    body.append("file", file);
+    await submitJob("/api/v1/clips/batch", { method: "POST", body });
+});
+
+const onCancelButtonClick = async () => {
+  if (!currentJobId) return;
+
+  try {
+    await cancelJob(currentJobId, currentRequesterToken);
+    toastr.info("The clip was cancelled.", "Cancelled");
+  } catch (err) {
+    toastr.error(err.message, "Cancel Failed");
+  } finally {
+    currentJobId = null;
+    currentRequesterToken = null;
+    hideProgressBar();
+    enableClipButton();
+  }
+};
+
+document.getElementById("cancelButton").addEventListener("click", onCancelButtonClick);
+
 const onPreviewButtonClick = () => {
   const url = document.getElementById("url").value;
   if (!isYoutubeUrlValid(url)) {
@@ -1,3 +1,5 @@
+import { secondsToHHMMSS } from './utils.js';
+
 export function disableDropdown(dropdown) {
     dropdown.disabled = true;
     dropdown.innerHTML = '<option value="">Loading formats...</option>';
@@ -8,9 +10,99 @@ export function enableDropdown(dropdown) {
 }
 
 export function showProgressBar() {
+    resetProgress();
     document.getElementById("progressBarWrapper").classList.remove("hidden");
 }
 
+export function setProgress(progress) {
+    const bar = document.getElementById("progressBar");
+    bar.classList.add("progress-bar-determinate");
+    bar.style.width = `${Math.round(progress.percent)}%`;
+
+    const labels = { download: "Downloading", encode: "Cutting", convert: "Converting", bundle: "Clipping chapters" };
+    const label = labels[progress.stage] || "Processing";
+    const eta = progress.eta > 0 ? `, ${progress.eta}s left` : "";
+    document.getElementById("progress").setAttribute("aria-valuenow", Math.round(progress.percent));
+    document.getElementById("progress").title = `${label}: ${Math.round(progress.percent)}%${eta}`;
+}
+
+function resetProgress() {
+    const bar = document.getElementById("progressBar");
+    bar.classList.remove("progress-bar-determinate");
+    bar.style.width = "";
+    document.getElementById("progress").removeAttribute("aria-valuenow");
+    document.getElementById("progress").title = "";
+}
+
+export function showVideoInfo(info) {
+    document.getElementById("videoThumbnail").src = info.thumbnail || "";
+    document.getElementById("videoTitle").textContent = info.title;
+    document.getElementById("videoTitle").title = info.title;
+
+    const meta = [info.channel, info.uploadDate, info.isLive ? "Live" : secondsToHHMMSS(info.duration)];
+    document.getElementById("videoMeta").textContent = meta.filter(Boolean).join(" · ");
+    document.getElementById("videoInfo").classList.remove("hidden");
+
+    const chapterSelect = document.getElementById("chapterSelect");
+    resetChapterSelect();
+    info.chapters.forEach(chapter => {
+        const option = document.createElement("option");
+        option.value = chapter.index;
+        option.textContent = `${secondsToHHMMSS(chapter.startTime)} ${chapter.title}`;
+        option.dataset.from = secondsToHHMMSS(chapter.startTime);
+        option.dataset.to = secondsToHHMMSS(chapter.endTime);
+        chapterSelect.appendChild(option);
+    });
+    if (info.chapters.length > 1) {
+        const allOption = document.createElement("option");
+        allOption.value = "all";
+        allOption.textContent = `All ${info.chapters.length} chapters (zip)`;
+        chapterSelect.appendChild(allOption);
+    }
+    document.getElementById("chapterField").classList.toggle("hidden", info.chapters.length === 0);
+
+    resetSubtitleSelect();
+    addSubtitleOptions("Subtitles", info.subtitleLanguages, "");
+    addSubtitleOptions("Auto-generated", info.automaticCaptionLanguages, "auto:");
+    const hasSubtitles = info.subtitleLanguages.length + info.automaticCaptionLanguages.length > 0;
+    document.getElementById("subtitleField").classList.toggle("hidden", !hasSubtitles);
+}
+
+// addSubtitleOptions lists subtitle languages; auto-generated captions are
+// prefixed with "auto:".
+function addSubtitleOptions(label, languages, prefix) {
+    if (languages.length === 0) return;
+
+    const group = document.createElement("optgroup");
+    group.label = label;
+    languages.forEach(language => {
+        const option = document.createElement("option");
+        option.value = prefix + language;
+        option.textContent = language;
+        group.appendChild(option);
+    });
+    document.getElementById("subtitleSelect").appendChild(group);
+}
+
+function resetSubtitleSelect() {
+    document.getElementById("subtitleSelect").innerHTML = '<option value="">No subtitles</option>';
+    document.getElementById("subtitleModeSelect").disabled = true;
+}
+
+export function hideVideoInfo() {
+    document.getElementById("videoInfo").classList.add("hidden");
+    document.getElementById("chapterField").classList.add("hidden");
+    document.getElementById("subtitleField").classList.add("hidden");
+    resetChapterSelect();
+    resetSubtitleSelect();
+}
+
+function resetChapterSelect() {
+    document.getElementById("chapterSelect").innerHTML = '<option value="">Custom time range</option>';
+    document.getElementById("from").disabled = false;
+    document.getElementById("to").disabled = false;
+}
+
 export function hideProgressBar() {
     document.getElementById("progressBarWrapper").classList.add("hidden");
 }
@@ -40,6 +132,50 @@ export function hideVideoPlayer (){
 export function  isVideoPlayerVisible() {
   !document.getElementById("videoPlayerWrapper").classList.contains("hidden")}
 
+// updateCropFrame shows the part of the preview that a manual crop keeps. The
+// preview is 16:9, so the frame is as wide as the aspect ratio allows at its
+// full height.
+export function updateCropFrame(aspectRatio, cropMode) {
+  const frame = document.getElementById("cropFrame");
+  const manual = Boolean(aspectRatio) && cropMode === "offset";
+  frame.classList.toggle("hidden", !manual);
+  document.getElementById("cropHint").classList.toggle("hidden", !manual);
+  if (!manual) return;
+
+  const [width, height] = aspectRatio.split(":").map(Number);
+  frame.style.width = `${Math.min(1, (9 / 16) * (width / height)) * 100}%`;
+  setCropOffset(getCropOffset());
+}
+
+export function getCropOffset() {
+  const offset = Number(document.getElementById("cropFrame").dataset.offset);
+  return isNaN(offset) ? 0.5 : offset;
+}
+
+function setCropOffset(offset) {
+  const frame = document.getElementById("cropFrame");
+  frame.dataset.offset = offset.toFixed(3);
+  frame.style.left = `calc((100% - ${frame.style.width}) * ${offset})`;
+}
+
+function onCropFrameDrag(event) {
+  const frame = document.getElementById("cropFrame");
+  const wrapper = document.getElementById("videoPlayerWrapper").getBoundingClientRect();
+  const free = wrapper.width - frame.getBoundingClientRect().width;
+  if (free <= 0) return;
+
+  const left = event.clientX - wrapper.left - frame.getBoundingClientRect().width / 2;
+  setCropOffset(Math.min(1, Math.max(0, left / free)));
+}
+
+document.getElementById("cropFrame").addEventListener("pointerdown", (event) => {
+  event.target.setPointerCapture(event.pointerId);
+  event.target.addEventListener("pointermove", onCropFrameDrag);
+});
+document.getElementById("cropFrame").addEventListener("pointerup", (event) => {
+  event.target.removeEventListener("pointermove", onCropFrameDrag);
+});
+
 export function showDownloadLink(downloadUrl){
   const downloadLinkUrlWrapper = document.getElementById("downloadLinkWrapper");
   const downloadLink = document.getElementById("downloadLink");
@@ -15,7 +15,7 @@ export function timeObjectToSeconds(time){
     if (parts.length < 1 || parts.length > 3) return false;
   
     const seconds = parts.pop();
-    if (seconds < 0 || seconds > 59 || isNaN(seconds)) return false;
+    if (seconds < 0 || seconds >= 60 || isNaN(seconds)) return false;
   
     if (parts.length > 0) {
       const minutes = parts.pop();
@@ -50,7 +50,17 @@ export function getTimeAsObject(time){
 export function normalizeTimeToHHMMSS(time){
   const { hours, minutes, seconds } = getTimeAsObject(time);
   const pad = (num) => String(num).padStart(2, "0"); 
-  return `${pad(hours)}:${pad(minutes)}:${pad(seconds)}`
+  const milliseconds = Math.round((seconds % 1) * 1000);
+  const fraction = milliseconds > 0 ? `.${String(milliseconds).padStart(3, "0")}` : "";
+  return `${pad(hours)}:${pad(minutes)}:${pad(Math.floor(seconds))}${fraction}`
+}
+
+export function secondsToHHMMSS(totalSeconds){
+  const milliseconds = Math.round((totalSeconds || 0) * 1000);
+  const seconds = Math.floor(milliseconds / 1000);
+  const pad = (num) => String(num).padStart(2, "0");
+  const fraction = milliseconds % 1000 > 0 ? `.${String(milliseconds % 1000).padStart(3, "0")}` : "";
+  return `${pad(Math.floor(seconds / 3600))}:${pad(Math.floor(seconds / 60) % 60)}:${pad(seconds % 60)}${fraction}`;
 }
 
 export function convertToSeconds(timeString){
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage(t *testing.T) {
+	testStorage(t, NewLocalStorage(filepath.Join(t.TempDir(), "videos")))
+}
+
+func TestLocalStorageMovesFilesIntoItsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocalStorage(dir)
+
+	path := filepath.Join(dir, "job.mp4")
+	if err := os.WriteFile(path, []byte("clip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PutFile(context.Background(), s, "job.mp4", path); err != nil {
+		t.Fatalf("Expected a file already in the directory to stay, got %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "clip" {
+		t.Errorf("Expected the file to be kept, got %q, %v", data, err)
+	}
+}
+
+func TestLocalStorageRejectsKeysOutsideItsDirectory(t *testing.T) {
+	s := NewLocalStorage(t.TempDir())
+
+	for _, key := range []string{"", "..", "../job.mp4", "videos/job.mp4", `..\job.mp4`} {
+		if err := s.Put(context.Background(), key, strings.NewReader("clip"), 4); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+}
+
+func TestLocalStorageCannotPresign(t *testing.T) {
+	_, err := NewLocalStorage(t.TempDir()).Presign(context.Background(), "job.mp4", time.Minute)
+	if !errors.Is(err, ErrPresignNotSupported) {
+		t.Errorf("Expected ErrPresignNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"ytclipper-go/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage keeps objects in a bucket of an S3-compatible object store, such
+// as AWS S3 or MinIO, under an optional key prefix.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Storage connects lazily; CheckBucket verifies the configuration. The
+// endpoint is a host with an optional port, or a URL whose scheme overrides
+// S3UseSSL. Without an access key, credentials are read from the AWS_*
+// environment variables or the instance role.
+func NewS3Storage(storageConfig config.StorageConfig) (*S3Storage, error) {
+	if storageConfig.S3Bucket == "" {
+		return nil, fmt.Errorf("the s3 storage needs a bucket")
+	}
+
+	endpoint, secure := storageConfig.S3Endpoint, storageConfig.S3UseSSL
+	if strings.Contains(endpoint, "://") {
+		endpointUrl, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 endpoint %q: %w", endpoint, err)
+		}
+		endpoint, secure = endpointUrl.Host, endpointUrl.Scheme == "https"
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{&credentials.EnvAWS{}, &credentials.IAM{}})
+	if storageConfig.S3AccessKeyID != "" {
+		creds = credentials.NewStaticV4(storageConfig.S3AccessKeyID, storageConfig.S3SecretAccessKey, "")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: storageConfig.S3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(storageConfig.S3Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Storage{client: client, bucket: storageConfig.S3Bucket, prefix: prefix}, nil
+}
+
+// CheckBucket fails if the bucket does not exist or cannot be accessed.
+func (s *S3Storage) CheckBucket(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("could not access bucket %s: %w", s.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+	})
+	return err
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	// GetObject does not send a request until the object is read, so a missing
+	// object is only noticed by Stat.
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s3Error(err)
+	}
+	return ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s3Error(s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, s3Error(info.Err)
+		}
+		objects = append(objects, ObjectInfo{Key: strings.TrimPrefix(info.Key, s.prefix), Size: info.Size, ModTime: info.LastModified})
+	}
+	return objects, nil
+}
+
+func (s *S3Storage) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	presignedUrl, err := s.client.PresignedGetObject(ctx, s.bucket, s.prefix+key, expiry, nil)
+	if err != nil {
+		return "", s3Error(err)
+	}
+	return presignedUrl.String(), nil
+}
+
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" || response.StatusCode == http.StatusNotFound && response.Code != "NoSuchBucket" {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"ytclipper-go/config"
+)
+
+// TestS3Storage runs against an S3-compatible server, e.g. a local MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	YTCLIPPER_TEST_S3_ENDPOINT=http://localhost:9000 YTCLIPPER_TEST_S3_BUCKET=clips go test ./storage
+//
+// The bucket must exist. Credentials default to those of a fresh MinIO.
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("YTCLIPPER_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("YTCLIPPER_TEST_S3_ENDPOINT is not set")
+	}
+
+	s, err := NewS3Storage(config.StorageConfig{
+		S3Endpoint:        endpoint,
+		S3Region:          config.GetEnv("YTCLIPPER_TEST_S3_REGION", "us-east-1"),
+		S3Bucket:          config.GetEnv("YTCLIPPER_TEST_S3_BUCKET", "clips"),
+		S3Prefix:          "ytclipper-test",
+		S3AccessKeyID:     config.GetEnv("YTCLIPPER_TEST_S3_ACCESS_KEY_ID", "minioadmin"),
+		S3SecretAccessKey: config.GetEnv("YTCLIPPER_TEST_S3_SECRET_ACCESS_KEY", "minioadmin"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckBucket(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	testStorage(t, s)
+
+	ctx := context.Background()
+	if err := s.Put(ctx, "presigned.mp4", strings.NewReader("clip"), 4); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete(ctx, "presigned.mp4")
+
+	presigned, err := s.Presign(ctx, "presigned.mp4", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Get(presigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	data, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || string(data) != "clip" {
+		t.Errorf("Expected the presigned URL to download the clip, got %d %q", response.StatusCode, data)
+	}
+}
+
+func TestS3StoragePresign(t *testing.T) {
+	s, err := NewS3Storage(config.StorageConfig{
+		S3Endpoint:        "http://localhost:9000",
+		S3Region:          "us-east-1",
+		S3Bucket:          "clips",
+		S3Prefix:          "/ytclipper/",
+		S3AccessKeyID:     "access",
+		S3SecretAccessKey: "secret",
+		S3UseSSL:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With a known region, presigning is done locally without a request.
+	presigned, err := s.Presign(context.Background(), "job.mp4", 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presignedUrl, err := url.Parse(presigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if presignedUrl.Scheme != "http" || presignedUrl.Host != "localhost:9000" || presignedUrl.Path != "/clips/ytclipper/job.mp4" {
+		t.Errorf("Expected a path-style URL of the prefixed key, got %s", presigned)
+	}
+	query := presignedUrl.Query()
+	if query.Get("X-Amz-Expires") != "900" || query.Get("X-Amz-Signature") == "" {
+		t.Errorf("Expected a signed URL valid for 15 minutes, got %s", presigned)
+	}
+}
+
+func TestNewS3StorageNeedsBucket(t *testing.T) {
+	if _, err := NewS3Storage(config.StorageConfig{S3Endpoint: "localhost:9000"}); err == nil {
+		t.Error("Expected an error without a bucket")
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"ytclipper-go/config"
+)
+
+var (
+	ErrNotFound            = errors.New("object not found")
+	ErrPresignNotSupported = errors.New("storage cannot presign URLs")
+)
+
+// ObjectInfo describes a stored object. Keys are flat file names such as
+// "<jobID>.mp4".
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage keeps finished clips. Implementations must be safe for concurrent
+// use and return ErrNotFound for missing keys, except from Delete, which
+// succeeds for missing keys.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Presign returns a URL that downloads the object without credentials
+	// until expiry, or ErrPresignNotSupported.
+	Presign(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Clips is the storage finished clips are kept in. It defaults to the local
+// clip directory; main replaces it according to the configuration.
+var Clips Storage = NewLocalStorage("./videos/")
+
+func NewStorage(storageConfig config.StorageConfig) (Storage, error) {
+	switch storageConfig.Type {
+	case "", config.STORAGE_TYPE_LOCAL:
+		return NewLocalStorage(storageConfig.Path), nil
+	case config.STORAGE_TYPE_S3:
+		s3, err := NewS3Storage(storageConfig)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return s3, s3.CheckBucket(ctx)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", storageConfig.Type)
+	}
+}
+
+// fileMover is implemented by storages that can take over a local file
+// without copying it.
+type fileMover interface {
+	moveFile(key string, path string) error
+}
+
+// PutFile stores the local file at path under key and removes the file.
+func PutFile(ctx context.Context, s Storage, key string, path string) error {
+	if mover, ok := s.(fileMover); ok {
+		return mover.moveFile(key, path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, key, file, info.Size()); err != nil {
+		return err
+	}
+
+	file.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testStorage checks the behaviour every storage shares.
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "job-1.mp4", strings.NewReader("clip"), 4); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Put(ctx, "other.zip", strings.NewReader("zip"), 3); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	info, err := s.Stat(ctx, "job-1.mp4")
+	if err != nil || info.Key != "job-1.mp4" || info.Size != 4 || info.ModTime.IsZero() {
+		t.Errorf("Expected the stored object, got %+v, %v", info, err)
+	}
+
+	object, err := s.Open(ctx, "job-1.mp4")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := object.Seek(1, io.SeekStart); err != nil {
+		t.Errorf("Seek failed: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil || string(data) != "lip" {
+		t.Errorf("Expected the content after the offset, got %q, %v", data, err)
+	}
+
+	objects, err := s.List(ctx, "job-")
+	if err != nil || len(objects) != 1 || objects[0].Key != "job-1.mp4" {
+		t.Errorf("Expected one object with the prefix, got %+v, %v", objects, err)
+	}
+
+	if err := s.Delete(ctx, "job-1.mp4"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if err := s.Delete(ctx, "job-1.mp4"); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, got %v", err)
+	}
+	if _, err := s.Stat(ctx, "job-1.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Stat, got %v", err)
+	}
+	if _, err := s.Open(ctx, "job-1.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Open, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "job-2.mp4")
+	if err := os.WriteFile(path, []byte("clip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PutFile(ctx, s, "job-2.mp4", path); err != nil {
+		t.Fatalf("PutFile failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected PutFile to remove the local file, got %v", err)
+	}
+	if info, err := s.Stat(ctx, "job-2.mp4"); err != nil || info.Size != 4 {
+		t.Errorf("Expected the file to be stored, got %+v, %v", info, err)
+	}
+
+	s.Delete(ctx, "job-2.mp4")
+	s.Delete(ctx, "other.zip")
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -20,43 +21,57 @@ func CheckCommand(command string) error {
 	return nil
 }
 
-func ToSeconds(duration string) (int, error) {
+// ToSeconds parses HH:MM:SS, MM:SS and plain seconds. The seconds may have a
+// fractional part (00:01:02.500, 62.5).
+func ToSeconds(duration string) (float64, error) {
 	parts := strings.Split(duration, ":")
-	var totalSeconds int
+	if len(parts) > 3 {
+		return 0, errors.New("invalid duration format: must be HH:MM:SS, MM:SS, or SS")
+	}
 
-	if len(parts) == 3 {
-		hours, err := strconv.Atoi(parts[0])
-		if err != nil {
-			return 0, fmt.Errorf("invalid hours value: %v", err)
-		}
-		minutes, err := strconv.Atoi(parts[1])
-		if err != nil || minutes >= 60 {
-			return 0, fmt.Errorf("invalid minutes value: %v", err)
-		}
-		seconds, err := strconv.Atoi(parts[2])
-		if err != nil || seconds >= 60 {
-			return 0, fmt.Errorf("invalid seconds value: %v", err)
-		}
-		totalSeconds = hours*3600 + minutes*60 + seconds
-	} else if len(parts) == 2 {
-		minutes, err := strconv.Atoi(parts[0])
-		if err != nil || minutes >= 60 {
+	seconds, err := parseSeconds(parts[len(parts)-1])
+	if err != nil || (len(parts) > 1 && seconds >= 60) {
+		return 0, fmt.Errorf("invalid seconds value: %v", err)
+	}
+	totalSeconds := seconds
+
+	if len(parts) > 1 {
+		minutes, err := strconv.Atoi(parts[len(parts)-2])
+		if err != nil || minutes < 0 || minutes >= 60 {
 			return 0, fmt.Errorf("invalid minutes value: %v", err)
 		}
-		seconds, err := strconv.Atoi(parts[1])
-		if err != nil || seconds >= 60 {
-			return 0, fmt.Errorf("invalid seconds value: %v", err)
-		}
-		totalSeconds = minutes*60 + seconds
-	} else if len(parts) == 1 {
-		seconds, err := strconv.Atoi(parts[0])
-		if err != nil || seconds >= 60 {
-			return 0, fmt.Errorf("invalid seconds value: %v", err)
+		totalSeconds += float64(minutes * 60)
+	}
+
+	if len(parts) > 2 {
+		hours, err := strconv.Atoi(parts[0])
+		if err != nil || hours < 0 {
+			return 0, fmt.Errorf("invalid hours value: %v", err)
 		}
-		totalSeconds = seconds
-	} else {
-		return 0, errors.New("invalid duration format: must be HH:MM:SS, MM:SS, or SS")
+		totalSeconds += float64(hours * 3600)
 	}
 
 	return totalSeconds, nil
 }
+
+// parseSeconds accepts digits with an optional fractional part, unlike
+// strconv.ParseFloat, which also takes signs, exponents and "Inf".
+func parseSeconds(value string) (float64, error) {
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || strings.Trim(whole+fraction, "0123456789") != "" || strings.HasSuffix(value, ".") {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// FormatSeconds formats a number of seconds as HH:MM:SS, with milliseconds
+// (HH:MM:SS.mmm) if the value is not a whole second.
+func FormatSeconds(totalSeconds float64) string {
+	milliseconds := int64(math.Round(totalSeconds * 1000))
+	seconds := milliseconds / 1000
+	formatted := fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	if milliseconds%1000 != 0 {
+		formatted += fmt.Sprintf(".%03d", milliseconds%1000)
+	}
+	return formatted
+}
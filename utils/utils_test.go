@@ -7,7 +7,7 @@ import (
 func TestToSeconds(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int
+		expected float64
 		hasError bool
 	}{
 		{"00:00:30", 30, false},
@@ -15,9 +15,15 @@ func TestToSeconds(t *testing.T) {
 		{"01:00:00", 3600, false},
 		{"1:30", 90, false},
 		{"30", 30, false},
+		{"00:01:02.500", 62.5, false},
+		{"1:30.25", 90.25, false},
+		{"754.125", 754.125, false},
 		{"invalid", 0, true},
 		{"00:xx:30", 0, true},
 		{"1:30:60", 0, true}, // Invalid seconds
+		{"00:00:59.", 0, true},
+		{"1e3", 0, true},
+		{"1:2:3:4", 0, true},
 	}
 
 	for _, test := range tests {
@@ -32,9 +38,28 @@ func TestToSeconds(t *testing.T) {
 					t.Fatalf("Did not expect error for input %s, but got: %v", test.input, err)
 				}
 				if result != test.expected {
-					t.Fatalf("For input %s, expected %d, but got %d", test.input, test.expected, result)
+					t.Fatalf("For input %s, expected %v, but got %v", test.input, test.expected, result)
 				}
 			}
 		})
 	}
 }
+
+func TestFormatSeconds(t *testing.T) {
+	tests := []struct {
+		input    float64
+		expected string
+	}{
+		{0, "00:00:00"},
+		{90, "00:01:30"},
+		{3725, "01:02:05"},
+		{62.5, "00:01:02.500"},
+		{12.0004, "00:00:12"},
+	}
+
+	for _, test := range tests {
+		if result := FormatSeconds(test.input); result != test.expected {
+			t.Errorf("For input %v, expected %s, but got %s", test.input, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package videoprocessing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"ytclipper-go/jobs"
+)
+
+// Defaults and limits of animated outputs. Larger or smoother animations grow
+// quickly; a 480px GIF at 15 fps is a few MB per 10 seconds.
+const (
+	defaultAnimationFPS   = 15
+	maxAnimationFPS       = 30
+	defaultAnimationWidth = 480
+	minAnimationWidth     = 16
+	maxAnimationWidth     = 1280
+)
+
+// IsAnimationOutput reports whether the output format is an animated image.
+func IsAnimationOutput(format string) bool {
+	return format == OutputFormatGIF || format == OutputFormatWebP
+}
+
+func validateAnimationOutput(output jobs.ClipOutput) error {
+	if output.Bitrate != 0 {
+		return fmt.Errorf("The bitrate option only applies to audio outputs.")
+	}
+	if output.HasVideoOptions() {
+		return errVideoOptions
+	}
+	if output.FPS < 0 || output.FPS > maxAnimationFPS {
+		return fmt.Errorf("Invalid fps. Animations support 1 to %d frames per second.", maxAnimationFPS)
+	}
+	if output.Width != 0 && (output.Width < minAnimationWidth || output.Width > maxAnimationWidth) {
+		return fmt.Errorf("Invalid width. Animations can be %d to %d pixels wide.", minAnimationWidth, maxAnimationWidth)
+	}
+	if output.Loop < 0 {
+		return fmt.Errorf("Invalid loop. Use 0 to loop forever or the number of times to play the animation.")
+	}
+	return nil
+}
+
+// convertAnimation turns the clip into an animated GIF or WebP without audio.
+func convertAnimation(ctx context.Context, sourcePath string, outputPath string, output jobs.ClipOutput, clipDurationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	fps, width := output.FPS, output.Width
+	if fps == 0 {
+		fps = defaultAnimationFPS
+	}
+	if width == 0 {
+		width = defaultAnimationWidth
+	}
+	filters := fmt.Sprintf("fps=%d,scale=%d:-1:flags=lanczos", fps, width)
+
+	if output.Format == OutputFormatWebP {
+		cmdArgs := []string{
+			"-hide_banner", "-nostdin", "-y",
+			"-i", sourcePath,
+			"-vf", filters,
+			"-an",
+			"-c:v", "libwebp",
+			"-lossless", "0",
+			"-quality", "75",
+			"-loop", strconv.Itoa(output.Loop),
+			"-progress", "pipe:1", "-nostats",
+			outputPath,
+		}
+		return executeFFmpeg(ctx, cmdArgs, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 0, 1)))
+	}
+
+	return convertGIF(ctx, sourcePath, outputPath, filters, gifLoop(output.Loop), clipDurationInSeconds, onProgress)
+}
+
+// convertGIF encodes in two passes: the first generates a palette of the 256
+// colors that fit the clip best, the second maps every frame onto it. This
+// avoids the banding of ffmpeg's generic GIF palette.
+func convertGIF(ctx context.Context, sourcePath string, outputPath string, filters string, loop int, clipDurationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	palettePath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".palette.png"
+	defer os.Remove(palettePath)
+
+	paletteArgs := []string{
+		"-hide_banner", "-nostdin", "-y",
+		"-i", sourcePath,
+		"-vf", filters + ",palettegen=stats_mode=diff",
+		"-progress", "pipe:1", "-nostats",
+		palettePath,
+	}
+	if output, err := executeFFmpeg(ctx, paletteArgs, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 0, 2))); err != nil {
+		return output, err
+	}
+
+	gifArgs := []string{
+		"-hide_banner", "-nostdin", "-y",
+		"-i", sourcePath,
+		"-i", palettePath,
+		"-lavfi", filters + " [x]; [x][1:v] paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle",
+		"-loop", strconv.Itoa(loop),
+		"-progress", "pipe:1", "-nostats",
+		outputPath,
+	}
+	return executeFFmpeg(ctx, gifArgs, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 1, 2)))
+}
+
+// gifLoop translates how often the animation plays (0 for forever) into
+// ffmpeg's GIF loop option, which counts repetitions and uses -1 for none.
+func gifLoop(plays int) int {
+	if plays == 0 {
+		return 0
+	}
+	if plays == 1 {
+		return -1
+	}
+	return plays - 1
+}
@@ -0,0 +1,99 @@
+package videoprocessing
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestConvertClipToGIFUsesTwoPasses(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var commands [][]string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		commands = append(commands, append([]string{name}, arg...))
+		return exec.Command("echo", "mock")
+	}
+
+	output := jobs.ClipOutput{Format: OutputFormatGIF, FPS: 10, Width: 320, Loop: 1}
+	if _, err := ConvertClip(context.Background(), "videos/job.source.mp4", "videos/job.gif", output, MediaTags{Title: "Ignored"}, "", 10, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(commands) != 2 {
+		t.Fatalf("Expected palettegen and paletteuse passes, got %d commands", len(commands))
+	}
+
+	palette := commands[0]
+	if v, ok := flagValue(palette, "-vf"); !ok || v != "fps=10,scale=320:-1:flags=lanczos,palettegen=stats_mode=diff" {
+		t.Errorf("Unexpected palettegen filter %q (present=%v)", v, ok)
+	}
+	if palette[len(palette)-1] != "videos/job.palette.png" {
+		t.Errorf("Expected palette to be written next to the output, got %v", palette)
+	}
+
+	gif := commands[1]
+	if v, ok := flagValue(gif, "-lavfi"); !ok || !strings.Contains(v, "paletteuse") || !strings.HasPrefix(v, "fps=10,scale=320:-1") {
+		t.Errorf("Unexpected paletteuse filter %q (present=%v)", v, ok)
+	}
+	if !hasFlag(gif, "videos/job.palette.png") {
+		t.Errorf("Expected palette as second input, got %v", gif)
+	}
+	if v, ok := flagValue(gif, "-loop"); !ok || v != "-1" {
+		t.Errorf("Expected a single play to disable looping, got %q (present=%v)", v, ok)
+	}
+	if hasFlag(gif, "-metadata") {
+		t.Error("Expected no tags in GIFs")
+	}
+}
+
+func TestConvertClipToWebP(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var commands [][]string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		commands = append(commands, append([]string{name}, arg...))
+		return exec.Command("echo", "mock")
+	}
+
+	_, _ = ConvertClip(context.Background(), "videos/job.source.mp4", "videos/job.webp", jobs.ClipOutput{Format: OutputFormatWebP}, MediaTags{}, "", 10, nil)
+
+	if len(commands) != 1 {
+		t.Fatalf("Expected a single pass, got %d commands", len(commands))
+	}
+	if v, ok := flagValue(commands[0], "-c:v"); !ok || v != "libwebp" {
+		t.Errorf("Expected -c:v libwebp, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(commands[0], "-vf"); !ok || v != "fps=15,scale=480:-1:flags=lanczos" {
+		t.Errorf("Expected default fps and width, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(commands[0], "-loop"); !ok || v != "0" {
+		t.Errorf("Expected infinite loop by default, got %q (present=%v)", v, ok)
+	}
+}
+
+func TestConvertProgressSpansPasses(t *testing.T) {
+	var reported jobs.JobProgress
+	report := convertProgress(func(progress jobs.JobProgress) { reported = progress }, 1, 2)
+
+	report(jobs.JobProgress{Stage: jobs.ProgressStageEncode, Percent: 50})
+	if reported.Stage != jobs.ProgressStageConvert || reported.Percent != 75 {
+		t.Errorf("Expected convert stage at 75%%, got %+v", reported)
+	}
+}
+
+func TestOutputError(t *testing.T) {
+	if err := outputError(jobs.ClipOutput{Format: OutputFormatMP3}, true, false, 10); err == nil || err.Code != ErrorCodeFormatUnavailable {
+		t.Errorf("Expected MP3 from silent video to be rejected, got %v", err)
+	}
+	if err := outputError(jobs.ClipOutput{Format: OutputFormatGIF}, false, true, 10); err == nil || err.Code != ErrorCodeFormatUnavailable {
+		t.Errorf("Expected GIF from an audio-only format to be rejected, got %v", err)
+	}
+	if err := outputError(jobs.ClipOutput{Format: OutputFormatGIF}, true, false, 10); err != nil {
+		t.Errorf("Expected GIF from a video-only format to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package videoprocessing
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+// jobPollInterval is how often waitForJob checks that the job still exists.
+var jobPollInterval = 30 * time.Second
+
+// ProcessBundle waits for the child jobs of a parent job and zips the clips of
+// the completed ones. The parent fails only if none of its children completed.
+// The children run through the job queue; the parent itself is never queued.
+func ProcessBundle(parentID string) {
+	parent, exists := jobs.GetJobById(parentID)
+	if !exists {
+		return
+	}
+
+	glogger.Log.Infof("Process Bundle: Start Job %s with %d clips", parentID, len(parent.ChildJobIDs))
+	jobs.StartJob(parentID)
+
+	children := make([]*jobs.Job, len(parent.ChildJobIDs))
+	for i, childID := range parent.ChildJobIDs {
+		child, err := waitForJob(childID)
+		if err != nil {
+			glogger.Log.Errorf(err, "Process Bundle: Job %s lost clip %s", parentID, childID)
+		}
+		children[i] = child
+
+		jobs.UpdateJobProgress(parentID, jobs.JobProgress{
+			Stage:   jobs.ProgressStageBundle,
+			Percent: float64(i+1) / float64(len(parent.ChildJobIDs)) * 100,
+		})
+	}
+
+	if parent, exists := jobs.GetJobById(parentID); !exists || parent.Status == jobs.StatusCancelled {
+		glogger.Log.Infof("Process Bundle: Job %s was cancelled", parentID)
+		return
+	}
+
+	var entries []bundleEntry
+	for i, child := range children {
+		if child == nil || child.Status != jobs.StatusCompleted {
+			continue
+		}
+		entries = append(entries, bundleEntry{
+			name: bundleEntryName(i, child.Request.ChapterTitle, child.FilePath),
+			key:  child.FileKey(),
+		})
+	}
+
+	if len(entries) == 0 {
+		glogger.Log.Errorf(fmt.Errorf("no clips completed"), "Process Bundle: Job %s has no completed clips", parentID)
+		jobs.FailJobWithCode(parentID, ErrorCodeDownloadFailed, "None of the clips could be created. Please try again in a few minutes.")
+		return
+	}
+
+	outputPath := filepath.Join(videoOutputDir, fmt.Sprintf("%s.zip", filepath.Base(parentID)))
+	if err := writeZip(outputPath, entries); err != nil {
+		glogger.Log.Errorf(err, "Process Bundle: Could not write %s", outputPath)
+		os.Remove(outputPath)
+		jobs.FailJobWithCode(parentID, jobs.ErrorCodeInternal, "The clips could not be bundled. Please try again.")
+		return
+	}
+
+	key, err := storeClip(outputPath)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Bundle: Could not store %s", outputPath)
+		os.Remove(outputPath)
+		jobs.FailJobWithCode(parentID, jobs.ErrorCodeInternal, "The clips could not be bundled. Please try again.")
+		return
+	}
+
+	glogger.Log.Infof("Process Bundle: Complete Job %s with %d of %d clips", parentID, len(entries), len(parent.ChildJobIDs))
+	jobs.CompleteJob(parentID, key)
+}
+
+// waitForJob blocks until the job is finished and returns its final state. It
+// returns jobs.ErrJobNotFound if the job does not exist or is deleted while
+// waiting, which the job events do not report, so the job is also polled.
+func waitForJob(jobID string) (*jobs.Job, error) {
+	// Subscribe before reading the job, so no transition in between is lost.
+	events, unsubscribe := jobs.Subscribe(jobID)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	job, exists := jobs.GetJobById(jobID)
+	for exists && !job.Status.IsFinished() {
+		select {
+		case next := <-events:
+			job = &next
+		case <-ticker.C:
+			job, exists = jobs.GetJobById(jobID)
+		}
+	}
+	if !exists {
+		return nil, jobs.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// bundleEntry is a file and its name in the zip. The file is read from
+// storage.Clips if it has a key and from the local path otherwise.
+type bundleEntry struct {
+	name string
+	key  string
+	path string
+}
+
+// bundleEntryName numbers the clips in request order, e.g. "02 - Verse.mp4".
+func bundleEntryName(index int, title string, filePath string) string {
+	name := fmt.Sprintf("%02d", index+1)
+	if title = sanitizeFileName(title); title != "" {
+		name = fmt.Sprintf("%s - %s", name, title)
+	}
+	return name + filepath.Ext(filePath)
+}
+
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.TrimSpace(name)
+}
+
+// writeZip stores the files without compression; clips are already compressed.
+func writeZip(outputPath string, entries []bundleEntry) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for _, entry := range entries {
+		if err := addZipEntry(archive, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func addZipEntry(archive *zip.Writer, entry bundleEntry) error {
+	source, err := openBundleEntry(entry)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, source)
+	return err
+}
+
+func openBundleEntry(entry bundleEntry) (io.ReadCloser, error) {
+	if entry.key != "" {
+		return storage.Clips.Open(context.Background(), entry.key)
+	}
+	return os.Open(entry.path)
+}
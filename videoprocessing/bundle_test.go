@@ -0,0 +1,123 @@
+package videoprocessing
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+)
+
+func TestBundleEntryName(t *testing.T) {
+	tests := []struct {
+		index    int
+		title    string
+		expected string
+	}{
+		{index: 0, title: "Intro", expected: "01 - Intro.mp4"},
+		{index: 11, title: "AC/DC: Live?", expected: "12 - AC_DC_ Live_.mp4"},
+		{index: 2, title: "", expected: "03.mp4"},
+	}
+
+	for _, test := range tests {
+		if name := bundleEntryName(test.index, test.title, "videos/job.mp4"); name != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, name)
+		}
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.mp4")
+	second := filepath.Join(dir, "second.mp4")
+	os.WriteFile(first, []byte("first clip"), 0644)
+	os.WriteFile(second, []byte("second clip"), 0644)
+
+	outputPath := filepath.Join(dir, "bundle.zip")
+	err := writeZip(outputPath, []bundleEntry{
+		{name: "01 - Intro.mp4", path: first},
+		{name: "02 - Outro.mp4", path: second},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	archive, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Could not open zip: %v", err)
+	}
+	defer archive.Close()
+
+	if len(archive.File) != 2 || archive.File[0].Name != "01 - Intro.mp4" || archive.File[1].Name != "02 - Outro.mp4" {
+		t.Errorf("Unexpected zip entries: %v", archive.File)
+	}
+}
+
+func TestWriteZipReadsStoredClips(t *testing.T) {
+	originalClips := storage.Clips
+	defer func() { storage.Clips = originalClips }()
+
+	dir := t.TempDir()
+	storage.Clips = storage.NewLocalStorage(filepath.Join(dir, "clips"))
+	storage.Clips.Put(context.Background(), "child.mp4", strings.NewReader("stored clip"), -1)
+
+	outputPath := filepath.Join(dir, "bundle.zip")
+	if err := writeZip(outputPath, []bundleEntry{{name: "01.mp4", key: "child.mp4"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	archive, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Could not open zip: %v", err)
+	}
+	defer archive.Close()
+
+	if len(archive.File) != 1 || archive.File[0].UncompressedSize64 != uint64(len("stored clip")) {
+		t.Errorf("Expected the stored clip in the zip, got %v", archive.File)
+	}
+
+	if err := writeZip(outputPath, []bundleEntry{{name: "02.mp4", key: "missing.mp4"}}); err == nil {
+		t.Error("Expected an error for a missing clip")
+	}
+}
+
+func TestProcessBundleFailsWithoutCompletedClips(t *testing.T) {
+	originalStore := jobs.Store
+	jobs.Store = jobs.NewMemoryJobStore()
+	defer func() { jobs.Store = originalStore }()
+
+	parent, children := jobs.NewParentJob(jobs.JobRequest{AllChapters: true}, []jobs.JobRequest{{}, {}})
+	jobs.FailJob(children[0].ID, "failed")
+	jobs.CancelJob(children[1].ID)
+
+	ProcessBundle(parent.ID)
+
+	job, _ := jobs.GetJobById(parent.ID)
+	if job.Status != jobs.StatusError || job.ErrorCode != ErrorCodeDownloadFailed {
+		t.Errorf("Expected parent to fail with %s, got %s (%s)", ErrorCodeDownloadFailed, job.Status, job.ErrorCode)
+	}
+}
+
+func TestWaitForDeletedJob(t *testing.T) {
+	originalStore := jobs.Store
+	jobs.Store = jobs.NewMemoryJobStore()
+	defer func() { jobs.Store = originalStore }()
+
+	originalInterval := jobPollInterval
+	jobPollInterval = 10 * time.Millisecond
+	defer func() { jobPollInterval = originalInterval }()
+
+	job := jobs.NewJob(jobs.JobRequest{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		jobs.DeleteJob(job.ID)
+	}()
+
+	if _, err := waitForJob(job.ID); err != jobs.ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package videoprocessing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"ytclipper-go/utils"
+)
+
+// GetChapters returns the chapters of the video, or a ProcessingError with
+// ErrorCodeNoChapters if it has none.
+func GetChapters(ctx context.Context, url string) ([]Chapter, error) {
+	info, err := GetVideoInfo(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(info.Chapters) == 0 {
+		return nil, &ProcessingError{
+			Code:    ErrorCodeNoChapters,
+			Message: "This video has no chapters.",
+		}
+	}
+
+	return info.Chapters, nil
+}
+
+// ResolveChapter finds a chapter of the video by its zero-based index or, if
+// index is nil, by its title. Titles are matched case-insensitively.
+func ResolveChapter(ctx context.Context, url string, index *int, title string) (int, Chapter, error) {
+	chapters, err := GetChapters(ctx, url)
+	if err != nil {
+		return 0, Chapter{}, err
+	}
+
+	if index != nil {
+		if *index < 0 || *index >= len(chapters) {
+			return 0, Chapter{}, &ProcessingError{
+				Code:    ErrorCodeChapterNotFound,
+				Message: fmt.Sprintf("Chapter %d does not exist. This video has %d chapters.", *index, len(chapters)),
+			}
+		}
+		return *index, chapters[*index], nil
+	}
+
+	for i, chapter := range chapters {
+		if strings.EqualFold(strings.TrimSpace(chapter.Title), strings.TrimSpace(title)) {
+			return i, chapter, nil
+		}
+	}
+
+	return 0, Chapter{}, &ProcessingError{
+		Code:    ErrorCodeChapterNotFound,
+		Message: fmt.Sprintf("This video has no chapter named %q.", title),
+	}
+}
+
+// Range returns the chapter boundaries as timestamps with millisecond precision.
+func (c Chapter) Range() (string, string) {
+	return utils.FormatSeconds(c.StartTime), utils.FormatSeconds(c.EndTime)
+}
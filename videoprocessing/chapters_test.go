@@ -0,0 +1,66 @@
+package videoprocessing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func withCachedVideoInfo(t *testing.T, url string, info *VideoInfo) {
+	withMetadataCacheTTL(t, 60)
+	metadata.store(videoCacheKey(url), info, time.Minute)
+	t.Cleanup(func() {
+		metadata.lock.Lock()
+		delete(metadata.entries, videoCacheKey(url))
+		metadata.lock.Unlock()
+	})
+}
+
+func TestResolveChapter(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=chapters"
+	withCachedVideoInfo(t, url, &VideoInfo{
+		ID: "chapters",
+		Chapters: []Chapter{
+			{Title: "Intro", StartTime: 0, EndTime: 12.5},
+			{Title: "Main Part", StartTime: 12.5, EndTime: 95},
+		},
+	})
+
+	second := 1
+	index, chapter, err := ResolveChapter(context.Background(), url, &second, "")
+	if err != nil || index != 1 || chapter.Title != "Main Part" {
+		t.Errorf("Expected chapter 1 by index, got %d %+v (err=%v)", index, chapter, err)
+	}
+
+	index, chapter, err = ResolveChapter(context.Background(), url, nil, " main part ")
+	if err != nil || index != 1 || chapter.Title != "Main Part" {
+		t.Errorf("Expected chapter 1 by title, got %d %+v (err=%v)", index, chapter, err)
+	}
+
+	outOfRange := 2
+	var processingErr *ProcessingError
+	if _, _, err := ResolveChapter(context.Background(), url, &outOfRange, ""); !errors.As(err, &processingErr) || processingErr.Code != ErrorCodeChapterNotFound {
+		t.Errorf("Expected %s for an unknown index, got %v", ErrorCodeChapterNotFound, err)
+	}
+	if _, _, err := ResolveChapter(context.Background(), url, nil, "Outro"); !errors.As(err, &processingErr) || processingErr.Code != ErrorCodeChapterNotFound {
+		t.Errorf("Expected %s for an unknown title, got %v", ErrorCodeChapterNotFound, err)
+	}
+}
+
+func TestGetChaptersWithoutChapters(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=nochapters"
+	withCachedVideoInfo(t, url, &VideoInfo{ID: "nochapters"})
+
+	var processingErr *ProcessingError
+	if _, err := GetChapters(context.Background(), url); !errors.As(err, &processingErr) || processingErr.Code != ErrorCodeNoChapters {
+		t.Errorf("Expected %s, got %v", ErrorCodeNoChapters, err)
+	}
+}
+
+func TestChapterRange(t *testing.T) {
+	from, to := Chapter{StartTime: 12.5, EndTime: 95.2}.Range()
+	if from != "00:00:12.500" || to != "00:01:35.200" {
+		t.Errorf("Expected 00:00:12.500-00:01:35.200, got %s-%s", from, to)
+	}
+}
@@ -0,0 +1,49 @@
+package videoprocessing
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+	"ytclipper-go/jobs"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+// CleanUpWorkingFiles deletes the files jobs left in the working directory,
+// e.g. partial downloads of interrupted jobs, once they are older than the
+// retention. The working directory is swept even if clips are stored elsewhere.
+func CleanUpWorkingFiles(retention time.Duration) {
+	cleanUpWorkingDir(videoOutputDir, retention)
+}
+
+// cleanUpWorkingDir keeps the files of jobs the cleanup keeps and files that
+// are not named after a job.
+func cleanUpWorkingDir(dir string, retention time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glogger.Log.Errorf(err, "Working File Cleanup: Could not read %s", dir)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() || now.Sub(info.ModTime()) <= retention {
+			continue
+		}
+
+		jobID, ok := jobs.JobIDFromFileName(entry.Name())
+		if !ok || jobs.IsJobRetained(jobID, retention) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if err := os.Remove(path); err != nil {
+			glogger.Log.Errorf(err, "Working File Cleanup: Could not delete %s", path)
+			continue
+		}
+		glogger.Log.Infof("Working File Cleanup: Deleted %s", path)
+	}
+}
@@ -0,0 +1,49 @@
+package videoprocessing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ytclipper-go/jobs"
+
+	"github.com/google/uuid"
+)
+
+func TestCleanUpWorkingDir(t *testing.T) {
+	originalStore := jobs.Store
+	jobs.Store = jobs.NewMemoryJobStore()
+	t.Cleanup(func() { jobs.Store = originalStore })
+
+	running := jobs.NewJob(jobs.JobRequest{})
+	jobs.StartJob(running.ID)
+	failed := jobs.NewJob(jobs.JobRequest{})
+	jobs.FailJob(failed.ID, "Failed to download video")
+	recentlyFailed := jobs.NewJob(jobs.JobRequest{})
+	jobs.FailJob(recentlyFailed.ID, "Failed to download video")
+
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	jobs.Store.Update(failed.ID, func(job *jobs.Job) { job.CompletedAt = old })
+	write := func(name string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("clip"), 0644)
+		os.Chtimes(path, modTime, modTime)
+		return path
+	}
+
+	failedFile := write(failed.ID+".mp4", old)
+	unknownPart := write(uuid.New().String()+".mp4.part", old)
+	runningPart := write(running.ID+".source.mp4.part", old)
+	recentlyFailedFile := write(recentlyFailed.ID+".mp4", old)
+	recent := write(uuid.New().String()+".mp4", time.Now())
+	other := write("notes.txt", old)
+
+	cleanUpWorkingDir(dir, time.Hour)
+
+	for path, kept := range map[string]bool{failedFile: false, unknownPart: false, runningPart: true, recentlyFailedFile: true, recent: true, other: true} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("Expected %s to be kept: %v", filepath.Base(path), kept)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package videoprocessing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+	"ytclipper-go/utils"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+// OutputFormatMP4 re-encodes the clip to H.264 and AAC, optionally to fit a
+// target size.
+const OutputFormatMP4 = "mp4"
+
+const (
+	defaultVideoCRF    = 23
+	maxAudioBitrate    = 128
+	minAudioBitrate    = 32
+	minVideoBitrate    = 100
+	maxVideoBitrate    = 50000
+	minVideoHeight     = 144
+	maxVideoHeight     = 4320
+	targetSizeHeadroom = 0.96
+	bitsPerKilobit     = 1000
+)
+
+var errVideoOptions = fmt.Errorf("The targetSizeInMb, videoBitrate, maxHeight, aspectRatio, cropMode and cropOffset options only apply to %s.", OutputFormatMP4)
+
+// IsVideoOutput reports whether the output format re-encodes the video.
+func IsVideoOutput(format string) bool {
+	return format == OutputFormatMP4
+}
+
+func validateVideoOutput(output jobs.ClipOutput) error {
+	if output.FPS != 0 || output.Width != 0 || output.Loop != 0 {
+		return fmt.Errorf("The fps, width and loop options only apply to %s and %s.", OutputFormatGIF, OutputFormatWebP)
+	}
+	if output.TargetSizeInMb != 0 && (output.VideoBitrate != 0 || output.Bitrate != 0) {
+		return fmt.Errorf("Use either a target size or bitrates, not both.")
+	}
+
+	maxSizeInMb := int(config.CONFIG.YtDlpConfig.ClipSizeInMb / utils.MbToBytes(1))
+	if output.TargetSizeInMb < 0 || output.TargetSizeInMb > maxSizeInMb {
+		return fmt.Errorf("Invalid target size. Use 1 to %d MB.", maxSizeInMb)
+	}
+	if output.Bitrate != 0 && (output.Bitrate < audioCodecs[OutputFormatMP3].minBitrate || output.Bitrate > audioCodecs[OutputFormatMP3].maxBitrate) {
+		return fmt.Errorf("Invalid bitrate. %s audio supports %d to %d kbit/s.", strings.ToUpper(OutputFormatMP4), audioCodecs[OutputFormatMP3].minBitrate, audioCodecs[OutputFormatMP3].maxBitrate)
+	}
+	if output.VideoBitrate != 0 && (output.VideoBitrate < minVideoBitrate || output.VideoBitrate > maxVideoBitrate) {
+		return fmt.Errorf("Invalid video bitrate. Use %d to %d kbit/s.", minVideoBitrate, maxVideoBitrate)
+	}
+	if output.MaxHeight != 0 && (output.MaxHeight < minVideoHeight || output.MaxHeight > maxVideoHeight) {
+		return fmt.Errorf("Invalid max height. Use %d to %d pixels.", minVideoHeight, maxVideoHeight)
+	}
+	return validateReframe(output)
+}
+
+// videoFilters reframes the video to the aspect ratio, scales it down to the
+// max height and burns in the subtitles, if any, so they are sized for the
+// final frame.
+func videoFilters(output jobs.ClipOutput, subtitlesPath string) []string {
+	var filters []string
+	if filter := reframeFilter(output); filter != "" {
+		filters = append(filters, filter)
+	}
+	if output.MaxHeight > 0 {
+		filters = append(filters, fmt.Sprintf("scale=-2:'min(ih,%d)'", output.MaxHeight))
+	}
+	if subtitlesPath != "" {
+		filters = append(filters, subtitlesFilter(subtitlesPath))
+	}
+	return filters
+}
+
+// targetBitrates splits the bitrate at which a clip of the given duration fits
+// into sizeInMb between video and audio, in kbit/s. A few percent are kept as
+// headroom for the container and the rate control. Short budgets take bitrate
+// from the audio first.
+func targetBitrates(sizeInMb int, durationInSeconds float64) (int, int, error) {
+	if durationInSeconds <= 0 {
+		return 0, 0, fmt.Errorf("unknown clip duration")
+	}
+
+	totalBitrate := int(float64(utils.MbToBytes(sizeInMb)) * 8 * targetSizeHeadroom / durationInSeconds / bitsPerKilobit)
+	audioBitrate := min(maxAudioBitrate, max(minAudioBitrate, totalBitrate/8))
+	videoBitrate := totalBitrate - audioBitrate
+	if videoBitrate < minVideoBitrate {
+		return 0, 0, &ProcessingError{
+			Code:    ErrorCodeTargetSizeTooSmall,
+			Message: fmt.Sprintf("The clip is too long to fit into %d MB. Try a shorter range or a larger target size.", sizeInMb),
+		}
+	}
+
+	return videoBitrate, audioBitrate, nil
+}
+
+// convertVideo re-encodes the clip to H.264 and AAC. Without a target size it
+// encodes once, at constant quality or the requested video bitrate; with one
+// it encodes in two passes at the bitrate that fits the size, as a single pass
+// cannot hit a size reliably. A subtitlesPath burns the subtitles in.
+func convertVideo(ctx context.Context, sourcePath string, outputPath string, output jobs.ClipOutput, subtitlesPath string, clipDurationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	inputArgs := []string{"-hide_banner", "-nostdin", "-y", "-i", sourcePath}
+	if filters := videoFilters(output, subtitlesPath); len(filters) > 0 {
+		inputArgs = append(inputArgs, "-vf", strings.Join(filters, ","))
+	}
+	outputArgs := []string{"-c:a", "aac", "-movflags", "+faststart", "-progress", "pipe:1", "-nostats", outputPath}
+
+	if output.TargetSizeInMb == 0 {
+		audioBitrate := output.Bitrate
+		if audioBitrate == 0 {
+			audioBitrate = maxAudioBitrate
+		}
+
+		cmdArgs := append([]string{}, inputArgs...)
+		cmdArgs = append(cmdArgs, "-c:v", "libx264", "-preset", "medium")
+		if output.VideoBitrate > 0 {
+			cmdArgs = append(cmdArgs, "-b:v", fmt.Sprintf("%dk", output.VideoBitrate), "-maxrate", fmt.Sprintf("%dk", output.VideoBitrate), "-bufsize", fmt.Sprintf("%dk", 2*output.VideoBitrate))
+		} else {
+			cmdArgs = append(cmdArgs, "-crf", fmt.Sprint(defaultVideoCRF))
+		}
+		cmdArgs = append(cmdArgs, "-b:a", fmt.Sprintf("%dk", audioBitrate))
+		cmdArgs = append(cmdArgs, outputArgs...)
+		return executeFFmpeg(ctx, cmdArgs, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 0, 1)))
+	}
+
+	videoBitrate, audioBitrate, err := targetBitrates(output.TargetSizeInMb, clipDurationInSeconds)
+	if err != nil {
+		return nil, err
+	}
+	glogger.Log.Infof("Convert Video: Encoding %s at %d kbit/s video and %d kbit/s audio to fit %d MB", outputPath, videoBitrate, audioBitrate, output.TargetSizeInMb)
+
+	passLogPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".passlog"
+	defer removePassLogs(passLogPath)
+
+	videoArgs := []string{"-c:v", "libx264", "-preset", "medium", "-b:v", fmt.Sprintf("%dk", videoBitrate), "-passlogfile", passLogPath}
+
+	// The first pass only analyzes the video; its output is discarded.
+	firstPass := append([]string{}, inputArgs...)
+	firstPass = append(firstPass, videoArgs...)
+	firstPass = append(firstPass, "-pass", "1", "-an", "-f", "null", "-progress", "pipe:1", "-nostats", os.DevNull)
+	if ffmpegOutput, err := executeFFmpeg(ctx, firstPass, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 0, 2))); err != nil {
+		return ffmpegOutput, err
+	}
+
+	secondPass := append([]string{}, inputArgs...)
+	secondPass = append(secondPass, videoArgs...)
+	secondPass = append(secondPass, "-pass", "2", "-b:a", fmt.Sprintf("%dk", audioBitrate))
+	secondPass = append(secondPass, outputArgs...)
+	return executeFFmpeg(ctx, secondPass, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 1, 2)))
+}
+
+// removePassLogs deletes the statistics files x264 writes during two-pass
+// encodes, e.g. <jobID>.passlog-0.log and <jobID>.passlog-0.log.mbtree.
+func removePassLogs(passLogPath string) {
+	removeFiles(passLogPath + "*")
+}
+
+// clipResult measures the size and average bitrate of a finished clip.
+func clipResult(filePath string, clipDurationInSeconds float64) (jobs.JobResult, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return jobs.JobResult{}, err
+	}
+
+	result := jobs.JobResult{SizeInBytes: info.Size()}
+	if clipDurationInSeconds > 0 {
+		result.BitrateInKbps = int(float64(info.Size()) * 8 / clipDurationInSeconds / bitsPerKilobit)
+	}
+	return result, nil
+}
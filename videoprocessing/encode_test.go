@@ -0,0 +1,129 @@
+package videoprocessing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestTargetBitrates(t *testing.T) {
+	videoBitrate, audioBitrate, err := targetBitrates(8, 60)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if audioBitrate != 128 || videoBitrate != 945 {
+		t.Errorf("Expected 945k video and 128k audio, got %dk and %dk", videoBitrate, audioBitrate)
+	}
+
+	// A tight budget takes bitrate from the audio first.
+	videoBitrate, audioBitrate, err = targetBitrates(8, 480)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if audioBitrate != 32 || videoBitrate != 102 {
+		t.Errorf("Expected 102k video and 32k audio, got %dk and %dk", videoBitrate, audioBitrate)
+	}
+
+	var processingErr *ProcessingError
+	if _, _, err := targetBitrates(8, 3600); !errors.As(err, &processingErr) || processingErr.Code != ErrorCodeTargetSizeTooSmall {
+		t.Errorf("Expected %q for an hour in 8 MB, got %v", ErrorCodeTargetSizeTooSmall, err)
+	}
+}
+
+func TestConvertClipToTargetSizeUsesTwoPasses(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var commands [][]string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		commands = append(commands, append([]string{name}, arg...))
+		return exec.Command("echo", "mock")
+	}
+
+	output := jobs.ClipOutput{Format: OutputFormatMP4, TargetSizeInMb: 8}
+	if _, err := ConvertClip(context.Background(), "videos/job.source.webm", "videos/job.mp4", output, MediaTags{}, "", 60, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(commands) != 2 {
+		t.Fatalf("Expected two passes, got %d commands", len(commands))
+	}
+	for i, command := range commands {
+		if v, ok := flagValue(command, "-pass"); !ok || v != []string{"1", "2"}[i] {
+			t.Errorf("Expected pass %d, got %q (present=%v)", i+1, v, ok)
+		}
+		if v, ok := flagValue(command, "-b:v"); !ok || v != "945k" {
+			t.Errorf("Expected -b:v 945k, got %q (present=%v)", v, ok)
+		}
+		if v, ok := flagValue(command, "-passlogfile"); !ok || v != "videos/job.passlog" {
+			t.Errorf("Expected pass log next to the output, got %q (present=%v)", v, ok)
+		}
+	}
+	if !hasFlag(commands[0], "-an") {
+		t.Error("Expected the first pass to skip audio")
+	}
+	if v, ok := flagValue(commands[1], "-b:a"); !ok || v != "128k" {
+		t.Errorf("Expected -b:a 128k, got %q (present=%v)", v, ok)
+	}
+	if commands[1][len(commands[1])-1] != "videos/job.mp4" {
+		t.Errorf("Expected output path last, got %v", commands[1])
+	}
+}
+
+func TestConvertClipToMP4WithoutTargetSize(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var commands [][]string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		commands = append(commands, append([]string{name}, arg...))
+		return exec.Command("echo", "mock")
+	}
+
+	_, _ = ConvertClip(context.Background(), "videos/job.source.webm", "videos/job.mp4", jobs.ClipOutput{Format: OutputFormatMP4}, MediaTags{}, "", 60, nil)
+
+	if len(commands) != 1 {
+		t.Fatalf("Expected a single pass, got %d commands", len(commands))
+	}
+	if v, ok := flagValue(commands[0], "-crf"); !ok || v != "23" {
+		t.Errorf("Expected -crf 23, got %q (present=%v)", v, ok)
+	}
+	if hasFlag(commands[0], "-pass") {
+		t.Error("Expected no two-pass encode without a target size")
+	}
+}
+
+func TestClipResult(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(filePath, make([]byte, 250000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := clipResult(filePath, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.SizeInBytes != 250000 || result.BitrateInKbps != 200 {
+		t.Errorf("Expected 250000 bytes at 200 kbit/s, got %+v", result)
+	}
+}
+
+func TestVideoFilters(t *testing.T) {
+	filters := videoFilters(jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16", MaxHeight: 1280}, "")
+	expected := []string{
+		"crop='trunc(min(iw,ih*9/16)/2)*2':'trunc(min(ih,iw*16/9)/2)*2'",
+		"scale=-2:'min(ih,1280)'",
+	}
+	if strings.Join(filters, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, filters)
+	}
+
+	if filters := videoFilters(jobs.ClipOutput{Format: OutputFormatMP4}, ""); len(filters) != 0 {
+		t.Errorf("Expected no filters, got %v", filters)
+	}
+}
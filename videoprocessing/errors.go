@@ -0,0 +1,150 @@
+package videoprocessing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Stable error codes stored on failed jobs and returned by the API.
+const (
+	ErrorCodeVideoUnavailable     = "video_unavailable"
+	ErrorCodePrivateVideo         = "private_video"
+	ErrorCodeAgeRestricted        = "age_restricted"
+	ErrorCodeGeoBlocked           = "geo_blocked"
+	ErrorCodeLiveStream           = "live_stream_not_supported"
+	ErrorCodeFormatUnavailable    = "format_unavailable"
+	ErrorCodeFileTooLarge         = "file_too_large"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeTimeout              = "timeout"
+	ErrorCodeDownloadFailed       = "download_failed"
+	ErrorCodeNoChapters           = "no_chapters"
+	ErrorCodeChapterNotFound      = "chapter_not_found"
+	ErrorCodeConversionFailed     = "conversion_failed"
+	ErrorCodeTargetSizeTooSmall   = "target_size_too_small"
+	ErrorCodePresetNotFound       = "preset_not_found"
+	ErrorCodeSubtitlesUnavailable = "subtitles_unavailable"
+)
+
+var ErrCommandTimeout = errors.New("command timed out")
+
+// ProcessingError is a classified yt-dlp or ffmpeg failure. Message is safe to
+// show to users; the raw command output is only kept for logging.
+type ProcessingError struct {
+	Code    string
+	Message string
+	Output  string
+	Err     error
+}
+
+func (e *ProcessingError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *ProcessingError) Unwrap() error {
+	return e.Err
+}
+
+type errorPattern struct {
+	code      string
+	message   string
+	fragments []string
+}
+
+// errorPatterns are matched in order against the error lines of the command
+// output, so more specific patterns (private, age) come before generic ones.
+var errorPatterns = []errorPattern{
+	{
+		code:      ErrorCodePrivateVideo,
+		message:   "This video is private.",
+		fragments: []string{"private video", "this video is private"},
+	},
+	{
+		code:      ErrorCodeAgeRestricted,
+		message:   "This video is age-restricted and cannot be clipped.",
+		fragments: []string{"confirm your age", "age-restricted", "inappropriate for some users"},
+	},
+	{
+		code:      ErrorCodeGeoBlocked,
+		message:   "This video is not available in the server's region.",
+		fragments: []string{"available in your country", "geo restriction", "geo-restricted", "blocked it in your country"},
+	},
+	{
+		code:      ErrorCodeLiveStream,
+		message:   "Live streams and upcoming premieres cannot be clipped. Try again after the stream has ended.",
+		fragments: []string{"live event will begin", "premieres in", "is a live stream", "is currently live", "live streams are not supported"},
+	},
+	{
+		code:      ErrorCodeRateLimited,
+		message:   "YouTube is rate-limiting the server. Please try again in a few minutes.",
+		fragments: []string{"http error 429", "too many requests", "not a bot", "rate-limited"},
+	},
+	{
+		code:      ErrorCodeFormatUnavailable,
+		message:   "The selected format is not available for this video. Please choose another format.",
+		fragments: []string{"requested format is not available", "format not available", "format id not found"},
+	},
+	{
+		code:      ErrorCodeFileTooLarge,
+		message:   "The clip exceeds the maximum file size. Try a shorter range or a lower quality.",
+		fragments: []string{"larger than max-filesize", "file is larger than"},
+	},
+	{
+		code:      ErrorCodeVideoUnavailable,
+		message:   "This video is unavailable. It may have been removed or the URL is wrong.",
+		fragments: []string{"video unavailable", "this video is unavailable", "this video has been removed", "incomplete youtube id", "unsupported url"},
+	},
+}
+
+// classifyError turns a failed command into a ProcessingError based on its
+// output. Unrecognized failures get ErrorCodeDownloadFailed.
+func classifyError(output string, err error) *ProcessingError {
+	if errors.Is(err, ErrCommandTimeout) {
+		return &ProcessingError{
+			Code:    ErrorCodeTimeout,
+			Message: "Processing the clip took too long. Try a shorter range or try again later.",
+			Output:  output,
+			Err:     err,
+		}
+	}
+
+	if pattern := matchErrorPattern(output); pattern != nil {
+		return &ProcessingError{Code: pattern.code, Message: pattern.message, Output: output, Err: err}
+	}
+
+	return &ProcessingError{
+		Code:    ErrorCodeDownloadFailed,
+		Message: "The clip could not be downloaded. Please try again in a few minutes.",
+		Output:  output,
+		Err:     err,
+	}
+}
+
+func matchErrorPattern(output string) *errorPattern {
+	lowerOutput := strings.ToLower(errorLines(output))
+	for i := range errorPatterns {
+		for _, fragment := range errorPatterns[i].fragments {
+			if strings.Contains(lowerOutput, fragment) {
+				return &errorPatterns[i]
+			}
+		}
+	}
+	return nil
+}
+
+// errorLines returns the lines yt-dlp reports problems on. Matching only those
+// keeps verbose debug output (titles, descriptions, config) from producing
+// false positives. Without any such line the whole output is used.
+func errorLines(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "ERROR:") || strings.Contains(line, "larger than max-filesize") {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) == 0 {
+		return output
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,61 @@
+package videoprocessing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+
+	tests := []struct {
+		name     string
+		output   string
+		err      error
+		expected string
+	}{
+		{"Unavailable", "ERROR: [youtube] abc: Video unavailable", exitErr, ErrorCodeVideoUnavailable},
+		{"Removed", "ERROR: [youtube] abc: This video has been removed by the uploader", exitErr, ErrorCodeVideoUnavailable},
+		{"Private", "ERROR: [youtube] abc: Private video. Sign in if you've been granted access to this video", exitErr, ErrorCodePrivateVideo},
+		{"Age restricted", "ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.", exitErr, ErrorCodeAgeRestricted},
+		{"Geo blocked", "ERROR: [youtube] abc: The uploader has not made this video available in your country", exitErr, ErrorCodeGeoBlocked},
+		{"Upcoming live", "ERROR: [youtube] abc: This live event will begin in 3 hours.", exitErr, ErrorCodeLiveStream},
+		{"Format", "ERROR: [youtube] abc: Requested format is not available. Use --list-formats for a list of available formats", exitErr, ErrorCodeFormatUnavailable},
+		{"Too large", "[download] File is larger than max-filesize (400000000 bytes > 314572800 bytes). Aborting.", nil, ErrorCodeFileTooLarge},
+		{"HTTP 429", "ERROR: unable to download video data: HTTP Error 429: Too Many Requests", exitErr, ErrorCodeRateLimited},
+		{"Bot check", "ERROR: [youtube] abc: Sign in to confirm you're not a bot", exitErr, ErrorCodeRateLimited},
+		{"Timeout", "", fmt.Errorf("%w after 1m0s", ErrCommandTimeout), ErrorCodeTimeout},
+		{"Unknown", "ERROR: something nobody has seen before", exitErr, ErrorCodeDownloadFailed},
+		{"Debug output only", "[debug] yt-dlp version 2025.01.01\n[debug] Private video in title", exitErr, ErrorCodePrivateVideo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := classifyError(test.output, test.err)
+			if result.Code != test.expected {
+				t.Errorf("Expected code %q, got %q", test.expected, result.Code)
+			}
+			if result.Message == "" || result.Message == test.output {
+				t.Errorf("Expected a user-facing message, got %q", result.Message)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorIgnoresDebugLinesWhenErrorPresent(t *testing.T) {
+	output := "[debug] Video title: My private video diary\nERROR: [youtube] abc: Video unavailable"
+
+	if result := classifyError(output, errors.New("exit status 1")); result.Code != ErrorCodeVideoUnavailable {
+		t.Errorf("Expected %q, got %q", ErrorCodeVideoUnavailable, result.Code)
+	}
+}
+
+func TestProcessingErrorUnwrap(t *testing.T) {
+	cause := fmt.Errorf("%w after 1m0s", ErrCommandTimeout)
+	err := classifyError("", cause)
+
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Error("Expected ProcessingError to unwrap to its cause")
+	}
+}
@@ -0,0 +1,158 @@
+package videoprocessing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"ytclipper-go/config"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+const (
+	FormatTypeAudioOnly     = "audio only"
+	FormatTypeVideoOnly     = "video only"
+	FormatTypeAudioAndVideo = "audio and video"
+)
+
+// VideoInfo is the subset of the yt-dlp -J document the app uses.
+type VideoInfo struct {
+	ID                string                     `json:"id"`
+	Title             string                     `json:"title"`
+	Channel           string                     `json:"channel"`
+	Uploader          string                     `json:"uploader"`
+	UploadDate        string                     `json:"upload_date"`
+	Duration          float64                    `json:"duration"`
+	Thumbnail         string                     `json:"thumbnail"`
+	Thumbnails        []Thumbnail                `json:"thumbnails"`
+	Chapters          []Chapter                  `json:"chapters"`
+	Subtitles         map[string][]SubtitleTrack `json:"subtitles"`
+	AutomaticCaptions map[string][]SubtitleTrack `json:"automatic_captions"`
+	IsLive            bool                       `json:"is_live"`
+	LiveStatus        string                     `json:"live_status"`
+	AgeLimit          int                        `json:"age_limit"`
+	Formats           []Format                   `json:"formats"`
+}
+
+type Thumbnail struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Chapter is a YouTube chapter; times are in seconds.
+type Chapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+}
+
+type SubtitleTrack struct {
+	Ext  string `json:"ext"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+// Format is a single entry of the formats list yt-dlp reports. Codecs are
+// "none" when the format has no such stream.
+type Format struct {
+	ID             string  `json:"format_id"`
+	Ext            string  `json:"ext"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Fps            float64 `json:"fps"`
+	VCodec         string  `json:"vcodec"`
+	ACodec         string  `json:"acodec"`
+	Tbr            float64 `json:"tbr"`
+	Filesize       int64   `json:"filesize"`
+	FilesizeApprox int64   `json:"filesize_approx"`
+	Protocol       string  `json:"protocol"`
+	Note           string  `json:"format_note"`
+}
+
+// ChannelName returns the channel, falling back to the uploader for videos
+// yt-dlp reports no channel for.
+func (v *VideoInfo) ChannelName() string {
+	if v.Channel != "" {
+		return v.Channel
+	}
+	return v.Uploader
+}
+
+// SubtitleLanguages returns the sorted language codes of the uploaded subtitles.
+func (v *VideoInfo) SubtitleLanguages() []string {
+	return sortedLanguages(v.Subtitles)
+}
+
+// AutomaticCaptionLanguages returns the sorted language codes of YouTube's
+// auto-generated captions.
+func (v *VideoInfo) AutomaticCaptionLanguages() []string {
+	return sortedLanguages(v.AutomaticCaptions)
+}
+
+func sortedLanguages(tracks map[string][]SubtitleTrack) []string {
+	languages := make([]string, 0, len(tracks))
+	for language := range tracks {
+		if language == "live_chat" {
+			continue
+		}
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+func (f Format) HasVideo() bool {
+	return f.VCodec != "" && f.VCodec != "none"
+}
+
+func (f Format) HasAudio() bool {
+	return f.ACodec != "" && f.ACodec != "none"
+}
+
+// IsStoryboard reports whether the format is a thumbnail storyboard rather
+// than a media stream.
+func (f Format) IsStoryboard() bool {
+	return f.Protocol == "mhtml" || (!f.HasVideo() && !f.HasAudio())
+}
+
+func (f Format) FormatType() string {
+	switch {
+	case f.HasVideo() && f.HasAudio():
+		return FormatTypeAudioAndVideo
+	case f.HasVideo():
+		return FormatTypeVideoOnly
+	default:
+		return FormatTypeAudioOnly
+	}
+}
+
+// GetVideoInfo returns the video's metadata. Results are cached per video for
+// YTCLIPPER_METADATA_CACHE_TTL_IN_SECONDS; the returned VideoInfo is shared and
+// must not be modified.
+func GetVideoInfo(ctx context.Context, url string) (*VideoInfo, error) {
+	return metadata.get(ctx, url)
+}
+
+// fetchVideoInfo fetches the video's metadata with a single yt-dlp -J call.
+func fetchVideoInfo(ctx context.Context, url string) (*VideoInfo, error) {
+	glogger.Log.Infof("Get Video Info: Fetching metadata for URL %s", url)
+
+	info := new(VideoInfo)
+	output, err := executeJSON(ctx, []string{"-J", "--no-playlist", url}, info)
+	if err != nil {
+		glogger.Log.Errorf(err, "Get Video Info: Error executing yt-dlp. Output\n%s", string(output))
+		return nil, classifyError(string(output), err)
+	}
+
+	if config.CONFIG.Debug {
+		glogger.Log.Infof("Get Video Info: yt-dlp command succeeded. Title: %s, Duration: %.0fs, Formats: %d", info.Title, info.Duration, len(info.Formats))
+	}
+
+	if info.ID == "" {
+		return nil, fmt.Errorf("yt-dlp returned no video metadata for URL %s", url)
+	}
+
+	return info, nil
+}
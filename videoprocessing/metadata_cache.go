@@ -0,0 +1,170 @@
+package videoprocessing
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"ytclipper-go/config"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+	"golang.org/x/sync/singleflight"
+)
+
+// MetadataCacheStats reports how often GetVideoInfo was answered from the cache.
+type MetadataCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+type metadataCacheEntry struct {
+	info      *VideoInfo
+	expiresAt time.Time
+}
+
+// metadataCache keeps yt-dlp metadata per video ID, so the formats, duration
+// and clip requests for one video share a single yt-dlp call. Concurrent misses
+// for the same video are deduplicated; failures are never cached.
+type metadataCache struct {
+	lock    sync.Mutex
+	entries map[string]metadataCacheEntry
+	group   singleflight.Group
+	hits    atomic.Int64
+	misses  atomic.Int64
+	fetch   func(ctx context.Context, url string) (*VideoInfo, error)
+}
+
+var metadata = newMetadataCache(fetchVideoInfo)
+
+func newMetadataCache(fetch func(ctx context.Context, url string) (*VideoInfo, error)) *metadataCache {
+	return &metadataCache{
+		entries: make(map[string]metadataCacheEntry),
+		fetch:   fetch,
+	}
+}
+
+// GetMetadataCacheStats returns the hit and miss counters of the metadata cache.
+func GetMetadataCacheStats() MetadataCacheStats {
+	return metadata.stats()
+}
+
+func (c *metadataCache) stats() MetadataCacheStats {
+	c.lock.Lock()
+	entries := len(c.entries)
+	c.lock.Unlock()
+
+	return MetadataCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// get returns the cached metadata of the video, fetching it on a miss. The
+// returned VideoInfo is shared between callers and must not be modified. The
+// fetch is shared by concurrent callers, so it is detached from ctx and bounded
+// by YTCLIPPER_YT_DLP_COMMAND_TIMEOUT_IN_SECONDS; a caller whose ctx ends stops
+// waiting for it.
+func (c *metadataCache) get(ctx context.Context, videoUrl string) (*VideoInfo, error) {
+	key := videoCacheKey(videoUrl)
+	ttl := time.Duration(config.CONFIG.MetadataCacheConfig.TTLInSeconds) * time.Second
+
+	if info, ok := c.lookup(key); ok {
+		hits := c.hits.Add(1)
+		glogger.Log.Infof("Metadata Cache: Hit for %s (hits: %d, misses: %d)", key, hits, c.misses.Load())
+		return info, nil
+	}
+
+	results := c.group.DoChan(key, func() (any, error) {
+		misses := c.misses.Add(1)
+		glogger.Log.Infof("Metadata Cache: Miss for %s (hits: %d, misses: %d)", key, c.hits.Load(), misses)
+
+		timeout := time.Duration(config.CONFIG.YtDlpConfig.CommandTimeoutInSeconds) * time.Second
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+
+		info, err := c.fetch(fetchCtx, videoUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		if ttl > 0 {
+			c.store(key, info, ttl)
+		}
+		return info, nil
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*VideoInfo), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *metadataCache) lookup(key string) (*VideoInfo, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.info, true
+}
+
+// store adds the entry and drops expired ones, so videos that are looked up
+// only once do not accumulate.
+func (c *metadataCache) store(key string, info *VideoInfo, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for existingKey, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, existingKey)
+		}
+	}
+	c.entries[key] = metadataCacheEntry{info: info, expiresAt: now.Add(ttl)}
+}
+
+// videoCacheKey returns the YouTube video ID of the URL, so different URL forms
+// of one video (youtu.be, shorts, extra query parameters) share an entry. URLs
+// without a recognizable ID are used as is.
+func videoCacheKey(videoUrl string) string {
+	parsed, err := url.Parse(videoUrl)
+	if err != nil {
+		return videoUrl
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	path := strings.Trim(parsed.Path, "/")
+
+	switch host {
+	case "youtu.be":
+		if path != "" {
+			return strings.Split(path, "/")[0]
+		}
+	case "youtube.com", "music.youtube.com":
+		if id := parsed.Query().Get("v"); id != "" {
+			return id
+		}
+		segments := strings.Split(path, "/")
+		if len(segments) == 2 && (segments[0] == "shorts" || segments[0] == "embed" || segments[0] == "live") {
+			return segments[1]
+		}
+	}
+
+	return videoUrl
+}
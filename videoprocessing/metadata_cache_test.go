@@ -0,0 +1,202 @@
+package videoprocessing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"ytclipper-go/config"
+)
+
+func withMetadataCacheTTL(t *testing.T, ttlInSeconds int) {
+	original := config.CONFIG.MetadataCacheConfig.TTLInSeconds
+	config.CONFIG.MetadataCacheConfig.TTLInSeconds = ttlInSeconds
+	t.Cleanup(func() { config.CONFIG.MetadataCacheConfig.TTLInSeconds = original })
+}
+
+func TestMetadataCacheSharesEntryBetweenUrlForms(t *testing.T) {
+	withMetadataCacheTTL(t, 60)
+
+	var calls atomic.Int32
+	cache := newMetadataCache(func(ctx context.Context, url string) (*VideoInfo, error) {
+		calls.Add(1)
+		return &VideoInfo{ID: "dQw4w9WgXcQ"}, nil
+	})
+
+	urls := []string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ",
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s",
+	}
+	for _, url := range urls {
+		if _, err := cache.get(context.Background(), url); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 yt-dlp call, got %d", calls.Load())
+	}
+	if stats := cache.stats(); stats != (MetadataCacheStats{Hits: 2, Misses: 1, Entries: 1}) {
+		t.Errorf("Expected 2 hits, 1 miss and 1 entry, got %+v", stats)
+	}
+}
+
+func TestGetMetadataCacheStats(t *testing.T) {
+	withMetadataCacheTTL(t, 60)
+	original := metadata
+	t.Cleanup(func() { metadata = original })
+	metadata = newMetadataCache(func(ctx context.Context, url string) (*VideoInfo, error) {
+		return &VideoInfo{ID: "example"}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := GetVideoInfo(context.Background(), "https://www.youtube.com/watch?v=example"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if stats := GetMetadataCacheStats(); stats != (MetadataCacheStats{Hits: 2, Misses: 1, Entries: 1}) {
+		t.Errorf("Expected 2 hits, 1 miss and 1 entry, got %+v", stats)
+	}
+}
+
+func TestMetadataCacheDeduplicatesConcurrentMisses(t *testing.T) {
+	withMetadataCacheTTL(t, 60)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	cache := newMetadataCache(func(ctx context.Context, url string) (*VideoInfo, error) {
+		calls.Add(1)
+		<-release
+		return &VideoInfo{ID: "example"}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get(context.Background(), "https://www.youtube.com/watch?v=example"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected concurrent requests to share 1 yt-dlp call, got %d", calls.Load())
+	}
+}
+
+func TestMetadataCacheDoesNotCacheErrors(t *testing.T) {
+	withMetadataCacheTTL(t, 60)
+
+	var calls atomic.Int32
+	cache := newMetadataCache(func(ctx context.Context, url string) (*VideoInfo, error) {
+		if calls.Add(1) == 1 {
+			return nil, errors.New("rate limited")
+		}
+		return &VideoInfo{ID: "example"}, nil
+	})
+
+	url := "https://www.youtube.com/watch?v=example"
+	if _, err := cache.get(context.Background(), url); err == nil {
+		t.Fatal("Expected the first call to fail")
+	}
+	if _, err := cache.get(context.Background(), url); err != nil {
+		t.Fatalf("Expected the second call to retry, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 yt-dlp calls, got %d", calls.Load())
+	}
+}
+
+func TestMetadataCacheDisabledWithZeroTTL(t *testing.T) {
+	withMetadataCacheTTL(t, 0)
+
+	var calls atomic.Int32
+	cache := newMetadataCache(func(ctx context.Context, url string) (*VideoInfo, error) {
+		calls.Add(1)
+		return &VideoInfo{ID: "example"}, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.get(context.Background(), "https://www.youtube.com/watch?v=example"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 yt-dlp calls without caching, got %d", calls.Load())
+	}
+}
+
+func TestMetadataCacheFetchOutlivesCaller(t *testing.T) {
+	withMetadataCacheTTL(t, 60)
+
+	release := make(chan struct{})
+	fetched := make(chan error, 1)
+	cache := newMetadataCache(func(ctx context.Context, url string) (*VideoInfo, error) {
+		<-release
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			t.Error("Expected the fetch to be bounded by the command timeout")
+		}
+		fetched <- ctx.Err()
+		return &VideoInfo{ID: "example"}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := cache.get(ctx, "https://www.youtube.com/watch?v=example"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancelled caller to stop waiting, got %v", err)
+	}
+
+	close(release)
+	if err := <-fetched; err != nil {
+		t.Errorf("Expected the shared fetch to keep running, got %v", err)
+	}
+	if _, err := cache.get(context.Background(), "https://www.youtube.com/watch?v=example"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestMetadataCacheExpiresEntries(t *testing.T) {
+	cache := newMetadataCache(nil)
+	cache.store("expired", &VideoInfo{ID: "expired"}, -time.Second)
+
+	if _, ok := cache.lookup("expired"); ok {
+		t.Error("Expected expired entry to be missing")
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected expired entry to be removed, got %d entries", len(cache.entries))
+	}
+}
+
+func TestVideoCacheKey(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://www.youtube.com/watch?v=abc123", expected: "abc123"},
+		{url: "https://youtube.com/watch?feature=share&v=abc123", expected: "abc123"},
+		{url: "https://m.youtube.com/watch?v=abc123", expected: "abc123"},
+		{url: "https://youtu.be/abc123?si=xyz", expected: "abc123"},
+		{url: "https://www.youtube.com/shorts/abc123", expected: "abc123"},
+		{url: "https://example.com/video", expected: "https://example.com/video"},
+	}
+
+	for _, test := range tests {
+		if key := videoCacheKey(test.url); key != test.expected {
+			t.Errorf("videoCacheKey(%q) = %q, expected %q", test.url, key, test.expected)
+		}
+	}
+}
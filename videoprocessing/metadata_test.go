@@ -0,0 +1,83 @@
+package videoprocessing
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const ytDlpInfoJSON = `{
+	"id": "example",
+	"title": "Example Video",
+	"duration": 225.5,
+	"formats": [
+		{"format_id": "sb0", "ext": "mhtml", "protocol": "mhtml", "vcodec": "none", "acodec": "none", "format_note": "storyboard"},
+		{"format_id": "140", "ext": "m4a", "protocol": "https", "vcodec": "none", "acodec": "mp4a.40.2", "tbr": 129.5, "filesize": 3645123, "format_note": "medium"},
+		{"format_id": "136", "ext": "mp4", "protocol": "https", "width": 1280, "height": 720, "fps": 30, "vcodec": "avc1.4d401f", "acodec": "none", "tbr": 1150.2, "filesize_approx": 32450000, "format_note": "720p"},
+		{"format_id": "18", "ext": "mp4", "protocol": "https", "width": 640, "height": 360, "fps": 30, "vcodec": "avc1.42001E", "acodec": "mp4a.40.2", "tbr": 500.1, "format_note": "360p"}
+	]
+}`
+
+func TestVideoInfoDecodesYtDlpJSON(t *testing.T) {
+	var info VideoInfo
+	if err := json.Unmarshal([]byte(ytDlpInfoJSON), &info); err != nil {
+		t.Fatalf("Failed to decode yt-dlp JSON: %v", err)
+	}
+
+	if info.ID != "example" || info.Title != "Example Video" {
+		t.Errorf("Unexpected id/title: %q/%q", info.ID, info.Title)
+	}
+	if info.Duration != 225.5 {
+		t.Errorf("Expected duration 225.5, got %v", info.Duration)
+	}
+	if len(info.Formats) != 4 {
+		t.Fatalf("Expected 4 formats, got %d", len(info.Formats))
+	}
+
+	video := info.Formats[2]
+	if video.ID != "136" || video.Ext != "mp4" || video.Height != 720 || video.FilesizeApprox != 32450000 {
+		t.Errorf("Unexpected video format: %+v", video)
+	}
+}
+
+func TestFormatType(t *testing.T) {
+	var info VideoInfo
+	if err := json.Unmarshal([]byte(ytDlpInfoJSON), &info); err != nil {
+		t.Fatalf("Failed to decode yt-dlp JSON: %v", err)
+	}
+
+	tests := []struct {
+		formatID   string
+		storyboard bool
+		formatType string
+	}{
+		{formatID: "sb0", storyboard: true},
+		{formatID: "140", formatType: FormatTypeAudioOnly},
+		{formatID: "136", formatType: FormatTypeVideoOnly},
+		{formatID: "18", formatType: FormatTypeAudioAndVideo},
+	}
+
+	for i, test := range tests {
+		format := info.Formats[i]
+		t.Run(test.formatID, func(t *testing.T) {
+			if format.IsStoryboard() != test.storyboard {
+				t.Errorf("Expected IsStoryboard %v, got %v", test.storyboard, format.IsStoryboard())
+			}
+			if !test.storyboard && format.FormatType() != test.formatType {
+				t.Errorf("Expected format type %q, got %q", test.formatType, format.FormatType())
+			}
+		})
+	}
+}
+
+func TestGetFileExtensionFromFormatID(t *testing.T) {
+	formats := []Format{{ID: "140", Ext: "m4a"}, {ID: "136", Ext: "mp4"}}
+
+	extension, err := getFileExtensionFromFormatID("136", formats)
+	if err != nil || extension != ".mp4" {
+		t.Errorf("Expected .mp4, got %q (err=%v)", extension, err)
+	}
+
+	if _, err := getFileExtensionFromFormatID("22", formats); err == nil {
+		t.Error("Expected an error for an unknown format ID")
+	}
+}
@@ -0,0 +1,250 @@
+package videoprocessing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+// Output formats a downloaded clip can be converted into.
+const (
+	OutputFormatMP3  = "mp3"
+	OutputFormatOpus = "opus"
+	OutputFormatFLAC = "flac"
+	OutputFormatWAV  = "wav"
+	OutputFormatGIF  = "gif"
+	OutputFormatWebP = "webp"
+)
+
+// audioCodec describes how ffmpeg encodes an audio output format. Lossless
+// formats have no bitrate.
+type audioCodec struct {
+	extension      string
+	args           []string
+	defaultBitrate int
+	minBitrate     int
+	maxBitrate     int
+}
+
+func (c audioCodec) isLossless() bool {
+	return c.defaultBitrate == 0
+}
+
+var audioCodecs = map[string]audioCodec{
+	// ID3v2.3 is the most widely supported tag version.
+	OutputFormatMP3:  {extension: ".mp3", args: []string{"-c:a", "libmp3lame", "-id3v2_version", "3"}, defaultBitrate: 192, minBitrate: 32, maxBitrate: 320},
+	OutputFormatOpus: {extension: ".opus", args: []string{"-c:a", "libopus"}, defaultBitrate: 128, minBitrate: 6, maxBitrate: 510},
+	OutputFormatFLAC: {extension: ".flac", args: []string{"-c:a", "flac"}},
+	OutputFormatWAV:  {extension: ".wav", args: []string{"-c:a", "pcm_s16le"}},
+}
+
+// IsAudioOutput reports whether the output format extracts only the audio.
+func IsAudioOutput(format string) bool {
+	_, ok := audioCodecs[format]
+	return ok
+}
+
+// ValidateClipOutput checks that the output format is supported and that its
+// options are within the range of the format.
+func ValidateClipOutput(output jobs.ClipOutput) error {
+	switch {
+	case IsAudioOutput(output.Format):
+		return validateAudioOutput(output)
+	case IsAnimationOutput(output.Format):
+		return validateAnimationOutput(output)
+	case IsVideoOutput(output.Format):
+		return validateVideoOutput(output)
+	}
+
+	return fmt.Errorf("Invalid output format. Use %s, %s, %s, %s, %s, %s or %s.", OutputFormatMP3, OutputFormatOpus, OutputFormatFLAC, OutputFormatWAV, OutputFormatGIF, OutputFormatWebP, OutputFormatMP4)
+}
+
+func validateAudioOutput(output jobs.ClipOutput) error {
+	codec := audioCodecs[output.Format]
+	if output.HasVideoOptions() {
+		return errVideoOptions
+	}
+	if output.FPS != 0 || output.Width != 0 || output.Loop != 0 {
+		return fmt.Errorf("The fps, width and loop options only apply to %s and %s.", OutputFormatGIF, OutputFormatWebP)
+	}
+
+	if output.Bitrate == 0 {
+		return nil
+	}
+	if codec.isLossless() {
+		return fmt.Errorf("%s is lossless and does not take a bitrate.", strings.ToUpper(output.Format))
+	}
+	if output.Bitrate < codec.minBitrate || output.Bitrate > codec.maxBitrate {
+		return fmt.Errorf("Invalid bitrate. %s supports %d to %d kbit/s.", strings.ToUpper(output.Format), codec.minBitrate, codec.maxBitrate)
+	}
+	return nil
+}
+
+// MediaTags are written into converted files: ID3 tags for MP3, Vorbis
+// comments for Opus and FLAC and INFO tags for WAV.
+type MediaTags struct {
+	Title  string
+	Artist string
+}
+
+// ConvertClip converts the clip at sourcePath into the requested output format
+// at outputPath and returns ffmpeg's output. Progress is reported with the
+// convert stage. Tags are only written into audio files; subtitles at
+// subtitlesPath, if any, are burned into MP4 outputs.
+func ConvertClip(ctx context.Context, sourcePath string, outputPath string, output jobs.ClipOutput, tags MediaTags, subtitlesPath string, clipDurationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	switch {
+	case IsAudioOutput(output.Format):
+		return convertAudio(ctx, sourcePath, outputPath, output, tags, clipDurationInSeconds, onProgress)
+	case IsAnimationOutput(output.Format):
+		return convertAnimation(ctx, sourcePath, outputPath, output, clipDurationInSeconds, onProgress)
+	case IsVideoOutput(output.Format):
+		return convertVideo(ctx, sourcePath, outputPath, output, subtitlesPath, clipDurationInSeconds, onProgress)
+	}
+
+	return nil, fmt.Errorf("unsupported output format %q", output.Format)
+}
+
+func convertAudio(ctx context.Context, sourcePath string, outputPath string, output jobs.ClipOutput, tags MediaTags, clipDurationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	codec := audioCodecs[output.Format]
+
+	cmdArgs := []string{
+		"-hide_banner", "-nostdin", "-y",
+		"-i", sourcePath,
+		"-vn",
+		"-map_metadata", "-1",
+	}
+	cmdArgs = append(cmdArgs, tagArgs(tags)...)
+	cmdArgs = append(cmdArgs, codec.args...)
+	if !codec.isLossless() {
+		bitrate := output.Bitrate
+		if bitrate == 0 {
+			bitrate = codec.defaultBitrate
+		}
+		cmdArgs = append(cmdArgs, "-b:a", fmt.Sprintf("%dk", bitrate))
+	}
+	cmdArgs = append(cmdArgs, "-progress", "pipe:1", "-nostats", outputPath)
+
+	return executeFFmpeg(ctx, cmdArgs, progressLineHandler(clipDurationInSeconds, convertProgress(onProgress, 0, 1)))
+}
+
+// convertProgress reports the progress of one of several ffmpeg passes as part
+// of a single convert stage, e.g. the second of two passes as 50-100%.
+func convertProgress(onProgress func(progress jobs.JobProgress), pass int, passes int) func(progress jobs.JobProgress) {
+	if onProgress == nil {
+		return nil
+	}
+
+	return func(progress jobs.JobProgress) {
+		progress.Stage = jobs.ProgressStageConvert
+		progress.Percent = (float64(pass)*100 + progress.Percent) / float64(passes)
+		onProgress(progress)
+	}
+}
+
+func tagArgs(tags MediaTags) []string {
+	var args []string
+	if tags.Title != "" {
+		args = append(args, "-metadata", "title="+tags.Title)
+	}
+	if tags.Artist != "" {
+		args = append(args, "-metadata", "artist="+tags.Artist)
+	}
+	return args
+}
+
+// outputExtension returns the file extension of the output format, including
+// the leading dot.
+func outputExtension(format string) string {
+	if codec, ok := audioCodecs[format]; ok {
+		return codec.extension
+	}
+	return "." + format
+}
+
+// outputError reports an output that cannot be made from the clip: a download
+// that lacks the stream the output is made from, e.g. silent video for MP3, or
+// a clip too long for its target size.
+func outputError(output jobs.ClipOutput, hasVideo bool, hasAudio bool, clipDurationInSeconds float64) *ProcessingError {
+	if IsAudioOutput(output.Format) && !hasAudio {
+		return &ProcessingError{
+			Code:    ErrorCodeFormatUnavailable,
+			Message: "The selected format has no audio. Please choose a format with audio to extract it.",
+		}
+	}
+	if (IsAnimationOutput(output.Format) || IsVideoOutput(output.Format)) && !hasVideo {
+		return &ProcessingError{
+			Code:    ErrorCodeFormatUnavailable,
+			Message: fmt.Sprintf("The selected format has no video. Please choose a video format to create a %s.", strings.ToUpper(output.Format)),
+		}
+	}
+	if output.TargetSizeInMb > 0 {
+		if _, _, err := targetBitrates(output.TargetSizeInMb, clipDurationInSeconds); err != nil {
+			return conversionError("", err)
+		}
+	}
+	return nil
+}
+
+// convertJobClip converts the downloaded clip of a job as requested by its
+// output option, burning in the subtitles at subtitlesPath, if any. The
+// download is removed afterwards; the returned path is the converted file.
+func convertJobClip(ctx context.Context, jobID string, request jobs.JobRequest, sourcePath string, subtitlesPath string, onProgress func(progress jobs.JobProgress)) (string, error) {
+	defer os.Remove(sourcePath)
+
+	outputPath := filepath.Join(videoOutputDir, filepath.Base(jobID)+outputExtension(request.Output.Format))
+	output, err := ConvertClip(ctx, sourcePath, outputPath, *request.Output, clipTags(ctx, request), subtitlesPath, requestLengthInSeconds(request), onProgress)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: Failed to convert clip of job %s: %s", jobID, string(output))
+		return "", conversionError(string(output), err)
+	}
+
+	return outputPath, nil
+}
+
+// clipTags tags the clip with the video title and channel. Chapter clips are
+// titled "Video title - Chapter title". Without metadata the clip is untagged.
+func clipTags(ctx context.Context, request jobs.JobRequest) MediaTags {
+	info, err := GetVideoInfo(ctx, request.Url)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: Could not fetch tags for %s", request.Url)
+		return MediaTags{}
+	}
+
+	tags := MediaTags{Title: info.Title, Artist: info.ChannelName()}
+	if request.ChapterTitle != "" {
+		tags.Title = fmt.Sprintf("%s - %s", info.Title, request.ChapterTitle)
+	}
+	return tags
+}
+
+func conversionError(output string, err error) *ProcessingError {
+	var processingErr *ProcessingError
+	if errors.As(err, &processingErr) {
+		return processingErr
+	}
+	if errors.Is(err, ErrCommandTimeout) {
+		return classifyError(output, err)
+	}
+
+	return &ProcessingError{
+		Code:    ErrorCodeConversionFailed,
+		Message: "The clip could not be converted into the requested format.",
+		Output:  output,
+		Err:     err,
+	}
+}
+
+// executeFFmpeg runs ffmpeg with YTCLIPPER_FFMPEG_COMMAND_TIMEOUT_IN_SECONDS.
+// The yt-dlp flags from commonArgs do not apply.
+func executeFFmpeg(ctx context.Context, args []string, onLine func(line string) bool) ([]byte, error) {
+	timeout := time.Duration(config.CONFIG.FFmpegConfig.CommandTimeoutInSeconds) * time.Second
+	return executeWithTimeout(ctx, timeout, onLine, "ffmpeg", args...)
+}
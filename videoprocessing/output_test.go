@@ -0,0 +1,86 @@
+package videoprocessing
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestConvertClipToMP3(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("echo", "mock")
+	}
+
+	tags := MediaTags{Title: "Example Video", Artist: "Example Channel"}
+	_, _ = ConvertClip(context.Background(), "videos/job.source.webm", "videos/job.mp3", jobs.ClipOutput{Format: OutputFormatMP3}, tags, "", 10, nil)
+
+	if len(capturedArgs) == 0 || capturedArgs[0] != "ffmpeg" {
+		t.Fatalf("Expected first arg to be 'ffmpeg', got %v", capturedArgs)
+	}
+	if hasFlag(capturedArgs, "--no-warnings") {
+		t.Error("Expected yt-dlp flags to be absent from the ffmpeg command")
+	}
+	if v, ok := flagValue(capturedArgs, "-i"); !ok || v != "videos/job.source.webm" {
+		t.Errorf("Expected -i videos/job.source.webm, got %q (present=%v)", v, ok)
+	}
+	if !hasFlag(capturedArgs, "-vn") {
+		t.Error("Expected -vn argument to be present")
+	}
+	if v, ok := flagValue(capturedArgs, "-c:a"); !ok || v != "libmp3lame" {
+		t.Errorf("Expected -c:a libmp3lame, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(capturedArgs, "-b:a"); !ok || v != "192k" {
+		t.Errorf("Expected default bitrate 192k, got %q (present=%v)", v, ok)
+	}
+	if !hasFlag(capturedArgs, "title=Example Video") || !hasFlag(capturedArgs, "artist=Example Channel") {
+		t.Errorf("Expected title and artist tags, got %v", capturedArgs)
+	}
+	if capturedArgs[len(capturedArgs)-1] != "videos/job.mp3" {
+		t.Errorf("Expected output path last, got %v", capturedArgs)
+	}
+}
+
+func TestConvertClipLosslessHasNoBitrate(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("echo", "mock")
+	}
+
+	_, _ = ConvertClip(context.Background(), "videos/job.source.m4a", "videos/job.flac", jobs.ClipOutput{Format: OutputFormatFLAC}, MediaTags{}, "", 10, nil)
+
+	if v, ok := flagValue(capturedArgs, "-c:a"); !ok || v != "flac" {
+		t.Errorf("Expected -c:a flac, got %q (present=%v)", v, ok)
+	}
+	if hasFlag(capturedArgs, "-b:a") || hasFlag(capturedArgs, "-metadata") {
+		t.Errorf("Expected no bitrate and no tags, got %v", capturedArgs)
+	}
+}
+
+func TestClipTags(t *testing.T) {
+	url := "https://www.youtube.com/watch?v=tagged00001"
+	withCachedVideoInfo(t, url, &VideoInfo{ID: "tagged00001", Title: "Live Set", Uploader: "Example Uploader"})
+
+	tags := clipTags(context.Background(), jobs.JobRequest{Url: url, ChapterTitle: "Encore"})
+	if tags.Title != "Live Set - Encore" || tags.Artist != "Example Uploader" {
+		t.Errorf("Unexpected tags: %+v", tags)
+	}
+}
+
+func TestConversionErrorKeepsTimeouts(t *testing.T) {
+	if err := conversionError("", ErrCommandTimeout); err.Code != ErrorCodeTimeout {
+		t.Errorf("Expected %q, got %q", ErrorCodeTimeout, err.Code)
+	}
+	if err := conversionError("Unknown encoder 'libmp3lame'", exec.ErrNotFound); err.Code != ErrorCodeConversionFailed {
+		t.Errorf("Expected %q, got %q", ErrorCodeConversionFailed, err.Code)
+	}
+}
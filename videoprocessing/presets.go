@@ -0,0 +1,127 @@
+package videoprocessing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"ytclipper-go/jobs"
+)
+
+// Preset is a named clip configuration for users who do not know yt-dlp
+// format IDs. Format is a yt-dlp format selector, Container the format yt-dlp
+// merges separate video and audio into, and Output how ffmpeg converts the
+// download afterwards.
+type Preset struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Format      string           `json:"format"`
+	Container   string           `json:"container,omitempty"`
+	Output      *jobs.ClipOutput `json:"output,omitempty"`
+}
+
+var presetIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var presetContainers = map[string]bool{"": true, "mp4": true, "webm": true, "mkv": true}
+
+// presets are replaced by LoadPresets on startup and read-only afterwards.
+var presets = defaultPresets()
+
+func defaultPresets() []Preset {
+	return []Preset{
+		{
+			ID:          "discord-720p",
+			Name:        "Discord 720p",
+			Description: "720p MP4 that fits Discord's 10 MB upload limit",
+			Format:      "bv*[height<=720]+ba/b[height<=720]/b",
+			Container:   "mp4",
+			Output:      &jobs.ClipOutput{Format: OutputFormatMP4, MaxHeight: 720, TargetSizeInMb: 10},
+		},
+		{
+			ID:          "twitter-vertical",
+			Name:        "Twitter vertical",
+			Description: "9:16 MP4 cropped around the center, up to 1280px high",
+			Format:      "bv*[height<=1080]+ba/b[height<=1080]/b",
+			Container:   "mp4",
+			Output:      &jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16", MaxHeight: 1280, VideoBitrate: 5000, Bitrate: 128},
+		},
+		{
+			ID:          "podcast-mp3",
+			Name:        "Podcast MP3",
+			Description: "Audio only, 128 kbit/s MP3 tagged with title and channel",
+			Format:      "ba/b",
+			Output:      &jobs.ClipOutput{Format: OutputFormatMP3, Bitrate: 128},
+		},
+		{
+			ID:          "chat-gif",
+			Name:        "Chat GIF",
+			Description: "480px GIF at 15 fps, looping forever",
+			Format:      "bv*[height<=480]/b[height<=480]/b",
+			Output:      &jobs.ClipOutput{Format: OutputFormatGIF},
+		},
+	}
+}
+
+// LoadPresets replaces the built-in presets with the ones in the JSON file at
+// path. An empty path keeps the built-in presets.
+func LoadPresets(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var loaded []Preset
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("could not decode presets in %s: %w", path, err)
+	}
+	if err := validatePresets(loaded); err != nil {
+		return fmt.Errorf("invalid presets in %s: %w", path, err)
+	}
+
+	presets = loaded
+	return nil
+}
+
+func validatePresets(loaded []Preset) error {
+	ids := make(map[string]bool, len(loaded))
+	for _, preset := range loaded {
+		switch {
+		case !presetIDPattern.MatchString(preset.ID):
+			return fmt.Errorf("preset ID %q must be lowercase letters, digits and dashes", preset.ID)
+		case ids[preset.ID]:
+			return fmt.Errorf("preset ID %q is used twice", preset.ID)
+		case preset.Name == "":
+			return fmt.Errorf("preset %q has no name", preset.ID)
+		case preset.Format == "":
+			return fmt.Errorf("preset %q has no format selector", preset.ID)
+		case !presetContainers[preset.Container]:
+			return fmt.Errorf("preset %q has unsupported container %q", preset.ID, preset.Container)
+		}
+		if preset.Output != nil {
+			if err := ValidateClipOutput(*preset.Output); err != nil {
+				return fmt.Errorf("preset %q: %w", preset.ID, err)
+			}
+		}
+		ids[preset.ID] = true
+	}
+	return nil
+}
+
+// GetPresets returns the presets in the order they were configured.
+func GetPresets() []Preset {
+	return presets
+}
+
+func GetPreset(id string) (Preset, bool) {
+	for _, preset := range presets {
+		if preset.ID == id {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
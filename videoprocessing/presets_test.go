@@ -0,0 +1,72 @@
+package videoprocessing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestDefaultPresetsAreValid(t *testing.T) {
+	if err := validatePresets(defaultPresets()); err != nil {
+		t.Errorf("Expected the built-in presets to be valid, got %v", err)
+	}
+}
+
+func TestLoadPresets(t *testing.T) {
+	defer func() { presets = defaultPresets() }()
+
+	path := filepath.Join(t.TempDir(), "presets.json")
+	data := `[{"id": "mastodon", "name": "Mastodon", "format": "bv*+ba/b", "container": "mp4", "output": {"format": "mp4", "maxHeight": 1080, "targetSizeInMb": 40}}]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadPresets(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(GetPresets()) != 1 {
+		t.Fatalf("Expected the file to replace the built-in presets, got %+v", GetPresets())
+	}
+	preset, exists := GetPreset("mastodon")
+	if !exists || preset.Output == nil || preset.Output.TargetSizeInMb != 40 {
+		t.Errorf("Unexpected preset: %+v", preset)
+	}
+	if _, exists := GetPreset("discord-720p"); exists {
+		t.Error("Expected built-in presets to be gone")
+	}
+}
+
+func TestLoadPresetsWithoutPathKeepsDefaults(t *testing.T) {
+	if err := LoadPresets(""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(GetPresets()) != len(defaultPresets()) {
+		t.Errorf("Expected the built-in presets, got %+v", GetPresets())
+	}
+}
+
+func TestValidatePresets(t *testing.T) {
+	tests := []struct {
+		name        string
+		presets     []Preset
+		expectedErr string
+	}{
+		{"Invalid ID", []Preset{{ID: "Discord HD", Name: "Discord", Format: "b"}}, "lowercase letters"},
+		{"Duplicate ID", []Preset{{ID: "a", Name: "A", Format: "b"}, {ID: "a", Name: "B", Format: "b"}}, "used twice"},
+		{"Missing name", []Preset{{ID: "a", Format: "b"}}, "has no name"},
+		{"Missing format", []Preset{{ID: "a", Name: "A"}}, "has no format selector"},
+		{"Unsupported container", []Preset{{ID: "a", Name: "A", Format: "b", Container: "avi"}}, "unsupported container"},
+		{"Invalid output", []Preset{{ID: "a", Name: "A", Format: "b", Output: &jobs.ClipOutput{Format: "mp4", FPS: 10}}}, "only apply to gif and webp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePresets(tt.presets)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package videoprocessing
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startProcessGroup puts the command in its own process group, so killing it
+// also kills the ffmpeg processes yt-dlp spawns.
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
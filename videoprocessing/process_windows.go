@@ -0,0 +1,16 @@
+//go:build windows
+
+package videoprocessing
+
+import (
+	"os/exec"
+)
+
+func startProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,142 @@
+package videoprocessing
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"ytclipper-go/jobs"
+)
+
+// progressPrefix marks the lines yt-dlp prints through --progress-template.
+const progressPrefix = "ytclipper-progress:"
+
+// ytDlpProgressTemplate makes yt-dlp print one parseable line per progress
+// update: downloaded bytes, total bytes, speed in bytes/s and ETA in seconds.
+// Missing values are printed as NA.
+const ytDlpProgressTemplate = "download:" + progressPrefix +
+	"%(progress.downloaded_bytes)s/%(progress.total_bytes,progress.total_bytes_estimate)s/%(progress.speed)s/%(progress.eta)s"
+
+// progressParser turns yt-dlp progress-template lines and ffmpeg -progress
+// key=value blocks into job progress. With --download-sections yt-dlp hands the
+// download to ffmpeg, so most of a clip's progress comes from ffmpeg.
+type progressParser struct {
+	clipDurationInSeconds float64
+	startedAt             time.Time
+	ffmpeg                map[string]string
+}
+
+func newProgressParser(clipDurationInSeconds float64) *progressParser {
+	return &progressParser{
+		clipDurationInSeconds: clipDurationInSeconds,
+		startedAt:             time.Now(),
+		ffmpeg:                make(map[string]string),
+	}
+}
+
+// progressLineHandler returns an output line handler that reports the progress
+// of a command to onProgress, or nil if there is nobody to report to.
+func progressLineHandler(clipDurationInSeconds float64, onProgress func(progress jobs.JobProgress)) func(line string) bool {
+	if onProgress == nil {
+		return nil
+	}
+
+	parser := newProgressParser(clipDurationInSeconds)
+	return func(line string) bool {
+		progress, ok := parser.parseLine(line)
+		if ok {
+			onProgress(progress)
+		}
+		return ok
+	}
+}
+
+// parseLine consumes one output line and returns the progress it completes, if any.
+func (p *progressParser) parseLine(line string) (jobs.JobProgress, bool) {
+	line = strings.TrimSpace(line)
+
+	if index := strings.Index(line, progressPrefix); index >= 0 {
+		return parseYtDlpProgress(line[index+len(progressPrefix):])
+	}
+
+	key, value, found := strings.Cut(line, "=")
+	if !found || strings.ContainsAny(key, " \t") {
+		return jobs.JobProgress{}, false
+	}
+
+	p.ffmpeg[key] = strings.TrimSpace(value)
+	if key != "progress" {
+		return jobs.JobProgress{}, false
+	}
+
+	progress := p.ffmpegProgress()
+	p.ffmpeg = make(map[string]string)
+	return progress, true
+}
+
+func (p *progressParser) ffmpegProgress() jobs.JobProgress {
+	progress := jobs.JobProgress{Stage: jobs.ProgressStageEncode}
+
+	outTime := parseFloat(p.ffmpeg["out_time_us"])
+	if outTime == 0 {
+		outTime = parseFloat(p.ffmpeg["out_time_ms"])
+	}
+	outTimeInSeconds := outTime / float64(time.Second/time.Microsecond)
+
+	if p.clipDurationInSeconds > 0 {
+		progress.Percent = clampPercent(outTimeInSeconds / p.clipDurationInSeconds * 100)
+	}
+	if p.ffmpeg["progress"] == "end" {
+		progress.Percent = 100
+	}
+
+	progress.DownloadedBytes = int64(parseFloat(p.ffmpeg["total_size"]))
+	if elapsed := time.Since(p.startedAt).Seconds(); elapsed > 0 {
+		progress.Speed = float64(progress.DownloadedBytes) / elapsed
+	}
+
+	speed := parseFloat(strings.TrimSuffix(p.ffmpeg["speed"], "x"))
+	if speed > 0 && p.clipDurationInSeconds > outTimeInSeconds {
+		progress.EtaInSeconds = int((p.clipDurationInSeconds - outTimeInSeconds) / speed)
+	}
+
+	return progress
+}
+
+func parseYtDlpProgress(value string) (jobs.JobProgress, bool) {
+	fields := strings.Split(value, "/")
+	if len(fields) != 4 {
+		return jobs.JobProgress{}, false
+	}
+
+	progress := jobs.JobProgress{
+		Stage:           jobs.ProgressStageDownload,
+		DownloadedBytes: int64(parseFloat(fields[0])),
+		TotalBytes:      int64(parseFloat(fields[1])),
+		Speed:           parseFloat(fields[2]),
+		EtaInSeconds:    int(parseFloat(fields[3])),
+	}
+	if progress.TotalBytes > 0 {
+		progress.Percent = clampPercent(float64(progress.DownloadedBytes) / float64(progress.TotalBytes) * 100)
+	}
+
+	return progress, true
+}
+
+// parseFloat returns 0 for values yt-dlp and ffmpeg print when unknown (NA, N/A).
+func parseFloat(value string) float64 {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+func clampPercent(percent float64) float64 {
+	if percent < 0 {
+		return 0
+	}
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
@@ -0,0 +1,94 @@
+package videoprocessing
+
+import (
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestParseYtDlpProgressLine(t *testing.T) {
+	parser := newProgressParser(30)
+
+	progress, ok := parser.parseLine("ytclipper-progress:524288/1048576/131072.5/4")
+	if !ok {
+		t.Fatal("Expected yt-dlp progress line to be parsed")
+	}
+
+	if progress.Stage != jobs.ProgressStageDownload {
+		t.Errorf("Expected stage %q, got %q", jobs.ProgressStageDownload, progress.Stage)
+	}
+	if progress.Percent != 50 {
+		t.Errorf("Expected 50%%, got %v", progress.Percent)
+	}
+	if progress.DownloadedBytes != 524288 || progress.TotalBytes != 1048576 {
+		t.Errorf("Unexpected byte counts: %+v", progress)
+	}
+	if progress.Speed != 131072.5 || progress.EtaInSeconds != 4 {
+		t.Errorf("Unexpected speed or ETA: %+v", progress)
+	}
+}
+
+func TestParseYtDlpProgressLineWithUnknownValues(t *testing.T) {
+	parser := newProgressParser(30)
+
+	progress, ok := parser.parseLine("ytclipper-progress:1024/NA/NA/NA")
+	if !ok {
+		t.Fatal("Expected yt-dlp progress line to be parsed")
+	}
+	if progress.Percent != 0 || progress.TotalBytes != 0 || progress.DownloadedBytes != 1024 {
+		t.Errorf("Unexpected progress for unknown total: %+v", progress)
+	}
+}
+
+func TestParseFfmpegProgressBlock(t *testing.T) {
+	parser := newProgressParser(20)
+
+	block := []string{
+		"frame=240",
+		"total_size=2097152",
+		"out_time_us=10000000",
+		"out_time=00:00:10.000000",
+		"speed=2.0x",
+	}
+	for _, line := range block {
+		if _, ok := parser.parseLine(line); ok {
+			t.Fatalf("Did not expect progress before the progress= line, got one for %q", line)
+		}
+	}
+
+	progress, ok := parser.parseLine("progress=continue")
+	if !ok {
+		t.Fatal("Expected ffmpeg progress block to be parsed")
+	}
+
+	if progress.Stage != jobs.ProgressStageEncode {
+		t.Errorf("Expected stage %q, got %q", jobs.ProgressStageEncode, progress.Stage)
+	}
+	if progress.Percent != 50 {
+		t.Errorf("Expected 50%%, got %v", progress.Percent)
+	}
+	if progress.DownloadedBytes != 2097152 {
+		t.Errorf("Expected 2097152 bytes, got %d", progress.DownloadedBytes)
+	}
+	if progress.EtaInSeconds != 5 {
+		t.Errorf("Expected ETA of 5 seconds, got %d", progress.EtaInSeconds)
+	}
+
+	progress, _ = parser.parseLine("progress=end")
+	if progress.Percent != 100 {
+		t.Errorf("Expected 100%% at progress=end, got %v", progress.Percent)
+	}
+}
+
+func TestParseLineIgnoresOtherOutput(t *testing.T) {
+	parser := newProgressParser(20)
+
+	for _, line := range []string{
+		"[youtube] Extracting URL: https://www.youtube.com/watch?v=example",
+		"[debug] Command-line config: ['-o', 'videos/x.mp4']",
+		"ERROR: Video unavailable",
+	} {
+		if _, ok := parser.parseLine(line); ok {
+			t.Errorf("Did not expect progress for %q", line)
+		}
+	}
+}
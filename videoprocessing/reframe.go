@@ -0,0 +1,89 @@
+package videoprocessing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"ytclipper-go/jobs"
+)
+
+// Crop modes of reframed video. Center and offset cut the frame down to the
+// aspect ratio; pad keeps the whole frame and fills the rest with a blurred,
+// cropped copy of it, as is common on Shorts, Reels and TikTok.
+const (
+	CropModeCenter = "center"
+	CropModeOffset = "offset"
+	CropModePad    = "pad"
+)
+
+const (
+	maxAspectRatioTerm = 32
+	padBlurRadius      = 20
+)
+
+func validateReframe(output jobs.ClipOutput) error {
+	if output.AspectRatio == "" {
+		if output.CropMode != "" || output.CropOffset != 0 {
+			return fmt.Errorf("The cropMode and cropOffset options need an aspectRatio.")
+		}
+		return nil
+	}
+	if _, _, err := parseAspectRatio(output.AspectRatio); err != nil {
+		return err
+	}
+
+	switch output.CropMode {
+	case "", CropModeCenter, CropModePad:
+		if output.CropOffset != 0 {
+			return fmt.Errorf("The cropOffset option only applies to cropMode %s.", CropModeOffset)
+		}
+	case CropModeOffset:
+		if output.CropOffset < 0 || output.CropOffset > 1 {
+			return fmt.Errorf("Invalid crop offset. Use 0 (left or top) to 1 (right or bottom).")
+		}
+	default:
+		return fmt.Errorf("Invalid crop mode. Use %s, %s or %s.", CropModeCenter, CropModeOffset, CropModePad)
+	}
+	return nil
+}
+
+// parseAspectRatio parses an aspect ratio such as 9:16.
+func parseAspectRatio(aspectRatio string) (int, int, error) {
+	width, height, found := strings.Cut(aspectRatio, ":")
+	w, wErr := strconv.Atoi(width)
+	h, hErr := strconv.Atoi(height)
+	if !found || wErr != nil || hErr != nil || w < 1 || h < 1 || w > maxAspectRatioTerm || h > maxAspectRatioTerm {
+		return 0, 0, fmt.Errorf("Invalid aspect ratio. Use width:height, e.g. 9:16.")
+	}
+	return w, h, nil
+}
+
+// reframeFilter returns the ffmpeg filter that brings the video to the aspect
+// ratio of the output, or "" to keep it. The reframed size is the largest one
+// with the aspect ratio that fits into the source, so only one side is ever
+// cut. Dimensions are kept even for H.264.
+func reframeFilter(output jobs.ClipOutput) string {
+	w, h, err := parseAspectRatio(output.AspectRatio)
+	if err != nil {
+		return ""
+	}
+	width := fmt.Sprintf("'trunc(min(iw,ih*%d/%d)/2)*2'", w, h)
+	height := fmt.Sprintf("'trunc(min(ih,iw*%d/%d)/2)*2'", h, w)
+
+	switch output.CropMode {
+	case CropModeOffset:
+		// The offset positions the crop along the side that is cut, so it
+		// works for landscape and portrait sources alike.
+		offset := strconv.FormatFloat(output.CropOffset, 'f', -1, 64)
+		return fmt.Sprintf("crop=%s:%s:'(iw-ow)*%s':'(ih-oh)*%s'", width, height, offset, offset)
+	case CropModePad:
+		return strings.Join([]string{
+			"split[reframe_bg][reframe_fg]",
+			fmt.Sprintf("[reframe_bg]crop=%s:%s,boxblur=%d:2[reframe_blur]", width, height, padBlurRadius),
+			fmt.Sprintf("[reframe_fg]scale=%s:%s:force_original_aspect_ratio=decrease:force_divisible_by=2[reframe_frame]", width, height),
+			"[reframe_blur][reframe_frame]overlay=(W-w)/2:(H-h)/2",
+		}, ";")
+	default:
+		return fmt.Sprintf("crop=%s:%s", width, height)
+	}
+}
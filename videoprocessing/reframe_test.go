@@ -0,0 +1,84 @@
+package videoprocessing
+
+import (
+	"strings"
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestReframeFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   jobs.ClipOutput
+		expected string
+	}{
+		{"No aspect ratio", jobs.ClipOutput{Format: OutputFormatMP4}, ""},
+		{"Center", jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16"}, "crop='trunc(min(iw,ih*9/16)/2)*2':'trunc(min(ih,iw*16/9)/2)*2'"},
+		{"Offset", jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "1:1", CropMode: CropModeOffset, CropOffset: 0.25}, "crop='trunc(min(iw,ih*1/1)/2)*2':'trunc(min(ih,iw*1/1)/2)*2':'(iw-ow)*0.25':'(ih-oh)*0.25'"},
+		{"Offset at the left edge", jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "4:5", CropMode: CropModeOffset}, "crop='trunc(min(iw,ih*4/5)/2)*2':'trunc(min(ih,iw*5/4)/2)*2':'(iw-ow)*0':'(ih-oh)*0'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if filter := reframeFilter(tt.output); filter != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, filter)
+			}
+		})
+	}
+}
+
+func TestReframeFilterPadsWithBlurredBackground(t *testing.T) {
+	filter := reframeFilter(jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16", CropMode: CropModePad})
+
+	chains := strings.Split(filter, ";")
+	if len(chains) != 4 || !strings.HasPrefix(chains[0], "split") {
+		t.Fatalf("Expected the frame to be split into background and foreground, got %q", filter)
+	}
+	if !strings.Contains(chains[1], "crop='trunc(min(iw,ih*9/16)/2)*2'") || !strings.Contains(chains[1], "boxblur") {
+		t.Errorf("Expected a blurred center crop as background, got %q", chains[1])
+	}
+	if !strings.Contains(chains[2], "force_original_aspect_ratio=decrease") {
+		t.Errorf("Expected the whole frame scaled into the reframed size, got %q", chains[2])
+	}
+	if chains[3] != "[reframe_blur][reframe_frame]overlay=(W-w)/2:(H-h)/2" {
+		t.Errorf("Expected the frame centered over the background, got %q", chains[3])
+	}
+
+	// The max height scales the composed frame.
+	filters := videoFilters(jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16", CropMode: CropModePad, MaxHeight: 1280}, "")
+	if len(filters) != 2 || filters[0] != filter {
+		t.Errorf("Expected the pad filter followed by the scale, got %v", filters)
+	}
+}
+
+func TestValidateReframe(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      jobs.ClipOutput
+		expectedMsg string
+	}{
+		{"Center by default", jobs.ClipOutput{AspectRatio: "9:16"}, ""},
+		{"Pad", jobs.ClipOutput{AspectRatio: "1:1", CropMode: CropModePad}, ""},
+		{"Offset", jobs.ClipOutput{AspectRatio: "4:5", CropMode: CropModeOffset, CropOffset: 1}, ""},
+		{"Crop mode without aspect ratio", jobs.ClipOutput{CropMode: CropModePad}, "The cropMode and cropOffset options need an aspectRatio."},
+		{"Offset without offset mode", jobs.ClipOutput{AspectRatio: "9:16", CropOffset: 0.3}, "The cropOffset option only applies to cropMode offset."},
+		{"Offset out of range", jobs.ClipOutput{AspectRatio: "9:16", CropMode: CropModeOffset, CropOffset: 1.5}, "Invalid crop offset. Use 0 (left or top) to 1 (right or bottom)."},
+		{"Unknown crop mode", jobs.ClipOutput{AspectRatio: "9:16", CropMode: "zoom"}, "Invalid crop mode. Use center, offset or pad."},
+		{"Invalid aspect ratio", jobs.ClipOutput{AspectRatio: "vertical"}, "Invalid aspect ratio. Use width:height, e.g. 9:16."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateReframe(tt.output)
+			if tt.expectedMsg == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedMsg {
+				t.Errorf("Expected error message %q, got %v", tt.expectedMsg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package videoprocessing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"ytclipper-go/jobs"
+	"ytclipper-go/utils"
+)
+
+// ClipRequestKey returns the content address of the clip a request produces.
+// Requests for the same video, range, format and options share the key, no
+// matter how their URLs and timestamps are written, e.g. youtu.be/ID and
+// youtube.com/watch?v=ID or 65, 00:01:05 and 00:01:05.000.
+func ClipRequestKey(request jobs.JobRequest) string {
+	request.Url = videoCacheKey(request.Url)
+	request.From = normalizeTimestamp(request.From)
+	request.To = normalizeTimestamp(request.To)
+
+	segments := request.Segments
+	request.Segments = nil
+	for _, segment := range segments {
+		request.Segments = append(request.Segments, jobs.ClipSegment{From: normalizeTimestamp(segment.From), To: normalizeTimestamp(segment.To)})
+	}
+
+	// JobRequest holds strings, numbers and bools, directly or in slices and
+	// pointers, so marshalling it cannot fail. Struct fields are written in
+	// declaration order, so equal requests give equal JSON.
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeTimestamp(timestamp string) string {
+	if timestamp == "" {
+		return ""
+	}
+	seconds, err := utils.ToSeconds(timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
@@ -0,0 +1,49 @@
+package videoprocessing
+
+import (
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+func TestClipRequestKeyNormalizesUrlsAndTimestamps(t *testing.T) {
+	key := ClipRequestKey(jobs.JobRequest{Url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", From: "00:01:05", To: "00:01:20", Format: "22"})
+
+	same := []jobs.JobRequest{
+		{Url: "https://youtu.be/dQw4w9WgXcQ", From: "65", To: "80", Format: "22"},
+		{Url: "https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=30", From: "65", To: "00:01:20.000", Format: "22"},
+	}
+	for _, request := range same {
+		if got := ClipRequestKey(request); got != key {
+			t.Errorf("Expected %+v to share the key", request)
+		}
+	}
+
+	different := []jobs.JobRequest{
+		{Url: "https://youtu.be/dQw4w9WgXcQ", From: "65", To: "81", Format: "22"},
+		{Url: "https://youtu.be/dQw4w9WgXcQ", From: "65", To: "80", Format: "18"},
+		{Url: "https://youtu.be/dQw4w9WgXcQ", From: "65", To: "80", Format: "22", PreciseCut: true},
+		{Url: "https://youtu.be/dQw4w9WgXcQ", From: "65", To: "80", Format: "22", Output: &jobs.ClipOutput{Format: OutputFormatMP3}},
+		{Url: "https://youtu.be/aaaaaaaaaaa", From: "65", To: "80", Format: "22"},
+	}
+	for _, request := range different {
+		if got := ClipRequestKey(request); got == key {
+			t.Errorf("Expected %+v to have another key", request)
+		}
+	}
+}
+
+func TestClipRequestKeyNormalizesSegments(t *testing.T) {
+	segments := []jobs.ClipSegment{{From: "00:00:10", To: "00:00:25"}, {From: "00:03:40", To: "00:03:55.000"}}
+	request := jobs.JobRequest{Url: "https://youtu.be/dQw4w9WgXcQ", Segments: segments, Format: "22"}
+	key := ClipRequestKey(request)
+
+	if key != ClipRequestKey(jobs.JobRequest{Url: "https://youtu.be/dQw4w9WgXcQ", Segments: []jobs.ClipSegment{{From: "10", To: "25.0"}, {From: "220", To: "235"}}, Format: "22"}) {
+		t.Error("Expected segments to be normalized")
+	}
+	if key == ClipRequestKey(jobs.JobRequest{Url: "https://youtu.be/dQw4w9WgXcQ", Segments: []jobs.ClipSegment{segments[1], segments[0]}, Format: "22"}) {
+		t.Error("Expected the order of segments to matter")
+	}
+	if segments[0].From != "00:00:10" {
+		t.Errorf("Expected the request to stay unchanged, got %+v", segments)
+	}
+}
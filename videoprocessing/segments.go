@@ -0,0 +1,336 @@
+package videoprocessing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+// MaxSegments is the most segments a clip can be joined from.
+const MaxSegments = 20
+
+// MaxCrossfadeInSeconds is the longest crossfade between two segments.
+const MaxCrossfadeInSeconds = 5
+
+// SegmentsLengthInSeconds returns the length of the clip joined from the
+// segments: their lengths less the crossfades between them.
+func SegmentsLengthInSeconds(segments []jobs.ClipSegment, crossfadeInSeconds float64) float64 {
+	var length float64
+	for _, segment := range segments {
+		length += clipDurationInSeconds(segment.From, segment.To)
+	}
+	if len(segments) > 1 {
+		length -= crossfadeInSeconds * float64(len(segments)-1)
+	}
+	return length
+}
+
+// requestLengthInSeconds returns the length of the clip of a request, either
+// its range or its segments joined.
+func requestLengthInSeconds(request jobs.JobRequest) float64 {
+	if len(request.Segments) > 0 {
+		return SegmentsLengthInSeconds(request.Segments, request.CrossfadeInSeconds)
+	}
+	return clipDurationInSeconds(request.From, request.To)
+}
+
+// downloadClip downloads the range of the request, or cuts it from the source
+// cache, and returns the file it wrote.
+func downloadClip(ctx context.Context, jobID string, request jobs.JobRequest, plan downloadPlan, onProgress func(progress jobs.JobProgress)) (string, error) {
+	if outputPath, cached, err := cachedClip(ctx, jobID, request, plan, onProgress); cached {
+		return outputPath, err
+	}
+
+	output, err := DownloadAndCutVideo(ctx, plan.outputPath, plan.selector, config.CONFIG.YtDlpConfig.ClipSizeInMb, request.From, request.To, request.Url, plan.options, onProgress)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: Failed to download video: %s", string(output))
+		return "", classifyError(string(output), err)
+	}
+
+	// yt-dlp exits successfully when it skips a download, e.g. because of
+	// --max-filesize, so make sure the clip was actually written.
+	outputPath, err := downloadedFile(plan.outputPath)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: yt-dlp did not write the clip: %s", string(output))
+		return "", classifyError(string(output), err)
+	}
+	return outputPath, nil
+}
+
+// downloadSegments downloads the segments of the request one after another and
+// joins them in order into the file of the plan, which it returns. The
+// downloaded segments are removed afterwards.
+func downloadSegments(ctx context.Context, jobID string, request jobs.JobRequest, plan downloadPlan, onProgress func(progress jobs.JobProgress)) (string, error) {
+	options := plan.options
+	if request.CrossfadeInSeconds > 0 {
+		// Crossfades are placed by the requested segment lengths, which
+		// keyframe cuts would stretch.
+		options.PreciseCut = true
+	}
+
+	segmentPaths := make([]string, 0, len(request.Segments))
+	defer func() {
+		for _, segmentPath := range segmentPaths {
+			os.Remove(segmentPath)
+		}
+	}()
+
+	lengths := make([]float64, 0, len(request.Segments))
+	for i, segment := range request.Segments {
+		segmentPlan := plan
+		segmentPlan.outputPath = segmentFilePath(plan.outputPath, i+1)
+		segmentPlan.options = options
+		segmentRequest := request
+		segmentRequest.From, segmentRequest.To = segment.From, segment.To
+
+		segmentPath, err := downloadClip(ctx, jobID, segmentRequest, segmentPlan, segmentProgress(onProgress, i, len(request.Segments)))
+		if err != nil {
+			return "", err
+		}
+		segmentPaths = append(segmentPaths, segmentPath)
+		lengths = append(lengths, clipDurationInSeconds(segment.From, segment.To))
+
+		// yt-dlp only limits each segment, so stop once they add up to more
+		// than a single clip may be.
+		if err := checkClipSize(segmentPaths...); err != nil {
+			return "", err
+		}
+	}
+
+	outputPath := strings.Replace(plan.outputPath, "%(ext)s", strings.TrimPrefix(filepath.Ext(segmentPaths[0]), "."), 1)
+	output, err := JoinSegments(ctx, segmentPaths, outputPath, lengths, request.CrossfadeInSeconds, onProgress)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: Failed to join the segments of job %s: %s", jobID, string(output))
+		return "", joinError(string(output), err)
+	}
+	if err := checkClipSize(outputPath); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+
+	glogger.Log.Infof("Process Clip: Joined %d segments of job %s", len(segmentPaths), jobID)
+	return outputPath, nil
+}
+
+// checkClipSize reports an ErrorCodeFileTooLarge error if the files together
+// exceed YTCLIPPER_YT_DLP_CLIP_SIZE_LIMIT_IN_MB, the limit yt-dlp applies to
+// single downloads.
+func checkClipSize(paths ...string) error {
+	var size int64
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		size += stat.Size()
+	}
+
+	if size > config.CONFIG.YtDlpConfig.ClipSizeInMb {
+		return &ProcessingError{
+			Code:    ErrorCodeFileTooLarge,
+			Message: "The clip exceeds the maximum file size. Try a shorter range or a lower quality.",
+		}
+	}
+	return nil
+}
+
+// segmentFilePath returns where a segment of the download at outputPath is
+// written, e.g. videos/<jobID>.segment-2.webm.
+func segmentFilePath(outputPath string, segment int) string {
+	extension := filepath.Ext(outputPath)
+	if strings.HasSuffix(outputPath, ".%(ext)s") {
+		extension = ".%(ext)s"
+	}
+	return fmt.Sprintf("%s.segment-%d%s", strings.TrimSuffix(outputPath, extension), segment, extension)
+}
+
+// segmentProgress reports the download of one of several segments as part of
+// a single stage, e.g. the second of four segments as 25-50%.
+func segmentProgress(onProgress func(progress jobs.JobProgress), segment int, segments int) func(progress jobs.JobProgress) {
+	if onProgress == nil {
+		return nil
+	}
+
+	return func(progress jobs.JobProgress) {
+		progress.Percent = (float64(segment)*100 + progress.Percent) / float64(segments)
+		onProgress(progress)
+	}
+}
+
+// JoinSegments joins the segment files in order into outputPath and returns
+// ffmpeg's output. Without a crossfade the segments are copied with the concat
+// demuxer; crossfades re-encode them, placed by the segment lengths.
+func JoinSegments(ctx context.Context, segmentPaths []string, outputPath string, segmentLengths []float64, crossfadeInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	var length float64
+	for _, segmentLength := range segmentLengths {
+		length += segmentLength
+	}
+
+	if crossfadeInSeconds <= 0 || len(segmentPaths) < 2 {
+		return concatSegments(ctx, segmentPaths, outputPath, length, onProgress)
+	}
+	return crossfadeSegments(ctx, segmentPaths, outputPath, segmentLengths, crossfadeInSeconds, onProgress)
+}
+
+// concatSegments copies the segments into one file with the concat demuxer.
+// All segments come from the same format, so their streams match.
+func concatSegments(ctx context.Context, segmentPaths []string, outputPath string, lengthInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	// Paths in the list are relative to the list itself, which is next to
+	// the segments.
+	var list strings.Builder
+	for _, segmentPath := range segmentPaths {
+		fmt.Fprintf(&list, "file '%s'\n", filepath.Base(segmentPath))
+	}
+
+	listPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".segments.txt"
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(listPath)
+
+	cmdArgs := []string{
+		"-hide_banner", "-nostdin", "-y",
+		"-f", "concat",
+		"-i", listPath,
+		"-map", "0",
+		"-c", "copy",
+		"-progress", "pipe:1", "-nostats",
+		outputPath,
+	}
+	return executeFFmpeg(ctx, cmdArgs, progressLineHandler(lengthInSeconds, convertProgress(onProgress, 0, 1)))
+}
+
+func crossfadeSegments(ctx context.Context, segmentPaths []string, outputPath string, segmentLengths []float64, crossfadeInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	output, hasVideo, hasAudio, err := probeStreams(ctx, segmentPaths[0])
+	if err != nil {
+		return output, err
+	}
+
+	cmdArgs := []string{"-hide_banner", "-nostdin", "-y"}
+	for _, segmentPath := range segmentPaths {
+		cmdArgs = append(cmdArgs, "-i", segmentPath)
+	}
+	cmdArgs = append(cmdArgs, "-filter_complex", crossfadeFilter(segmentLengths, crossfadeInSeconds, hasVideo, hasAudio))
+	if hasVideo {
+		cmdArgs = append(cmdArgs, "-map", "[v]")
+	}
+	if hasAudio {
+		cmdArgs = append(cmdArgs, "-map", "[a]")
+	}
+	cmdArgs = append(cmdArgs, crossfadeCodecArgs(filepath.Ext(outputPath), hasVideo, hasAudio)...)
+	cmdArgs = append(cmdArgs, "-progress", "pipe:1", "-nostats", outputPath)
+
+	length := -crossfadeInSeconds * float64(len(segmentLengths)-1)
+	for _, segmentLength := range segmentLengths {
+		length += segmentLength
+	}
+	return executeFFmpeg(ctx, cmdArgs, progressLineHandler(length, convertProgress(onProgress, 0, 1)))
+}
+
+// crossfadeFilter chains an xfade and an acrossfade filter per segment after
+// the first. The output streams are labelled [v] and [a]. A crossfade starts
+// where the previous segments end, less the crossfades before it.
+func crossfadeFilter(segmentLengths []float64, crossfadeInSeconds float64, hasVideo bool, hasAudio bool) string {
+	var filters []string
+	if hasVideo {
+		for i := range segmentLengths {
+			filters = append(filters, fmt.Sprintf("[%d:v]settb=AVTB,setpts=PTS-STARTPTS[v%d]", i, i))
+		}
+		previous, offset := "v0", 0.0
+		for i := 1; i < len(segmentLengths); i++ {
+			offset += segmentLengths[i-1] - crossfadeInSeconds
+			label := fmt.Sprintf("vx%d", i)
+			if i == len(segmentLengths)-1 {
+				label = "v"
+			}
+			filters = append(filters, fmt.Sprintf("[%s][v%d]xfade=transition=fade:duration=%.3f:offset=%.3f[%s]", previous, i, crossfadeInSeconds, offset, label))
+			previous = label
+		}
+	}
+	if hasAudio {
+		for i := range segmentLengths {
+			filters = append(filters, fmt.Sprintf("[%d:a]asetpts=PTS-STARTPTS[a%d]", i, i))
+		}
+		previous := "a0"
+		for i := 1; i < len(segmentLengths); i++ {
+			label := fmt.Sprintf("ax%d", i)
+			if i == len(segmentLengths)-1 {
+				label = "a"
+			}
+			filters = append(filters, fmt.Sprintf("[%s][a%d]acrossfade=d=%.3f[%s]", previous, i, crossfadeInSeconds, label))
+			previous = label
+		}
+	}
+	return strings.Join(filters, ";")
+}
+
+// crossfadeCodecArgs re-encodes crossfaded segments into codecs the container
+// of the download supports: VP9 and Opus for WebM, H.264 and AAC otherwise.
+func crossfadeCodecArgs(extension string, hasVideo bool, hasAudio bool) []string {
+	var args []string
+	webm := extension == ".webm"
+	if hasVideo {
+		if webm {
+			args = append(args, "-c:v", "libvpx-vp9", "-crf", "32", "-b:v", "0")
+		} else {
+			args = append(args, "-c:v", "libx264", "-preset", "medium", "-crf", fmt.Sprint(defaultVideoCRF))
+		}
+	}
+	if hasAudio {
+		if webm || extension == ".opus" {
+			args = append(args, "-c:a", "libopus")
+		} else {
+			args = append(args, "-c:a", "aac")
+		}
+	}
+	return args
+}
+
+// probeStreams reports whether the file has a video and an audio stream.
+func probeStreams(ctx context.Context, path string) ([]byte, bool, bool, error) {
+	timeout := time.Duration(config.CONFIG.FFmpegConfig.CommandTimeoutInSeconds) * time.Second
+	output, err := executeWithTimeout(ctx, timeout, nil, "ffprobe", "-v", "error", "-show_entries", "stream=codec_type", "-of", "csv=p=0", path)
+	if err != nil {
+		return output, false, false, err
+	}
+
+	hasVideo, hasAudio := parseStreamTypes(string(output))
+	if !hasVideo && !hasAudio {
+		return output, false, false, fmt.Errorf("no video or audio stream in %s", path)
+	}
+	return output, hasVideo, hasAudio, nil
+}
+
+func parseStreamTypes(output string) (bool, bool) {
+	hasVideo, hasAudio := false, false
+	for _, line := range strings.Split(output, "\n") {
+		switch strings.TrimSpace(line) {
+		case "video":
+			hasVideo = true
+		case "audio":
+			hasAudio = true
+		}
+	}
+	return hasVideo, hasAudio
+}
+
+func joinError(output string, err error) *ProcessingError {
+	if errors.Is(err, ErrCommandTimeout) {
+		return classifyError(output, err)
+	}
+
+	return &ProcessingError{
+		Code:    ErrorCodeConversionFailed,
+		Message: "The segments could not be joined into one clip.",
+		Output:  output,
+		Err:     err,
+	}
+}
@@ -0,0 +1,140 @@
+package videoprocessing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+)
+
+func TestSegmentsLengthInSeconds(t *testing.T) {
+	segments := []jobs.ClipSegment{{From: "00:00:10", To: "00:00:25"}, {From: "00:03:40", To: "00:03:55"}, {From: "300", To: "310.5"}}
+
+	if got := SegmentsLengthInSeconds(segments, 0); got != 40.5 {
+		t.Errorf("Expected 40.5 seconds, got %v", got)
+	}
+	if got := SegmentsLengthInSeconds(segments, 1.5); got != 37.5 {
+		t.Errorf("Expected two crossfades to take 3 seconds, got %v", got)
+	}
+	if got := SegmentsLengthInSeconds(segments[:1], 1.5); got != 15 {
+		t.Errorf("Expected a single segment to have no crossfade, got %v", got)
+	}
+}
+
+func TestSegmentFilePath(t *testing.T) {
+	tests := []struct {
+		outputPath string
+		expected   string
+	}{
+		{"videos/job.webm", "videos/job.segment-2.webm"},
+		{"videos/job.source.mp4", "videos/job.source.segment-2.mp4"},
+		{"videos/job.%(ext)s", "videos/job.segment-2.%(ext)s"},
+	}
+
+	for _, tt := range tests {
+		if got := segmentFilePath(tt.outputPath, 2); got != tt.expected {
+			t.Errorf("segmentFilePath(%q) = %q, want %q", tt.outputPath, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckClipSize(t *testing.T) {
+	original := config.CONFIG.YtDlpConfig.ClipSizeInMb
+	config.CONFIG.YtDlpConfig.ClipSizeInMb = 10
+	t.Cleanup(func() { config.CONFIG.YtDlpConfig.ClipSizeInMb = original })
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "job.segment-1.webm"), filepath.Join(dir, "job.segment-2.webm")
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, make([]byte, 6), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := checkClipSize(first); err != nil {
+		t.Errorf("Expected a segment within the limit to pass, got %v", err)
+	}
+	var processingErr *ProcessingError
+	if err := checkClipSize(first, second); !errors.As(err, &processingErr) || processingErr.Code != ErrorCodeFileTooLarge {
+		t.Errorf("Expected segments adding up to more than the limit to fail with %s, got %v", ErrorCodeFileTooLarge, err)
+	}
+}
+
+func TestJoinSegmentsWithConcatDemuxer(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	dir := t.TempDir()
+	var capturedArgs []string
+	var list string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		if listPath, ok := flagValue(capturedArgs, "-i"); ok {
+			data, _ := os.ReadFile(listPath)
+			list = string(data)
+		}
+		return exec.Command("echo", "mock")
+	}
+
+	segmentPaths := []string{filepath.Join(dir, "job.segment-1.webm"), filepath.Join(dir, "job.segment-2.webm")}
+	outputPath := filepath.Join(dir, "job.webm")
+	if _, err := JoinSegments(context.Background(), segmentPaths, outputPath, []float64{15, 15}, 0, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if v, ok := flagValue(capturedArgs, "-f"); !ok || v != "concat" {
+		t.Errorf("Expected -f concat, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(capturedArgs, "-c"); !ok || v != "copy" {
+		t.Errorf("Expected -c copy, got %q (present=%v)", v, ok)
+	}
+	if list != "file 'job.segment-1.webm'\nfile 'job.segment-2.webm'\n" {
+		t.Errorf("Unexpected concat list %q", list)
+	}
+	if capturedArgs[len(capturedArgs)-1] != outputPath {
+		t.Errorf("Expected output path last, got %v", capturedArgs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "job.segments.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the concat list to be removed")
+	}
+}
+
+func TestCrossfadeFilter(t *testing.T) {
+	expected := "[0:v]settb=AVTB,setpts=PTS-STARTPTS[v0];[1:v]settb=AVTB,setpts=PTS-STARTPTS[v1];[2:v]settb=AVTB,setpts=PTS-STARTPTS[v2];" +
+		"[v0][v1]xfade=transition=fade:duration=1.000:offset=14.000[vx1];[vx1][v2]xfade=transition=fade:duration=1.000:offset=23.000[v];" +
+		"[0:a]asetpts=PTS-STARTPTS[a0];[1:a]asetpts=PTS-STARTPTS[a1];[2:a]asetpts=PTS-STARTPTS[a2];" +
+		"[a0][a1]acrossfade=d=1.000[ax1];[ax1][a2]acrossfade=d=1.000[a]"
+	if got := crossfadeFilter([]float64{15, 10, 5}, 1, true, true); got != expected {
+		t.Errorf("Unexpected filter:\n got  %s\n want %s", got, expected)
+	}
+
+	audioOnly := "[0:a]asetpts=PTS-STARTPTS[a0];[1:a]asetpts=PTS-STARTPTS[a1];[a0][a1]acrossfade=d=0.500[a]"
+	if got := crossfadeFilter([]float64{15, 10}, 0.5, false, true); got != audioOnly {
+		t.Errorf("Unexpected audio filter:\n got  %s\n want %s", got, audioOnly)
+	}
+}
+
+func TestCrossfadeCodecArgs(t *testing.T) {
+	if v, ok := flagValue(crossfadeCodecArgs(".webm", true, true), "-c:v"); !ok || v != "libvpx-vp9" {
+		t.Errorf("Expected VP9 for WebM, got %q", v)
+	}
+	if v, ok := flagValue(crossfadeCodecArgs(".mp4", true, true), "-c:a"); !ok || v != "aac" {
+		t.Errorf("Expected AAC for MP4, got %q", v)
+	}
+	if args := crossfadeCodecArgs(".m4a", false, true); hasFlag(args, "-c:v") {
+		t.Errorf("Expected no video codec for audio, got %v", args)
+	}
+}
+
+func TestParseStreamTypes(t *testing.T) {
+	if hasVideo, hasAudio := parseStreamTypes("video\naudio\n"); !hasVideo || !hasAudio {
+		t.Errorf("Expected video and audio, got %v and %v", hasVideo, hasAudio)
+	}
+	if hasVideo, hasAudio := parseStreamTypes("audio\n"); hasVideo || !hasAudio {
+		t.Errorf("Expected audio only, got %v and %v", hasVideo, hasAudio)
+	}
+}
@@ -0,0 +1,348 @@
+package videoprocessing
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+	"ytclipper-go/utils"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+	"golang.org/x/sync/singleflight"
+)
+
+// sourceCache keeps whole videos, per video ID and format, in
+// YTCLIPPER_SOURCE_CACHE_PATH, so clips of the same video are cut locally with
+// ffmpeg instead of each downloading its range from YouTube. Concurrent misses
+// for the same source share one download. Sources in use are never evicted.
+type sourceCache struct {
+	lock        sync.Mutex
+	inUse       map[string]int
+	downloading map[string]bool
+	group       singleflight.Group
+	hits        atomic.Int64
+	misses      atomic.Int64
+	download    func(ctx context.Context, outputPath string, selector string, mergeOutputFormat string, url string, durationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error)
+}
+
+var sources = newSourceCache(downloadSource)
+
+func newSourceCache(download func(ctx context.Context, outputPath string, selector string, mergeOutputFormat string, url string, durationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error)) *sourceCache {
+	return &sourceCache{
+		inUse:       make(map[string]int),
+		downloading: make(map[string]bool),
+		download:    download,
+	}
+}
+
+// sourceCacheKey names the cached source of a video in a format, e.g.
+// "dQw4w9WgXcQ-1a2b3c4d5e6f". Format selectors contain characters that do not
+// belong in file names, so they are hashed together with the container.
+func sourceCacheKey(videoID string, selector string, mergeOutputFormat string) string {
+	sum := sha256.Sum256([]byte(selector + "\x00" + mergeOutputFormat))
+	return fmt.Sprintf("%s-%x", strings.ReplaceAll(sanitizeFileName(videoID), ".", "_"), sum[:6])
+}
+
+// acquire returns the cached source of the video in the format, downloading
+// the whole video on a miss. Only the first of concurrent callers reports the
+// progress of the download. The download is detached from the callers, so a
+// cancelled job does not fail it for the others; it is bounded by
+// YTCLIPPER_SOURCE_CACHE_DOWNLOAD_TIMEOUT_IN_SECONDS instead. The source is
+// kept until release is called.
+func (c *sourceCache) acquire(ctx context.Context, url string, info *VideoInfo, selector string, mergeOutputFormat string, onProgress func(progress jobs.JobProgress)) (string, func(), error) {
+	dir := config.CONFIG.SourceCacheConfig.Path
+	key := sourceCacheKey(info.ID, selector, mergeOutputFormat)
+
+	if path, ok := c.lookup(dir, key); ok {
+		hits := c.hits.Add(1)
+		glogger.Log.Infof("Source Cache: Hit for %s (hits: %d, misses: %d)", key, hits, c.misses.Load())
+		return path, c.releaser(key), nil
+	}
+
+	downloaded := false
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		c.lock.Lock()
+		c.downloading[key] = true
+		c.lock.Unlock()
+
+		misses := c.misses.Add(1)
+		glogger.Log.Infof("Source Cache: Miss for %s (hits: %d, misses: %d)", key, c.hits.Load(), misses)
+
+		timeout := time.Duration(config.CONFIG.SourceCacheConfig.DownloadTimeoutInSeconds) * time.Second
+		downloadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		path, err := c.fetch(downloadCtx, dir, key, url, info, selector, mergeOutputFormat, onProgress)
+
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if err == nil {
+			// Mark the source as in use before it stops being downloaded, so
+			// eviction cannot remove it before this caller cuts it.
+			c.inUse[key]++
+			downloaded = true
+		}
+		delete(c.downloading, key)
+		return path, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	path := result.(string)
+	if !downloaded {
+		// Callers that waited for the download of another caller use the
+		// source only if it was not evicted in the meantime.
+		if path, ok := c.lookup(dir, key); ok {
+			return path, c.releaser(key), nil
+		}
+		return "", nil, fmt.Errorf("%s: evicted before use: %w", path, os.ErrNotExist)
+	}
+	touchFile(path)
+
+	return path, c.releaser(key), nil
+}
+
+// fetch downloads the whole video into the cache and returns its source.
+func (c *sourceCache) fetch(ctx context.Context, dir string, key string, url string, info *VideoInfo, selector string, mergeOutputFormat string, onProgress func(progress jobs.JobProgress)) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	output, err := c.download(ctx, filepath.Join(dir, key+".%(ext)s"), selector, mergeOutputFormat, url, info.Duration, onProgress)
+	if err != nil {
+		return "", classifyError(string(output), err)
+	}
+
+	// yt-dlp skips sources larger than the cache without failing.
+	path, err := sourceFile(dir, key)
+	if err != nil {
+		return "", classifyError(string(output), err)
+	}
+	return path, nil
+}
+
+// lookup returns the source of the key and marks it as in use, if it exists.
+func (c *sourceCache) lookup(dir string, key string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	path, err := sourceFile(dir, key)
+	if err != nil {
+		return "", false
+	}
+	c.inUse[key]++
+	touchFile(path)
+	return path, true
+}
+
+func (c *sourceCache) releaser(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+
+			if c.inUse[key]--; c.inUse[key] <= 0 {
+				delete(c.inUse, key)
+			}
+		})
+	}
+}
+
+type cachedSourceFile struct {
+	path   string
+	size   int64
+	usedAt time.Time
+}
+
+// evict removes the files of sources nobody used within the retention, then
+// the least recently used sources until the cache fits maxSizeInBytes. Files
+// of sources in use or being downloaded are kept.
+func (c *sourceCache) evict(dir string, maxSizeInBytes int64, retention time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glogger.Log.Errorf(err, "Source Cache: Could not read %s", dir)
+		}
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	var total int64
+	var files []cachedSourceFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		key, _, _ := strings.Cut(entry.Name(), ".")
+		path := filepath.Join(dir, entry.Name())
+		if c.inUse[key] > 0 || c.downloading[key] {
+			total += info.Size()
+			continue
+		}
+		if now.Sub(info.ModTime()) > retention {
+			removeSourceFile(path, "unused")
+			continue
+		}
+
+		total += info.Size()
+		files = append(files, cachedSourceFile{path: path, size: info.Size(), usedAt: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].usedAt.Before(files[j].usedAt) })
+	for _, file := range files {
+		if total <= maxSizeInBytes {
+			break
+		}
+		removeSourceFile(file.path, "over the size limit")
+		total -= file.size
+	}
+}
+
+func removeSourceFile(path string, reason string) {
+	if err := os.Remove(path); err != nil {
+		glogger.Log.Errorf(err, "Source Cache: Could not evict %s", path)
+		return
+	}
+	glogger.Log.Infof("Source Cache: Evicted %s (%s)", path, reason)
+}
+
+// EvictSourceCache applies the retention and size limit of the source cache.
+// The cleanup scheduler calls it periodically.
+func EvictSourceCache() {
+	cacheConfig := config.CONFIG.SourceCacheConfig
+	if !cacheConfig.IsEnabled {
+		return
+	}
+
+	retention := time.Duration(cacheConfig.RetentionInMinutes) * time.Minute
+	sources.evict(cacheConfig.Path, utils.MbToBytes(cacheConfig.MaxSizeInMb), retention)
+}
+
+// sourceFile returns the finished source of the key, skipping partial and
+// intermediate files such as <key>.mp4.part or <key>.f137.mp4.
+func sourceFile(dir string, key string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, key+".*"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if extension := strings.TrimPrefix(filepath.Base(file), key+"."); !strings.Contains(extension, ".") {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", filepath.Join(dir, key), os.ErrNotExist)
+}
+
+// touchFile records the use of a cached source in its modification time, which
+// eviction goes by.
+func touchFile(path string) {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		glogger.Log.Errorf(err, "Source Cache: Could not touch %s", path)
+	}
+}
+
+// downloadSource downloads the whole video into outputPath, within the size
+// limit of the cache and YTCLIPPER_SOURCE_CACHE_DOWNLOAD_TIMEOUT_IN_SECONDS.
+func downloadSource(ctx context.Context, outputPath string, selector string, mergeOutputFormat string, url string, durationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	cmdArgs := []string{
+		"-o", outputPath,
+		"-f", selector,
+		"-v",
+		"--no-mtime",
+		"--max-filesize", fmt.Sprintf("%d", utils.MbToBytes(config.CONFIG.SourceCacheConfig.MaxSizeInMb)),
+	}
+	if mergeOutputFormat != "" {
+		cmdArgs = append(cmdArgs, "--merge-output-format", mergeOutputFormat)
+	}
+	cmdArgs = append(cmdArgs,
+		"--newline",
+		"--progress-template", ytDlpProgressTemplate,
+		url,
+	)
+
+	timeout := time.Duration(config.CONFIG.SourceCacheConfig.DownloadTimeoutInSeconds) * time.Second
+	return executeWithTimeout(ctx, timeout, progressLineHandler(durationInSeconds, onProgress), "yt-dlp", append(commonArgs(), cmdArgs...)...)
+}
+
+// CutSource cuts the range from-to of a local source into outputPath and
+// returns ffmpeg's output. Like a download with --download-sections, the clip
+// is copied from the preceding keyframe, or re-encoded with ffmpeg's default
+// codecs for the container when preciseCut is set.
+func CutSource(ctx context.Context, sourcePath string, outputPath string, from string, to string, preciseCut bool, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+	fromInSeconds, err := utils.ToSeconds(from)
+	if err != nil {
+		return nil, err
+	}
+	duration := clipDurationInSeconds(from, to)
+
+	cmdArgs := []string{
+		"-hide_banner", "-nostdin", "-y",
+		"-ss", fmt.Sprintf("%.3f", fromInSeconds),
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-i", sourcePath,
+	}
+	if !preciseCut {
+		cmdArgs = append(cmdArgs, "-map", "0", "-c", "copy", "-avoid_negative_ts", "make_zero")
+	}
+	cmdArgs = append(cmdArgs, "-progress", "pipe:1", "-nostats", outputPath)
+
+	return executeFFmpeg(ctx, cmdArgs, progressLineHandler(duration, onProgress))
+}
+
+// cachedClip cuts the clip of the request from the cached source of its
+// video. It reports false if the cache is disabled or cannot serve the video,
+// e.g. a live stream or a video longer than
+// YTCLIPPER_SOURCE_CACHE_MAX_VIDEO_DURATION_IN_SECONDS, and the clip is
+// downloaded on its own instead.
+func cachedClip(ctx context.Context, jobID string, request jobs.JobRequest, plan downloadPlan, onProgress func(progress jobs.JobProgress)) (string, bool, error) {
+	cacheConfig := config.CONFIG.SourceCacheConfig
+	if !cacheConfig.IsEnabled {
+		return "", false, nil
+	}
+
+	info, err := GetVideoInfo(ctx, request.Url)
+	if err != nil || info.ID == "" || info.IsLive || info.Duration <= 0 || info.Duration > float64(cacheConfig.MaxVideoDurationInSeconds) {
+		return "", false, nil
+	}
+
+	sourcePath, release, err := sources.acquire(ctx, request.Url, info, plan.selector, plan.options.MergeOutputFormat, onProgress)
+	if err != nil {
+		if ctx.Err() == nil {
+			glogger.Log.Errorf(err, "Source Cache: Could not cache %s for job %s, downloading the clip instead", info.ID, jobID)
+		}
+		return "", false, nil
+	}
+	defer release()
+
+	outputPath := strings.Replace(plan.outputPath, "%(ext)s", strings.TrimPrefix(filepath.Ext(sourcePath), "."), 1)
+	output, err := CutSource(ctx, sourcePath, outputPath, request.From, request.To, plan.options.PreciseCut, onProgress)
+	if err != nil {
+		if ctx.Err() == nil {
+			glogger.Log.Errorf(err, "Source Cache: Could not cut %s for job %s, downloading the clip instead: %s", sourcePath, jobID, string(output))
+		}
+		os.Remove(outputPath)
+		return "", false, nil
+	}
+
+	if err := checkClipSize(outputPath); err != nil {
+		os.Remove(outputPath)
+		return "", true, err
+	}
+
+	glogger.Log.Infof("Process Clip: Cut job %s from cached source %s", jobID, sourcePath)
+	return outputPath, true, nil
+}
@@ -0,0 +1,185 @@
+package videoprocessing
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"ytclipper-go/config"
+	"ytclipper-go/jobs"
+)
+
+func withSourceCacheDir(t *testing.T) string {
+	t.Helper()
+	originalConfig := config.CONFIG.SourceCacheConfig
+	t.Cleanup(func() { config.CONFIG.SourceCacheConfig = originalConfig })
+
+	dir := t.TempDir()
+	config.CONFIG.SourceCacheConfig = config.SourceCacheConfig{IsEnabled: true, Path: dir, MaxSizeInMb: 100, MaxVideoDurationInSeconds: 3600, RetentionInMinutes: 60}
+	return dir
+}
+
+func TestSourceCacheKey(t *testing.T) {
+	key := sourceCacheKey("dQw4w9WgXcQ", "bv*[height<=720]+ba/b", "mp4")
+	if key != sourceCacheKey("dQw4w9WgXcQ", "bv*[height<=720]+ba/b", "mp4") {
+		t.Error("Expected the key to be stable")
+	}
+	if !strings.HasPrefix(key, "dQw4w9WgXcQ-") || strings.ContainsAny(key, "*[]<=+/.") {
+		t.Errorf("Expected a file name safe key, got %q", key)
+	}
+	if key == sourceCacheKey("dQw4w9WgXcQ", "bv*[height<=720]+ba/b", "mkv") || key == sourceCacheKey("dQw4w9WgXcQ", "22", "") {
+		t.Error("Expected the format to be part of the key")
+	}
+}
+
+func TestSourceFileSkipsPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"key.mp4.part", "key.f137.mp4"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("partial"), 0644)
+	}
+	if _, err := sourceFile(dir, "key"); err == nil {
+		t.Fatal("Expected partial files to be skipped")
+	}
+
+	os.WriteFile(filepath.Join(dir, "key.mp4"), []byte("source"), 0644)
+	if path, err := sourceFile(dir, "key"); err != nil || path != filepath.Join(dir, "key.mp4") {
+		t.Errorf("Expected the finished source, got %q (%v)", path, err)
+	}
+}
+
+func TestSourceCacheDownloadsOnce(t *testing.T) {
+	withSourceCacheDir(t)
+
+	var lock sync.Mutex
+	downloads := 0
+	cache := newSourceCache(func(ctx context.Context, outputPath string, selector string, mergeOutputFormat string, url string, durationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+		lock.Lock()
+		downloads++
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		return nil, os.WriteFile(strings.Replace(outputPath, "%(ext)s", "webm", 1), []byte("source"), 0644)
+	})
+
+	info := &VideoInfo{ID: "cached00001", Duration: 600}
+	var wg sync.WaitGroup
+	paths := make([]string, 3)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, release, err := cache.acquire(context.Background(), "https://www.youtube.com/watch?v=cached00001", info, "251", "", nil)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+				return
+			}
+			defer release()
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+
+	path, release, err := cache.acquire(context.Background(), "https://www.youtube.com/watch?v=cached00001", info, "251", "", nil)
+	if err != nil {
+		t.Fatalf("Expected a hit, got %v", err)
+	}
+	release()
+
+	if downloads != 1 {
+		t.Errorf("Expected one download, got %d", downloads)
+	}
+	for _, p := range paths {
+		if p != path || filepath.Ext(p) != ".webm" {
+			t.Errorf("Expected every caller to get %s, got %s", path, p)
+		}
+	}
+	if len(cache.inUse) != 0 {
+		t.Errorf("Expected all sources to be released, got %v", cache.inUse)
+	}
+}
+
+func TestSourceCacheDownloadOutlivesCaller(t *testing.T) {
+	withSourceCacheDir(t)
+
+	cache := newSourceCache(func(ctx context.Context, outputPath string, selector string, mergeOutputFormat string, url string, durationInSeconds float64, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			t.Error("Expected the download to be bounded by the cache timeout")
+		}
+		return nil, os.WriteFile(strings.Replace(outputPath, "%(ext)s", "webm", 1), []byte("source"), 0644)
+	})
+	config.CONFIG.SourceCacheConfig.DownloadTimeoutInSeconds = 60
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	info := &VideoInfo{ID: "cached00002", Duration: 600}
+	_, release, err := cache.acquire(ctx, "https://www.youtube.com/watch?v=cached00002", info, "251", "", nil)
+	if err != nil {
+		t.Fatalf("Expected the download to ignore the cancelled caller, got %v", err)
+	}
+	if cache.inUse[sourceCacheKey(info.ID, "251", "")] != 1 || len(cache.downloading) != 0 {
+		t.Errorf("Expected the source to be in use and no longer downloading, got %v and %v", cache.inUse, cache.downloading)
+	}
+	release()
+}
+
+func TestSourceCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(name string, size int, usedAt time.Time) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, make([]byte, size), 0644)
+		os.Chtimes(path, usedAt, usedAt)
+		return path
+	}
+
+	unused := write("unused.mp4", 10, old)
+	inUse := write("inuse.mp4", 10, old)
+	oldest := write("oldest.mp4", 40, time.Now().Add(-30*time.Minute))
+	newest := write("newest.mp4", 40, time.Now())
+
+	cache := newSourceCache(nil)
+	cache.inUse["inuse"] = 1
+	cache.evict(dir, 60, time.Hour)
+
+	for path, kept := range map[string]bool{unused: false, inUse: true, oldest: false, newest: true} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("Expected %s to be kept: %v", filepath.Base(path), kept)
+		}
+	}
+}
+
+func TestCutSource(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("echo", "mock")
+	}
+
+	_, _ = CutSource(context.Background(), "cache/source.webm", "videos/job.webm", "00:01:10", "00:01:25.5", false, nil)
+	if v, ok := flagValue(capturedArgs, "-ss"); !ok || v != "70.000" {
+		t.Errorf("Expected -ss 70.000, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(capturedArgs, "-t"); !ok || v != "15.500" {
+		t.Errorf("Expected -t 15.500, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(capturedArgs, "-c"); !ok || v != "copy" {
+		t.Errorf("Expected a stream copy, got %q (present=%v)", v, ok)
+	}
+
+	_, _ = CutSource(context.Background(), "cache/source.webm", "videos/job.webm", "00:01:10", "00:01:25.5", true, nil)
+	if hasFlag(capturedArgs, "-c") {
+		t.Errorf("Expected a precise cut to re-encode, got %v", capturedArgs)
+	}
+	if capturedArgs[len(capturedArgs)-1] != "videos/job.webm" {
+		t.Errorf("Expected output path last, got %v", capturedArgs)
+	}
+}
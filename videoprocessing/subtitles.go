@@ -0,0 +1,399 @@
+package videoprocessing
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"ytclipper-go/jobs"
+	"ytclipper-go/utils"
+
+	"github.com/MorrisMorrison/gutils/glogger"
+)
+
+// Subtitle modes. Sidecar delivers the clip and a subtitle file in a zip, soft
+// muxes the subtitles into the clip as a track players can toggle, and burn
+// renders them into the video.
+const (
+	SubtitleModeSidecar = "sidecar"
+	SubtitleModeSoft    = "soft"
+	SubtitleModeBurn    = "burn"
+)
+
+const (
+	SubtitleFormatSRT = "srt"
+	SubtitleFormatVTT = "vtt"
+)
+
+// subtitleCodecs are the subtitle codecs soft subtitles are muxed with, by
+// container.
+var subtitleCodecs = map[string]string{
+	".mp4":  "mov_text",
+	".m4a":  "mov_text",
+	".mov":  "mov_text",
+	".mkv":  "srt",
+	".webm": "webvtt",
+}
+
+var cueTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// subtitleCue is a single cue; times are in seconds.
+type subtitleCue struct {
+	start float64
+	end   float64
+	text  string
+}
+
+// ValidateClipSubtitles checks the subtitle options against the output of the
+// clip, which is nil when the downloaded format is kept.
+func ValidateClipSubtitles(subtitles jobs.ClipSubtitles, output *jobs.ClipOutput) error {
+	if subtitles.Language == "" {
+		return fmt.Errorf("Missing subtitle language.")
+	}
+
+	switch subtitles.Mode {
+	case SubtitleModeSidecar:
+		if subtitles.Format != "" && subtitles.Format != SubtitleFormatSRT && subtitles.Format != SubtitleFormatVTT {
+			return fmt.Errorf("Invalid subtitle format. Use %s or %s.", SubtitleFormatSRT, SubtitleFormatVTT)
+		}
+		return nil
+	case SubtitleModeSoft, SubtitleModeBurn:
+		if subtitles.Format != "" {
+			return fmt.Errorf("The subtitle format only applies to %s subtitles.", SubtitleModeSidecar)
+		}
+	default:
+		return fmt.Errorf("Invalid subtitle mode. Use %s, %s or %s.", SubtitleModeSidecar, SubtitleModeSoft, SubtitleModeBurn)
+	}
+
+	if output != nil && (IsAudioOutput(output.Format) || IsAnimationOutput(output.Format)) {
+		return fmt.Errorf("%s outputs only support %s subtitles.", strings.ToUpper(output.Format), SubtitleModeSidecar)
+	}
+	return nil
+}
+
+// CheckSubtitlesAvailable reports a subtitles_unavailable error if the video
+// has no subtitles of the requested kind in the requested language.
+func CheckSubtitlesAvailable(ctx context.Context, url string, subtitles jobs.ClipSubtitles) error {
+	info, err := GetVideoInfo(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	tracks, kind := info.Subtitles, "subtitles"
+	if subtitles.Automatic {
+		tracks, kind = info.AutomaticCaptions, "auto-generated captions"
+	}
+	if _, exists := tracks[subtitles.Language]; !exists || subtitles.Language == "live_chat" {
+		return &ProcessingError{
+			Code:    ErrorCodeSubtitlesUnavailable,
+			Message: fmt.Sprintf("This video has no %s in %q.", kind, subtitles.Language),
+		}
+	}
+	return nil
+}
+
+// clipSubtitles fetches the subtitles of the job's video and writes the cues
+// of the clipped range, shifted to start at the clip, next to the clip. Soft
+// and burned subtitles are written as SRT, which ffmpeg reads best.
+func clipSubtitles(ctx context.Context, jobID string, request jobs.JobRequest) (string, error) {
+	sourcePath, err := fetchSubtitles(ctx, jobID, request.Url, *request.Subtitles)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(sourcePath)
+
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	cues := parseSubtitles(string(data))
+	if request.Subtitles.Automatic {
+		cues = dedupeRollingCues(cues)
+	}
+
+	cues, err = clipRequestCues(cues, request)
+	if err != nil {
+		return "", err
+	}
+
+	format := request.Subtitles.Format
+	if format == "" || request.Subtitles.Mode != SubtitleModeSidecar {
+		format = SubtitleFormatSRT
+	}
+
+	outputPath := filepath.Join(videoOutputDir, fmt.Sprintf("%s.subtitles.%s", filepath.Base(jobID), format))
+	if err := os.WriteFile(outputPath, []byte(formatSubtitles(cues, format)), 0644); err != nil {
+		return "", err
+	}
+
+	glogger.Log.Infof("Process Clip: Wrote %d subtitle cues for job %s", len(cues), jobID)
+	return outputPath, nil
+}
+
+// fetchSubtitles downloads the subtitle track with yt-dlp, preferring VTT,
+// and returns the path of the file it wrote.
+func fetchSubtitles(ctx context.Context, jobID string, url string, subtitles jobs.ClipSubtitles) (string, error) {
+	writeFlag := "--write-subs"
+	if subtitles.Automatic {
+		writeFlag = "--write-auto-subs"
+	}
+
+	outputTemplate := filepath.Join(videoOutputDir, filepath.Base(jobID)+".source-subtitles.%(ext)s")
+	cmdArgs := []string{
+		"--skip-download",
+		writeFlag,
+		"--sub-langs", subtitles.Language,
+		"--sub-format", "vtt/srt/best",
+		"-o", outputTemplate,
+		url,
+	}
+
+	output, err := execute(ctx, "yt-dlp", cmdArgs)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: Failed to fetch subtitles of job %s: %s", jobID, string(output))
+		return "", classifyError(string(output), err)
+	}
+
+	for _, ext := range []string{SubtitleFormatVTT, SubtitleFormatSRT} {
+		files, _ := filepath.Glob(strings.TrimSuffix(outputTemplate, "%(ext)s") + "*." + ext)
+		if len(files) > 0 {
+			return files[0], nil
+		}
+	}
+
+	glogger.Log.Infof("Process Clip: yt-dlp wrote no %s subtitles for job %s: %s", subtitles.Language, jobID, string(output))
+	removeFiles(strings.TrimSuffix(outputTemplate, "%(ext)s") + "*")
+	return "", &ProcessingError{
+		Code:    ErrorCodeSubtitlesUnavailable,
+		Message: fmt.Sprintf("The %s subtitles of this video could not be downloaded.", subtitles.Language),
+	}
+}
+
+// parseSubtitles reads the cues of a WebVTT or SRT file. Cue settings, inline
+// tags such as YouTube's word timings and blocks without timing (the WEBVTT
+// header, NOTE and STYLE blocks) are dropped.
+func parseSubtitles(data string) []subtitleCue {
+	data = strings.ReplaceAll(strings.TrimPrefix(data, "\ufeff"), "\r\n", "\n")
+
+	var cues []subtitleCue
+	for _, block := range strings.Split(data, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			start, end, ok := parseCueTiming(line)
+			if !ok {
+				continue
+			}
+
+			var text []string
+			for _, textLine := range lines[i+1:] {
+				if textLine = strings.TrimSpace(html.UnescapeString(cueTagPattern.ReplaceAllString(textLine, ""))); textLine != "" {
+					text = append(text, textLine)
+				}
+			}
+			if len(text) > 0 {
+				cues = append(cues, subtitleCue{start: start, end: end, text: strings.Join(text, "\n")})
+			}
+			break
+		}
+	}
+	return cues
+}
+
+// parseCueTiming parses "00:01:02.500 --> 00:01:04.000 align:start", and the
+// SRT form with a decimal comma.
+func parseCueTiming(line string) (float64, float64, bool) {
+	startValue, rest, found := strings.Cut(line, "-->")
+	if !found {
+		return 0, 0, false
+	}
+	endFields := strings.Fields(rest)
+	if len(endFields) == 0 {
+		return 0, 0, false
+	}
+
+	start, startErr := utils.ToSeconds(strings.ReplaceAll(strings.TrimSpace(startValue), ",", "."))
+	end, endErr := utils.ToSeconds(strings.ReplaceAll(endFields[0], ",", "."))
+	if startErr != nil || endErr != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// dedupeRollingCues flattens YouTube's auto-generated captions, which scroll:
+// every cue repeats the line of the previous one before adding its own, and
+// short transition cues repeat it alone. Lines already shown by the previous
+// cue are dropped, and cues left empty are skipped.
+func dedupeRollingCues(cues []subtitleCue) []subtitleCue {
+	var result []subtitleCue
+	var previous []string
+	for _, cue := range cues {
+		lines := strings.Split(cue.text, "\n")
+		var fresh []string
+		for _, line := range lines {
+			if !containsLine(previous, line) {
+				fresh = append(fresh, line)
+			}
+		}
+		previous = lines
+
+		if len(fresh) > 0 {
+			cue.text = strings.Join(fresh, "\n")
+			result = append(result, cue)
+		}
+	}
+	return result
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+// clipCues keeps the cues shown between from and to and shifts them so the
+// clip starts at zero. Cues that overlap a boundary are cut at it.
+func clipCues(cues []subtitleCue, from float64, to float64) []subtitleCue {
+	var result []subtitleCue
+	for _, cue := range cues {
+		if cue.end <= from || cue.start >= to {
+			continue
+		}
+		result = append(result, subtitleCue{
+			start: math.Max(cue.start, from) - from,
+			end:   math.Min(cue.end, to) - from,
+			text:  cue.text,
+		})
+	}
+	return result
+}
+
+// clipRequestCues clips the cues to the range of the request. The cues of a
+// segment are shifted to where the segment starts in the joined clip.
+func clipRequestCues(cues []subtitleCue, request jobs.JobRequest) ([]subtitleCue, error) {
+	segments := request.Segments
+	if len(segments) == 0 {
+		segments = []jobs.ClipSegment{{From: request.From, To: request.To}}
+	}
+
+	var result []subtitleCue
+	var start float64
+	for _, segment := range segments {
+		from, err := utils.ToSeconds(segment.From)
+		if err != nil {
+			return nil, err
+		}
+		length := clipDurationInSeconds(segment.From, segment.To)
+		for _, cue := range clipCues(cues, from, from+length) {
+			cue.start += start
+			cue.end += start
+			result = append(result, cue)
+		}
+		start += length - request.CrossfadeInSeconds
+	}
+	return result, nil
+}
+
+func formatSubtitles(cues []subtitleCue, format string) string {
+	var builder strings.Builder
+	if format == SubtitleFormatVTT {
+		builder.WriteString("WEBVTT\n\n")
+	}
+
+	for i, cue := range cues {
+		if format == SubtitleFormatVTT {
+			fmt.Fprintf(&builder, "%s --> %s\n%s\n\n", formatCueTime(cue.start, "."), formatCueTime(cue.end, "."), escapeVTT(cue.text))
+			continue
+		}
+		fmt.Fprintf(&builder, "%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(cue.start, ","), formatCueTime(cue.end, ","), cue.text)
+	}
+	return builder.String()
+}
+
+// formatCueTime formats seconds as HH:MM:SS followed by the separator and
+// milliseconds, e.g. 00:01:02,500 for SRT.
+func formatCueTime(seconds float64, separator string) string {
+	milliseconds := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", milliseconds/3600000, milliseconds/60000%60, milliseconds/1000%60, separator, milliseconds%1000)
+}
+
+func escapeVTT(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// muxSubtitles adds the subtitles to the clip as a soft subtitle track without
+// re-encoding it. The muxed clip replaces the original one.
+func muxSubtitles(ctx context.Context, clipPath string, subtitlesPath string, language string) error {
+	ext := filepath.Ext(clipPath)
+	codec, supported := subtitleCodecs[ext]
+	if !supported {
+		return &ProcessingError{
+			Code:    ErrorCodeFormatUnavailable,
+			Message: fmt.Sprintf("Subtitles cannot be added to %s files. Please choose another format or sidecar subtitles.", strings.TrimPrefix(ext, ".")),
+		}
+	}
+
+	muxedPath := strings.TrimSuffix(clipPath, ext) + ".muxed" + ext
+	cmdArgs := []string{
+		"-hide_banner", "-nostdin", "-y",
+		"-i", clipPath,
+		"-i", subtitlesPath,
+		"-map", "0",
+		"-map", "1:0",
+		"-c", "copy",
+		"-c:s", codec,
+		"-metadata:s:s:0", "language=" + language,
+		muxedPath,
+	}
+	if output, err := executeFFmpeg(ctx, cmdArgs, nil); err != nil {
+		os.Remove(muxedPath)
+		return conversionError(string(output), err)
+	}
+
+	return os.Rename(muxedPath, clipPath)
+}
+
+// bundleSidecar zips the clip with its subtitle file, named after the video
+// so players pick the subtitles up, e.g. "Title.mp4" and "Title.en.srt".
+func bundleSidecar(ctx context.Context, jobID string, request jobs.JobRequest, clipPath string, subtitlesPath string) (string, error) {
+	name := sanitizeFileName(clipTags(ctx, request).Title)
+	if name == "" {
+		name = "clip"
+	}
+
+	outputPath := filepath.Join(videoOutputDir, filepath.Base(jobID)+".zip")
+	entries := []bundleEntry{
+		{name: name + filepath.Ext(clipPath), path: clipPath},
+		{name: fmt.Sprintf("%s.%s%s", name, request.Subtitles.Language, filepath.Ext(subtitlesPath)), path: subtitlesPath},
+	}
+	if err := writeZip(outputPath, entries); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+
+	os.Remove(clipPath)
+	return outputPath, nil
+}
+
+// subtitlesFilter burns the subtitles into the video. Job file paths contain
+// nothing that needs escaping in a filtergraph.
+func subtitlesFilter(subtitlesPath string) string {
+	return "subtitles=" + filepath.ToSlash(subtitlesPath)
+}
+
+func removeFiles(pattern string) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		os.Remove(file)
+	}
+}
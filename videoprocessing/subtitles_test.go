@@ -0,0 +1,234 @@
+package videoprocessing
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"ytclipper-go/jobs"
+)
+
+const youtubeAutoCaptions = `WEBVTT
+Kind: captions
+Language: en
+
+00:00:09.000 --> 00:00:11.990 align:start position:0%
+ 
+we&#39;re<00:00:09.480><c> no</c><00:00:09.800><c> strangers</c>
+
+00:00:11.990 --> 00:00:12.000 align:start position:0%
+we're no strangers
+ 
+
+00:00:12.000 --> 00:00:15.500 align:start position:0%
+we're no strangers
+to<00:00:12.400><c> love</c>
+`
+
+func TestParseSubtitlesVTT(t *testing.T) {
+	cues := parseSubtitles(youtubeAutoCaptions)
+
+	if len(cues) != 3 {
+		t.Fatalf("Expected 3 cues, got %+v", cues)
+	}
+	if cues[0].start != 9 || cues[0].end != 11.99 || cues[0].text != "we're no strangers" {
+		t.Errorf("Expected tags and settings to be stripped, got %+v", cues[0])
+	}
+	if cues[2].text != "we're no strangers\nto love" {
+		t.Errorf("Expected both lines of the last cue, got %q", cues[2].text)
+	}
+}
+
+func TestParseSubtitlesSRT(t *testing.T) {
+	srt := "1\r\n00:01:02,500 --> 00:01:04,000\r\n<i>Hello</i>\r\n\r\n2\r\n00:01:05,000 --> 00:01:06,250\r\nWorld\r\n"
+
+	cues := parseSubtitles(srt)
+	if len(cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %+v", cues)
+	}
+	if cues[0].start != 62.5 || cues[0].end != 64 || cues[0].text != "Hello" {
+		t.Errorf("Unexpected first cue: %+v", cues[0])
+	}
+	if cues[1].end != 66.25 {
+		t.Errorf("Expected the decimal comma to be parsed, got %+v", cues[1])
+	}
+}
+
+func TestDedupeRollingCues(t *testing.T) {
+	cues := dedupeRollingCues(parseSubtitles(youtubeAutoCaptions))
+
+	if len(cues) != 2 {
+		t.Fatalf("Expected the transition cue to be dropped, got %+v", cues)
+	}
+	if cues[1].start != 12 || cues[1].text != "to love" {
+		t.Errorf("Expected only the new line of the rolling cue, got %+v", cues[1])
+	}
+}
+
+func TestClipCues(t *testing.T) {
+	cues := []subtitleCue{
+		{start: 5, end: 9, text: "before"},
+		{start: 9, end: 12, text: "overlaps the start"},
+		{start: 14, end: 16, text: "inside"},
+		{start: 19, end: 22, text: "overlaps the end"},
+		{start: 20, end: 25, text: "after"},
+	}
+
+	clipped := clipCues(cues, 10, 20)
+	expected := []subtitleCue{
+		{start: 0, end: 2, text: "overlaps the start"},
+		{start: 4, end: 6, text: "inside"},
+		{start: 9, end: 10, text: "overlaps the end"},
+	}
+	if len(clipped) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, clipped)
+	}
+	for i := range expected {
+		if clipped[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], clipped[i])
+		}
+	}
+}
+
+func TestClipRequestCuesOfSegments(t *testing.T) {
+	cues := []subtitleCue{
+		{start: 12, end: 14, text: "first"},
+		{start: 101, end: 103, text: "second"},
+		{start: 50, end: 52, text: "skipped"},
+	}
+	request := jobs.JobRequest{
+		Segments:           []jobs.ClipSegment{{From: "10", To: "20"}, {From: "100", To: "110"}},
+		CrossfadeInSeconds: 1,
+	}
+
+	clipped, err := clipRequestCues(cues, request)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []subtitleCue{
+		{start: 2, end: 4, text: "first"},
+		{start: 10, end: 12, text: "second"},
+	}
+	if len(clipped) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, clipped)
+	}
+	for i := range expected {
+		if clipped[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], clipped[i])
+		}
+	}
+}
+
+func TestFormatSubtitles(t *testing.T) {
+	cues := []subtitleCue{{start: 0, end: 2.5, text: "Tom & Jerry"}, {start: 3661.001, end: 3662, text: "Second"}}
+
+	expectedSRT := "1\n00:00:00,000 --> 00:00:02,500\nTom & Jerry\n\n2\n01:01:01,001 --> 01:01:02,000\nSecond\n\n"
+	if srt := formatSubtitles(cues, SubtitleFormatSRT); srt != expectedSRT {
+		t.Errorf("Expected SRT %q, got %q", expectedSRT, srt)
+	}
+
+	expectedVTT := "WEBVTT\n\n00:00:00.000 --> 00:00:02.500\nTom &amp; Jerry\n\n01:01:01.001 --> 01:01:02.000\nSecond\n\n"
+	if vtt := formatSubtitles(cues, SubtitleFormatVTT); vtt != expectedVTT {
+		t.Errorf("Expected VTT %q, got %q", expectedVTT, vtt)
+	}
+}
+
+func TestValidateClipSubtitles(t *testing.T) {
+	tests := []struct {
+		name        string
+		subtitles   jobs.ClipSubtitles
+		output      *jobs.ClipOutput
+		expectedMsg string
+	}{
+		{"Sidecar", jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeSidecar, Format: SubtitleFormatVTT}, nil, ""},
+		{"Sidecar with audio", jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeSidecar}, &jobs.ClipOutput{Format: OutputFormatMP3}, ""},
+		{"Burn into MP4", jobs.ClipSubtitles{Language: "de", Automatic: true, Mode: SubtitleModeBurn}, &jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16"}, ""},
+		{"Soft into the downloaded format", jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeSoft}, nil, ""},
+		{"Missing language", jobs.ClipSubtitles{Mode: SubtitleModeSoft}, nil, "Missing subtitle language."},
+		{"Unknown mode", jobs.ClipSubtitles{Language: "en", Mode: "embed"}, nil, "Invalid subtitle mode. Use sidecar, soft or burn."},
+		{"Unknown format", jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeSidecar, Format: "ass"}, nil, "Invalid subtitle format. Use srt or vtt."},
+		{"Format for soft subtitles", jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeSoft, Format: SubtitleFormatSRT}, nil, "The subtitle format only applies to sidecar subtitles."},
+		{"Burn into GIF", jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeBurn}, &jobs.ClipOutput{Format: OutputFormatGIF}, "GIF outputs only support sidecar subtitles."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateClipSubtitles(tt.subtitles, tt.output)
+			if tt.expectedMsg == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedMsg {
+				t.Errorf("Expected error message %q, got %v", tt.expectedMsg, err)
+			}
+		})
+	}
+}
+
+func TestMuxSubtitlesArgs(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("false")
+	}
+
+	if err := muxSubtitles(context.Background(), "videos/job.webm", "videos/job.subtitles.srt", "en"); err == nil {
+		t.Error("Expected the failed mux to be reported")
+	}
+
+	if len(capturedArgs) == 0 || capturedArgs[0] != "ffmpeg" {
+		t.Fatalf("Expected ffmpeg, got %v", capturedArgs)
+	}
+	if v, ok := flagValue(capturedArgs, "-c"); !ok || v != "copy" {
+		t.Errorf("Expected the clip to be copied, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(capturedArgs, "-c:s"); !ok || v != "webvtt" {
+		t.Errorf("Expected webvtt subtitles in WebM, got %q (present=%v)", v, ok)
+	}
+	if capturedArgs[len(capturedArgs)-1] != "videos/job.muxed.webm" {
+		t.Errorf("Expected the muxed clip next to the original, got %v", capturedArgs)
+	}
+
+	if err := muxSubtitles(context.Background(), "videos/job.mp3", "videos/job.subtitles.srt", "en"); err == nil {
+		t.Error("Expected MP3 to be rejected")
+	}
+}
+
+func TestConvertClipBurnsInSubtitles(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("echo", "mock")
+	}
+
+	output := jobs.ClipOutput{Format: OutputFormatMP4, AspectRatio: "9:16"}
+	_, _ = ConvertClip(context.Background(), "videos/job.source.webm", "videos/job.mp4", output, MediaTags{}, "videos/job.subtitles.srt", 10, nil)
+
+	v, ok := flagValue(capturedArgs, "-vf")
+	expected := reframeFilter(output) + ",subtitles=videos/job.subtitles.srt"
+	if !ok || v != expected {
+		t.Errorf("Expected subtitles burned in after reframing, %q, got %q (present=%v)", expected, v, ok)
+	}
+}
+
+func TestBurnInOutput(t *testing.T) {
+	burn := &jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeBurn}
+
+	if output := burnInOutput(burn, nil); output == nil || output.Format != OutputFormatMP4 {
+		t.Errorf("Expected burned-in subtitles to convert to MP4, got %+v", output)
+	}
+	mp4 := &jobs.ClipOutput{Format: OutputFormatMP4, TargetSizeInMb: 8}
+	if output := burnInOutput(burn, mp4); output != mp4 {
+		t.Errorf("Expected the requested output to be kept, got %+v", output)
+	}
+	if output := burnInOutput(&jobs.ClipSubtitles{Language: "en", Mode: SubtitleModeSoft}, nil); output != nil {
+		t.Errorf("Expected soft subtitles to keep the format, got %+v", output)
+	}
+}
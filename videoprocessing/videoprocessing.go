@@ -1,16 +1,22 @@
 package videoprocessing
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 	"ytclipper-go/config"
 	"ytclipper-go/jobs"
+	"ytclipper-go/storage"
+	"ytclipper-go/utils"
 
 	"github.com/MorrisMorrison/gutils/glogger"
 )
@@ -20,176 +26,413 @@ const throttledStatus = "THROTTLED"
 
 var execContext = exec.CommandContext // allows mocking in tests
 
-func DownloadAndCutVideo(outputPath string, selectedFormat string, fileSizeLimit int64, from string, to string, url string) ([]byte, error) {
+// progressUpdateInterval throttles how often progress is written to the job
+// store; yt-dlp and ffmpeg report several times per second.
+const progressUpdateInterval = 500 * time.Millisecond
+
+// DownloadOptions changes how DownloadAndCutVideo cuts the clip.
+type DownloadOptions struct {
+	// PreciseCut re-encodes around the cut points, so the clip starts exactly at
+	// from instead of on the preceding keyframe. It is slower and uses more CPU.
+	PreciseCut bool
+	// MergeOutputFormat is the container yt-dlp merges separate video and audio
+	// formats into, e.g. for a "137+bestaudio" selector.
+	MergeOutputFormat string
+}
+
+func DownloadAndCutVideo(ctx context.Context, outputPath string, selectedFormat string, fileSizeLimit int64, from string, to string, url string, options DownloadOptions, onProgress func(progress jobs.JobProgress)) ([]byte, error) {
 	cmdArgs := []string{
 		"-o", outputPath,
 		"-f", selectedFormat,
 		"-v",
 		"--max-filesize", fmt.Sprintf("%d", fileSizeLimit),
 		"--download-sections", fmt.Sprintf("*%s-%s", from, to),
-		url,
 	}
+	if options.PreciseCut {
+		cmdArgs = append(cmdArgs, "--force-keyframes-at-cuts")
+	}
+	if options.MergeOutputFormat != "" {
+		cmdArgs = append(cmdArgs, "--merge-output-format", options.MergeOutputFormat)
+	}
+	cmdArgs = append(cmdArgs,
+		"--newline",
+		"--progress-template", ytDlpProgressTemplate,
+		"--downloader-args", "ffmpeg:-progress pipe:1 -nostats",
+		url,
+	)
 
-	return execute("yt-dlp", cmdArgs)
+	return executeStreaming(ctx, "yt-dlp", cmdArgs, progressLineHandler(clipDurationInSeconds(from, to), onProgress))
 }
 
-func ProcessClip(jobID string, url string, from string, to string, selectedFormat string) {
+func ProcessClip(ctx context.Context, jobID string, request jobs.JobRequest) {
+	if ctx.Err() != nil {
+		glogger.Log.Infof("Process Clip: Job %s was cancelled before it started", jobID)
+		return
+	}
+
 	glogger.Log.Infof("Process Clip: Start Job %s", jobID)
 	jobs.StartJob(jobID)
 
-	availableFormats, err := GetAvailableFormats(url)
+	plan, err := planDownload(ctx, jobID, request)
+	if ctx.Err() != nil {
+		glogger.Log.Infof("Process Clip: Job %s was cancelled", jobID)
+		return
+	}
 	if err != nil {
-		glogger.Log.Error(err, "Process Clip: Failed to retrieve formats")
-		jobs.FailJob(jobID, fmt.Sprintf("Failed to retrieve formats: %v", err))
+		removeJobFiles(jobID)
+		failJob(jobID, err)
 		return
 	}
+	request.Output = plan.output
+
+	var lastProgressUpdate time.Time
+	onProgress := func(progress jobs.JobProgress) {
+		if progress.Percent < 100 && time.Since(lastProgressUpdate) < progressUpdateInterval {
+			return
+		}
+		lastProgressUpdate = time.Now()
+		jobs.UpdateJobProgress(jobID, progress)
+	}
+
+	download := downloadClip
+	if len(request.Segments) > 0 {
+		download = downloadSegments
+	}
+	outputPath, err := download(ctx, jobID, request, plan, onProgress)
+	if ctx.Err() != nil {
+		glogger.Log.Infof("Process Clip: Job %s was cancelled", jobID)
+		removeJobFiles(jobID)
+		return
+	}
+	if err != nil {
+		removeJobFiles(jobID)
+		failJob(jobID, err)
+		return
+	}
+
+	var subtitlesPath string
+	if request.Subtitles != nil {
+		subtitlesPath, err = clipSubtitles(ctx, jobID, request)
+		if ctx.Err() != nil {
+			glogger.Log.Infof("Process Clip: Job %s was cancelled", jobID)
+			removeJobFiles(jobID)
+			return
+		}
+		if err != nil {
+			glogger.Log.Errorf(err, "Process Clip: Could not clip the subtitles of job %s", jobID)
+			removeJobFiles(jobID)
+			failJob(jobID, err)
+			return
+		}
+		defer os.Remove(subtitlesPath)
+	}
+
+	if request.Output != nil {
+		var burnedSubtitlesPath string
+		if request.Subtitles != nil && request.Subtitles.Mode == SubtitleModeBurn {
+			burnedSubtitlesPath = subtitlesPath
+		}
+
+		outputPath, err = convertJobClip(ctx, jobID, request, outputPath, burnedSubtitlesPath, onProgress)
+		if ctx.Err() != nil {
+			glogger.Log.Infof("Process Clip: Job %s was cancelled", jobID)
+			removeJobFiles(jobID)
+			return
+		}
+		if err != nil {
+			removeJobFiles(jobID)
+			failJob(jobID, err)
+			return
+		}
+	}
+
+	if request.Subtitles != nil {
+		outputPath, err = deliverSubtitles(ctx, jobID, request, outputPath, subtitlesPath)
+		if ctx.Err() != nil {
+			glogger.Log.Infof("Process Clip: Job %s was cancelled", jobID)
+			removeJobFiles(jobID)
+			return
+		}
+		if err != nil {
+			glogger.Log.Errorf(err, "Process Clip: Could not add the subtitles of job %s", jobID)
+			removeJobFiles(jobID)
+			failJob(jobID, err)
+			return
+		}
+	}
 
-	fileExtension, err := getFileExtensionFromFormatID(selectedFormat, availableFormats)
+	result, err := clipResult(outputPath, requestLengthInSeconds(request))
 	if err != nil {
-		glogger.Log.Errorf(err, "Process Clip: Unsupported format ID: %s", selectedFormat)
-		jobs.FailJob(jobID, fmt.Sprintf("Unsupported format ID: %s", selectedFormat))
+		glogger.Log.Errorf(err, "Process Clip: Could not measure %s", outputPath)
+		removeJobFiles(jobID)
+		failJob(jobID, err)
 		return
 	}
+	if request.Output != nil && request.Output.TargetSizeInMb > 0 && result.SizeInBytes > utils.MbToBytes(request.Output.TargetSizeInMb) {
+		glogger.Log.Infof("Process Clip: Job %s missed its target size of %d MB with %d bytes", jobID, request.Output.TargetSizeInMb, result.SizeInBytes)
+	}
 
-	outputPath := filepath.Join(videoOutputDir, fmt.Sprintf("%s%s", filepath.Base(jobID), fileExtension))
-	output, err := DownloadAndCutVideo(outputPath, selectedFormat, config.CONFIG.YtDlpConfig.ClipSizeInMb, from, to, url)
+	key, err := storeClip(outputPath)
 	if err != nil {
-		glogger.Log.Errorf(err, "Process Clip: Failed to download video: %s", string(output))
-		jobs.FailJob(jobID, fmt.Sprintf("Failed to download video: %s", string(output)))
+		glogger.Log.Errorf(err, "Process Clip: Could not store %s", outputPath)
+		removeJobFiles(jobID)
+		jobs.FailJobWithCode(jobID, jobs.ErrorCodeInternal, "The clip could not be stored. Please try again.")
 		return
 	}
 
 	glogger.Log.Infof("Process Clip: Complete Job %s", jobID)
-	jobs.CompleteJob(jobID, outputPath)
+	jobs.CompleteJobWithResult(jobID, key, result)
+}
+
+// storeClip moves a finished clip from the working directory into
+// storage.Clips and returns its key.
+func storeClip(outputPath string) (string, error) {
+	key := filepath.Base(outputPath)
+	return key, storage.PutFile(context.Background(), storage.Clips, key, outputPath)
 }
 
-func GetAvailableFormats(url string) ([]map[string]string, error) {
+// GetAvailableFormats returns the downloadable formats of the video, without
+// storyboards and formats YouTube throttles.
+func GetAvailableFormats(ctx context.Context, url string) ([]Format, error) {
 	glogger.Log.Infof("Get Available Formats: Fetching available formats for URL %s", url)
 
-	output, err := execute("yt-dlp", []string{"-F", url})
+	info, err := GetVideoInfo(ctx, url)
 	if err != nil {
-		glogger.Log.Errorf(err, "Get Available Formats: Error executing yt-dlp. Output\n%s", string(output))
-		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+		return nil, err
 	}
 
-	if config.CONFIG.Debug {
-		glogger.Log.Infof("Get Available Formats: yt-dlp command succeeded. Output:\n%s", output)
+	formats := make([]Format, 0, len(info.Formats))
+	for _, format := range info.Formats {
+		if format.IsStoryboard() || strings.Contains(format.Note, throttledStatus) {
+			continue
+		}
+		formats = append(formats, format)
 	}
 
-	formats := parseFormats(string(output))
-	if formats == nil {
-		glogger.Log.Errorf(fmt.Errorf("Formats are nil"), "Get Video Duration: Could not find any available formats. Output:/n%s", output)
+	if len(formats) == 0 {
+		glogger.Log.Errorf(fmt.Errorf("Formats are empty"), "Get Available Formats: Could not find any available formats for URL %s", url)
 		return nil, fmt.Errorf("Could not find any available formats")
 	}
 
 	return formats, nil
 }
 
-func GetVideoDuration(url string) (string, error) {
+// GetVideoDuration returns the duration of the video in seconds.
+func GetVideoDuration(ctx context.Context, url string) (float64, error) {
 	glogger.Log.Infof("Get Video Duration: Fetch duration for URL %s", url)
 
-	output, err := execute("yt-dlp", []string{"--get-duration", url})
+	info, err := GetVideoInfo(ctx, url)
 	if err != nil {
-		glogger.Log.Errorf(err, "Get Video Duration: Error executing yt-dlp. Output\n%s", string(output))
-		return "", err
-	}
-
-	if config.CONFIG.Debug {
-		glogger.Log.Infof("Get Video Duration: yt-dlp command succeeded. Output:\n%s", output)
+		return 0, err
 	}
 
-	duration := ExtractDuration(string(output))
-	return duration, nil
+	return info.Duration, nil
 }
 
-func ExtractDuration(output string) string {
-	reWithColon := regexp.MustCompile(`\d+:\d{2}(?::\d{2})?`)
-	matches := reWithColon.FindString(output)
-	if matches != "" {
-		return matches
+func clipDurationInSeconds(from string, to string) float64 {
+	fromInSeconds, err := utils.ToSeconds(from)
+	if err != nil {
+		return 0
+	}
+	toInSeconds, err := utils.ToSeconds(to)
+	if err != nil {
+		return 0
 	}
+	return toInSeconds - fromInSeconds
+}
 
-	reJustSeconds := regexp.MustCompile(`(?m)^\s*(\d+)\s*$`)
-	secMatches := reJustSeconds.FindStringSubmatch(output)
-	if len(secMatches) > 1 {
-		return secMatches[1]
+func getFileExtensionFromFormatID(formatID string, formats []Format) (string, error) {
+	for _, format := range formats {
+		if format.ID == formatID && format.Ext != "" {
+			return fmt.Sprintf(".%s", format.Ext), nil
+		}
 	}
+	return "", fmt.Errorf("format ID not found")
+}
 
-	return ""
+// downloadPlan is what yt-dlp downloads for a job, where it writes it and
+// what the download is converted to afterwards. outputPath ends in %(ext)s
+// when the extension is only known after the download.
+type downloadPlan struct {
+	selector   string
+	outputPath string
+	options    DownloadOptions
+	output     *jobs.ClipOutput
 }
 
-func parseFormats(output string) []map[string]string {
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	if len(lines) == 0 {
-		glogger.Log.Warning("Empty output received when parsing formats")
-		return nil
+// planDownload resolves the format of the request, either a format ID of the
+// video or a preset, and checks that the requested output can be made from it.
+func planDownload(ctx context.Context, jobID string, request jobs.JobRequest) (downloadPlan, error) {
+	duration := requestLengthInSeconds(request)
+	plan := downloadPlan{options: DownloadOptions{PreciseCut: request.PreciseCut}, output: burnInOutput(request.Subtitles, request.Output)}
+
+	if request.Preset != "" {
+		preset, exists := GetPreset(request.Preset)
+		if !exists {
+			glogger.Log.Infof("Process Clip: Preset %s of job %s does not exist anymore", request.Preset, jobID)
+			return plan, &ProcessingError{Code: ErrorCodePresetNotFound, Message: fmt.Sprintf("The preset %q does not exist.", request.Preset)}
+		}
+		// The formats a selector picks are only known to yt-dlp, so the output
+		// is not checked against them.
+		if preset.Output != nil {
+			if err := outputError(*preset.Output, true, true, duration); err != nil {
+				return plan, err
+			}
+		}
+
+		plan.selector = preset.Format
+		plan.options.MergeOutputFormat = preset.Container
+		plan.output = burnInOutput(request.Subtitles, preset.Output)
+		plan.outputPath = jobFilePath(jobID, plan.output != nil, ".%(ext)s")
+		return plan, nil
+	}
+
+	availableFormats, err := GetAvailableFormats(ctx, request.Url)
+	if err != nil {
+		glogger.Log.Error(err, "Process Clip: Failed to retrieve formats")
+		return plan, err
+	}
+
+	fileExtension, err := getFileExtensionFromFormatID(request.Format, availableFormats)
+	if err != nil {
+		glogger.Log.Errorf(err, "Process Clip: Unsupported format ID: %s", request.Format)
+		return plan, &ProcessingError{
+			Code:    ErrorCodeFormatUnavailable,
+			Message: fmt.Sprintf("Format %s is not available for this video. Please choose another format.", request.Format),
+			Err:     err,
+		}
 	}
 
-	formatRegex := regexp.MustCompile(`(?m)^\s*(\d+)\s+(\w+)\s+(audio only|video only|\d+x\d+|\d+p)\s+([a-zA-Z0-9\.\-\_]+)?\s*([\~\d\.]+(?:[kKM]i?B)?)?.*?\|\s+(.*?)$`)
-	formats := make([]map[string]string, 0, len(lines))
+	format, _ := findFormat(request.Format, availableFormats)
+	plan.selector = request.Format
+	hasAudio := format.HasAudio()
+	if mergesBestAudio(format, request) {
+		plan.selector, plan.options.MergeOutputFormat = bestAudioSelector(format)
+		hasAudio = true
+		glogger.Log.Infof("Process Clip: Merging video-only format %s of job %s with %s", format.ID, jobID, plan.selector)
+	}
 
-	for _, line := range lines {
-		if format := parseFormatLine(line, formatRegex); format != nil {
-			formats = append(formats, format)
+	if plan.output != nil {
+		if err := outputError(*plan.output, format.HasVideo(), hasAudio, duration); err != nil {
+			glogger.Log.Infof("Process Clip: Format %s of job %s cannot be converted to %s", request.Format, jobID, plan.output.Format)
+			return plan, err
 		}
 	}
 
-	return formats
+	plan.outputPath = jobFilePath(jobID, plan.output != nil, fileExtension)
+	return plan, nil
 }
 
-func parseFormatLine(line string, formatRegex *regexp.Regexp) map[string]string {
-	matches := formatRegex.FindStringSubmatch(line)
-	if len(matches) == 0 {
-		return nil
+// burnInOutput returns the output of a clip. Burned-in subtitles re-encode the
+// video, so clips that keep their format are converted to MP4 for them.
+func burnInOutput(subtitles *jobs.ClipSubtitles, output *jobs.ClipOutput) *jobs.ClipOutput {
+	if output == nil && subtitles != nil && subtitles.Mode == SubtitleModeBurn {
+		return &jobs.ClipOutput{Format: OutputFormatMP4}
 	}
+	return output
+}
 
-	additional := strings.TrimSpace(matches[6])
-	if strings.Contains(additional, throttledStatus) {
-		return nil
+// deliverSubtitles muxes the subtitles into the clip or bundles them with it,
+// and returns the file of the job. Burned-in subtitles are already part of the
+// clip.
+func deliverSubtitles(ctx context.Context, jobID string, request jobs.JobRequest, clipPath string, subtitlesPath string) (string, error) {
+	switch request.Subtitles.Mode {
+	case SubtitleModeSoft:
+		return clipPath, muxSubtitles(ctx, clipPath, subtitlesPath, request.Subtitles.Language)
+	case SubtitleModeSidecar:
+		return bundleSidecar(ctx, jobID, request, clipPath, subtitlesPath)
+	default:
+		return clipPath, nil
 	}
+}
 
-	return map[string]string{
-		"id":         matches[1],
-		"extension":  matches[2],
-		"label":      matches[3],
-		"codec":      strings.TrimSpace(matches[4]),
-		"bitrate":    extractBitrate(matches[6]),
-		"formatType": determineFormatType(matches[3]),
-		"additional": additional,
+// jobFilePath returns where the download of a job is written. Downloads that
+// are converted afterwards into <jobID>.<output format> are kept apart as
+// <jobID>.source.<ext>, as both may share the extension.
+func jobFilePath(jobID string, converted bool, fileExtension string) string {
+	if converted {
+		return filepath.Join(videoOutputDir, fmt.Sprintf("%s.source%s", filepath.Base(jobID), fileExtension))
 	}
+	return filepath.Join(videoOutputDir, fmt.Sprintf("%s%s", filepath.Base(jobID), fileExtension))
 }
 
-func determineFormatType(label string) string {
-	switch label {
-	case "audio only":
-		return "audio only"
-	case "video only":
-		return "video only"
-	default:
-		return "audio and video"
+// downloadedFile returns the file yt-dlp wrote to outputPath, resolving an
+// %(ext)s placeholder to the extension it chose.
+func downloadedFile(outputPath string) (string, error) {
+	if !strings.HasSuffix(outputPath, ".%(ext)s") {
+		_, err := os.Stat(outputPath)
+		return outputPath, err
+	}
+
+	files, err := filepath.Glob(strings.TrimSuffix(outputPath, "%(ext)s") + "*")
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".part") && !strings.HasSuffix(file, ".ytdl") {
+			return file, nil
+		}
 	}
+	return "", fmt.Errorf("%s: %w", outputPath, os.ErrNotExist)
 }
 
-func extractBitrate(additional string) string {
-	bitrateRegex := regexp.MustCompile(`([\~\d\.]+[kKM]i?B)`)
-	match := bitrateRegex.FindStringSubmatch(additional)
-	if len(match) > 0 {
-		return match[1]
+// mergesBestAudio reports whether a video-only format is downloaded together
+// with the best audio, so the clip is not silent. Requests opt out with
+// NoAudio; animations have no sound, so they never merge.
+func mergesBestAudio(format Format, request jobs.JobRequest) bool {
+	if request.NoAudio || !format.HasVideo() || format.HasAudio() {
+		return false
 	}
+	return request.Output == nil || !IsAnimationOutput(request.Output.Format)
+}
 
-	glogger.Log.Warningf("Extract Bitrate: Could not extract bitrate from %s", additional)
-	return "N/A"
+// bestAudioSelector selects the video format with the best audio that fits its
+// container (AAC for MP4, Opus for WebM), falling back to any best audio. It
+// returns the yt-dlp format selector and the container to merge into.
+func bestAudioSelector(format Format) (string, string) {
+	audioExtension := "webm"
+	if format.Ext == "mp4" {
+		audioExtension = "m4a"
+	}
+	selector := fmt.Sprintf("%s+bestaudio[ext=%s]/%s+bestaudio", format.ID, audioExtension, format.ID)
+	return selector, format.Ext
 }
 
-func getFileExtensionFromFormatID(formatID string, formats []map[string]string) (string, error) {
+func findFormat(formatID string, formats []Format) (Format, bool) {
 	for _, format := range formats {
-		if format["id"] == formatID {
-			if ext, exists := format["extension"]; exists {
-				return fmt.Sprintf(".%s", ext), nil
-			}
+		if format.ID == formatID {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+// failJob stores a classified error on the job. Unclassified errors are
+// reported with a generic message, so raw command output never reaches users.
+func failJob(jobID string, err error) {
+	var processingErr *ProcessingError
+	if errors.As(err, &processingErr) {
+		jobs.FailJobWithCode(jobID, processingErr.Code, processingErr.Message)
+		return
+	}
+
+	jobs.FailJobWithCode(jobID, ErrorCodeDownloadFailed, "The clip could not be created. Please try again in a few minutes.")
+}
+
+// removeJobFiles deletes everything yt-dlp wrote for the job, including
+// partial downloads such as <jobID>.mp4.part.
+func removeJobFiles(jobID string) {
+	files, err := filepath.Glob(filepath.Join(videoOutputDir, filepath.Base(jobID)+"*"))
+	if err != nil {
+		glogger.Log.Errorf(err, "Remove Job Files: Could not list files for job %s", jobID)
+		return
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			glogger.Log.Errorf(err, "Remove Job Files: Could not delete %s", file)
 		}
 	}
-	return "", fmt.Errorf("format ID not found")
 }
 
 // commonArgs returns the flags applied to every yt-dlp invocation. Downloads run
@@ -212,22 +455,112 @@ func commonArgs() []string {
 	return args
 }
 
-func execute(name string, baseArgs []string) ([]byte, error) {
+func execute(ctx context.Context, name string, baseArgs []string) ([]byte, error) {
+	return executeStreaming(ctx, name, baseArgs, nil)
+}
+
+// executeStreaming runs the command like execute, but hands every output line
+// to onLine as it is printed. Lines onLine reports as consumed are left out of
+// the returned output.
+func executeStreaming(ctx context.Context, name string, baseArgs []string, onLine func(line string) bool) ([]byte, error) {
 	timeout := time.Duration(config.CONFIG.YtDlpConfig.CommandTimeoutInSeconds) * time.Second
 	args := append(commonArgs(), baseArgs...)
-	return executeWithTimeout(timeout, name, args...)
+	return executeWithTimeout(ctx, timeout, onLine, name, args...)
 }
 
-func executeWithTimeout(timeout time.Duration, name string, args ...string) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// executeWithTimeout runs the command and returns its combined output.
+func executeWithTimeout(parent context.Context, timeout time.Duration, onLine func(line string) bool, name string, args ...string) ([]byte, error) {
+	output := &lineWriter{onLine: onLine}
+	err := runWithTimeout(parent, timeout, output, output, name, args...)
+	output.Flush()
+
+	return output.Bytes(), err
+}
+
+// executeJSON runs yt-dlp and decodes its stdout into v. stderr is returned
+// for logging and error classification.
+func executeJSON(ctx context.Context, baseArgs []string, v any) ([]byte, error) {
+	timeout := time.Duration(config.CONFIG.YtDlpConfig.CommandTimeoutInSeconds) * time.Second
+	args := append(commonArgs(), baseArgs...)
+
+	var stdout, stderr bytes.Buffer
+	if err := runWithTimeout(ctx, timeout, &stdout, &stderr, "yt-dlp", args...); err != nil {
+		return stderr.Bytes(), err
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), v); err != nil {
+		return stderr.Bytes(), fmt.Errorf("could not decode yt-dlp output: %w", err)
+	}
+	return stderr.Bytes(), nil
+}
+
+// runWithTimeout runs the command until it exits, the timeout expires or the
+// parent context is cancelled. On timeout or cancellation the whole process
+// group is killed.
+func runWithTimeout(parent context.Context, timeout time.Duration, stdout io.Writer, stderr io.Writer, name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
 	cmd := execContext(ctx, name, args...)
+	startProcessGroup(cmd)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	stopKill := context.AfterFunc(ctx, func() { killProcessGroup(cmd) })
+	err := cmd.Wait()
+	stopKill()
 
-	output, err := cmd.CombinedOutput()
+	if parent.Err() != nil {
+		return parent.Err()
+	}
 	if ctx.Err() == context.DeadlineExceeded {
-		return nil, fmt.Errorf("command timed out after %v", timeout)
+		return fmt.Errorf("%w after %v", ErrCommandTimeout, timeout)
 	}
 
-	return output, err
+	return err
+}
+
+// lineWriter collects command output. With onLine set, output is split into
+// lines on \n and \r (ffmpeg and yt-dlp redraw progress with \r).
+type lineWriter struct {
+	output  bytes.Buffer
+	partial []byte
+	onLine  func(line string) bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w.onLine == nil {
+		return w.output.Write(p)
+	}
+
+	for _, b := range p {
+		if b == '\n' || b == '\r' {
+			w.Flush()
+			continue
+		}
+		w.partial = append(w.partial, b)
+	}
+	return len(p), nil
+}
+
+// Flush hands a trailing line without a line break to onLine.
+func (w *lineWriter) Flush() {
+	if len(w.partial) == 0 {
+		return
+	}
+
+	line := string(w.partial)
+	w.partial = w.partial[:0]
+	if !w.onLine(line) {
+		w.output.WriteString(line)
+		w.output.WriteByte('\n')
+	}
+}
+
+func (w *lineWriter) Bytes() []byte {
+	return w.output.Bytes()
 }
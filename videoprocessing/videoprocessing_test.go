@@ -2,10 +2,16 @@ package videoprocessing
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 	"ytclipper-go/config"
+	"ytclipper-go/jobs"
 )
 
 func hasFlag(args []string, flag string) bool {
@@ -26,39 +32,6 @@ func flagValue(args []string, flag string) (string, bool) {
 	return "", false
 }
 
-func TestExtractDuration(t *testing.T) {
-	output := "Duration: 00:01:30"
-	expected := "00:01:30"
-
-	duration := ExtractDuration(output)
-	if duration != expected {
-		t.Errorf("Expected %s, but got %s", expected, duration)
-	}
-}
-
-func TestExtractBitrate(t *testing.T) {
-	tests := []struct {
-		name       string
-		additional string
-		expected   string
-	}{
-		{name: "Valid bitrate in KiB", additional: "128KiB", expected: "128KiB"},
-		{name: "Valid bitrate in MiB", additional: "1.2MiB", expected: "1.2MiB"},
-		{name: "Valid bitrate with tilde (~)", additional: "~192KiB", expected: "~192KiB"},
-		{name: "No bitrate", additional: "Some other text", expected: "N/A"},
-		{name: "Empty string", additional: "", expected: "N/A"},
-	}
-
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			result := extractBitrate(test.additional)
-			if result != test.expected {
-				t.Errorf("For input '%s', expected '%s', but got '%s'", test.additional, test.expected, result)
-			}
-		})
-	}
-}
-
 func TestDownloadAndCutVideo(t *testing.T) {
 	originalExecContext := execContext
 	defer func() { execContext = originalExecContext }()
@@ -76,7 +49,7 @@ func TestDownloadAndCutVideo(t *testing.T) {
 	to := "00:01:00"
 	url := "https://www.youtube.com/watch?v=example"
 
-	_, _ = DownloadAndCutVideo(outputPath, selectedFormat, fileSizeLimit, from, to, url)
+	_, _ = DownloadAndCutVideo(context.Background(), outputPath, selectedFormat, fileSizeLimit, from, to, url, DownloadOptions{}, nil)
 
 	if len(capturedArgs) == 0 || capturedArgs[0] != "yt-dlp" {
 		t.Fatalf("Expected first arg to be 'yt-dlp', got %v", capturedArgs)
@@ -93,6 +66,89 @@ func TestDownloadAndCutVideo(t *testing.T) {
 	if v, ok := flagValue(capturedArgs, "--download-sections"); !ok || v != expectedSection {
 		t.Errorf("Expected --download-sections %q, got %q (present=%v)", expectedSection, v, ok)
 	}
+
+	if !hasFlag(capturedArgs, "--newline") {
+		t.Error("Expected --newline argument to be present")
+	}
+	if hasFlag(capturedArgs, "--force-keyframes-at-cuts") {
+		t.Error("Expected --force-keyframes-at-cuts to be absent without precise cut")
+	}
+	if v, ok := flagValue(capturedArgs, "--progress-template"); !ok || v != ytDlpProgressTemplate {
+		t.Errorf("Expected --progress-template %q, got %q (present=%v)", ytDlpProgressTemplate, v, ok)
+	}
+}
+
+func TestDownloadAndCutVideoPreciseCut(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("echo", "mock")
+	}
+
+	from := "00:00:30.250"
+	to := "00:01:00.750"
+	_, _ = DownloadAndCutVideo(context.Background(), "./videos/test_clip.mp4", "22", 500000000, from, to, "https://www.youtube.com/watch?v=example", DownloadOptions{PreciseCut: true}, nil)
+
+	if v, ok := flagValue(capturedArgs, "--download-sections"); !ok || v != "*00:00:30.250-00:01:00.750" {
+		t.Errorf("Expected millisecond download section, got %q (present=%v)", v, ok)
+	}
+	if !hasFlag(capturedArgs, "--force-keyframes-at-cuts") {
+		t.Error("Expected --force-keyframes-at-cuts argument to be present")
+	}
+}
+
+func TestDownloadAndCutVideoMergesFormats(t *testing.T) {
+	originalExecContext := execContext
+	defer func() { execContext = originalExecContext }()
+
+	var capturedArgs []string
+	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		capturedArgs = append([]string{name}, arg...)
+		return exec.Command("echo", "mock")
+	}
+
+	selector, mergeOutputFormat := bestAudioSelector(Format{ID: "137", Ext: "mp4", VCodec: "avc1", ACodec: "none"})
+	_, _ = DownloadAndCutVideo(context.Background(), "./videos/test_clip.mp4", selector, 500000000, "00:00:30", "00:01:00", "https://www.youtube.com/watch?v=example", DownloadOptions{MergeOutputFormat: mergeOutputFormat}, nil)
+
+	if v, ok := flagValue(capturedArgs, "-f"); !ok || v != "137+bestaudio[ext=m4a]/137+bestaudio" {
+		t.Errorf("Expected merged format selector, got %q (present=%v)", v, ok)
+	}
+	if v, ok := flagValue(capturedArgs, "--merge-output-format"); !ok || v != "mp4" {
+		t.Errorf("Expected --merge-output-format mp4, got %q (present=%v)", v, ok)
+	}
+}
+
+func TestMergesBestAudio(t *testing.T) {
+	videoOnly := Format{ID: "248", Ext: "webm", VCodec: "vp9", ACodec: "none"}
+	combined := Format{ID: "18", Ext: "mp4", VCodec: "avc1", ACodec: "mp4a"}
+	audioOnly := Format{ID: "140", Ext: "m4a", VCodec: "none", ACodec: "mp4a"}
+
+	tests := []struct {
+		name     string
+		format   Format
+		request  jobs.JobRequest
+		expected bool
+	}{
+		{"Video only", videoOnly, jobs.JobRequest{}, true},
+		{"Video only with opt-out", videoOnly, jobs.JobRequest{NoAudio: true}, false},
+		{"Video only as GIF", videoOnly, jobs.JobRequest{Output: &jobs.ClipOutput{Format: OutputFormatGIF}}, false},
+		{"Video only as MP3", videoOnly, jobs.JobRequest{Output: &jobs.ClipOutput{Format: OutputFormatMP3}}, true},
+		{"Audio and video", combined, jobs.JobRequest{}, false},
+		{"Audio only", audioOnly, jobs.JobRequest{}, false},
+	}
+
+	for _, tt := range tests {
+		if merges := mergesBestAudio(tt.format, tt.request); merges != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, merges)
+		}
+	}
+
+	if selector, container := bestAudioSelector(videoOnly); selector != "248+bestaudio[ext=webm]/248+bestaudio" || container != "webm" {
+		t.Errorf("Unexpected WebM selector %q into %q", selector, container)
+	}
 }
 
 func TestGetVideoDuration(t *testing.T) {
@@ -102,19 +158,22 @@ func TestGetVideoDuration(t *testing.T) {
 	var capturedArgs []string
 	execContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
 		capturedArgs = append([]string{name}, arg...)
-		return exec.Command("echo", "00:03:45")
+		return exec.Command("echo", "mock")
 	}
 
-	// Output parsing is covered by TestExtractDuration; here we only assert the
-	// command is built correctly (avoids depending on `echo` being an executable,
-	// which it isn't on Windows).
-	_, _ = GetVideoDuration("https://www.youtube.com/watch?v=example")
+	// JSON decoding is covered by TestVideoInfoDecodesYtDlpJSON; here we only
+	// assert the command is built correctly (avoids depending on `echo` being an
+	// executable, which it isn't on Windows).
+	_, _ = GetVideoDuration(context.Background(), "https://www.youtube.com/watch?v=example")
 
 	if len(capturedArgs) == 0 || capturedArgs[0] != "yt-dlp" {
 		t.Fatalf("Expected first arg to be 'yt-dlp', got %v", capturedArgs)
 	}
-	if !hasFlag(capturedArgs, "--get-duration") {
-		t.Error("Expected --get-duration argument to be present")
+	if !hasFlag(capturedArgs, "-J") {
+		t.Error("Expected -J argument to be present")
+	}
+	if !hasFlag(capturedArgs, "--no-playlist") {
+		t.Error("Expected --no-playlist argument to be present")
 	}
 	if !hasFlag(capturedArgs, "--no-warnings") {
 		t.Error("Expected --no-warnings argument to be present")
@@ -156,3 +215,59 @@ func TestCommonArgsWithoutProxy(t *testing.T) {
 		t.Errorf("Did not expect --proxy when unset, got %v", args)
 	}
 }
+
+func TestExecuteWithTimeoutCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := executeWithTimeout(ctx, 10*time.Second, nil, "sleep", "10")
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected cancelled command to be killed promptly, took %v", time.Since(start))
+	}
+}
+
+func TestExecuteWithTimeoutStreamsLines(t *testing.T) {
+	var lines []string
+	onLine := func(line string) bool {
+		lines = append(lines, line)
+		return strings.HasPrefix(line, "progress")
+	}
+
+	output, err := executeWithTimeout(context.Background(), 5*time.Second, onLine, "printf", `progress 1\rprogress 2\nerror line\n`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(lines) != 3 {
+		t.Errorf("Expected 3 lines, got %v", lines)
+	}
+	if string(output) != "error line\n" {
+		t.Errorf("Expected consumed lines to be left out of the output, got %q", output)
+	}
+}
+
+func TestDownloadedFileResolvesExtension(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"job.source.mp4.part", "job.source.webm"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("clip"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, err := downloadedFile(filepath.Join(dir, "job.source.%(ext)s"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if path != filepath.Join(dir, "job.source.webm") {
+		t.Errorf("Expected the finished download, got %s", path)
+	}
+
+	if _, err := downloadedFile(filepath.Join(dir, "other.%(ext)s")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a not exist error, got %v", err)
+	}
+}